@@ -0,0 +1,80 @@
+-- Schema of the PostgreSQL and SQLite database backends (DATABASE_BACKEND=postgres or sqlite).
+-- Each collection (collection_name of the metadata) is a table with its versions and status history tables, repeat them for
+-- every collection, e.g. music and podcast. The rows are created by the application, the converter only
+-- updates them. The application columns (title, year, ...) are omitted.
+
+CREATE TABLE IF NOT EXISTS music (
+    id                              TEXT PRIMARY KEY,
+    artist                          TEXT,
+    album                           TEXT,
+    conversion_status               TEXT,
+    conversion_run_id               TEXT,
+    conversion_event_sequencer      TEXT,
+    cancel_requested                BOOLEAN NOT NULL DEFAULT FALSE,
+    content_key                     TEXT,
+    synced_lyrics_key               TEXT,
+    has_synced_lyrics               BOOLEAN NOT NULL DEFAULT FALSE,
+    duration                        TEXT,
+    source_sha256                   TEXT,
+    output_sha256                   TEXT,
+    replay_gain_integrated_loudness DOUBLE PRECISION,
+    replay_gain_true_peak           DOUBLE PRECISION,
+    replay_gain_track_gain          DOUBLE PRECISION,
+    replay_gain_track_peak          DOUBLE PRECISION,
+    replay_gain_album_gain          DOUBLE PRECISION,
+    replay_gain_album_peak          DOUBLE PRECISION,
+    loudness_integrated             DOUBLE PRECISION,
+    loudness_short_term_max         DOUBLE PRECISION,
+    loudness_range                  DOUBLE PRECISION,
+    loudness_true_peak              DOUBLE PRECISION,
+    bpm                             DOUBLE PRECISION,
+    bpm_confidence                  DOUBLE PRECISION,
+    musical_key                     TEXT,
+    key_confidence                  DOUBLE PRECISION,
+    presigned_content_url           TEXT,
+    presigned_synced_lyrics_url     TEXT,
+    presigned_urls_expire_at        TIMESTAMP,
+    progress_percent                DOUBLE PRECISION,
+    progress_speed                  DOUBLE PRECISION,
+    progress_eta_seconds            DOUBLE PRECISION,
+    progress_updated_at             TIMESTAMP,
+    failure_code                    TEXT,
+    failure_message                 TEXT,
+    failure_stderr                  TEXT,
+    failure_debug_bundle_key        TEXT,
+    failure_retryable               BOOLEAN,
+    failure_at                      TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS music_versions (
+    document_id TEXT NOT NULL REFERENCES music (id) ON DELETE CASCADE,
+    object_key  TEXT NOT NULL,
+    sha256      TEXT NOT NULL,
+    preset      TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (document_id, object_key)
+);
+
+CREATE TABLE IF NOT EXISTS music_status_history (
+    document_id TEXT NOT NULL REFERENCES music (id) ON DELETE CASCADE,
+    status      TEXT NOT NULL,
+    run_id      TEXT NOT NULL,
+    at          TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS music_status_history_document_id ON music_status_history (document_id, at);
+
+-- Conversion cache, named by CONVERSION_CACHE_COLLECTION.
+CREATE TABLE IF NOT EXISTS conversion_cache (
+    id                              TEXT PRIMARY KEY,
+    bucket                          TEXT NOT NULL,
+    object_key                      TEXT NOT NULL,
+    output_sha256                   TEXT NOT NULL,
+    tags_sha256                     TEXT NOT NULL,
+    duration                        DOUBLE PRECISION NOT NULL,
+    replay_gain_integrated_loudness DOUBLE PRECISION,
+    replay_gain_true_peak           DOUBLE PRECISION,
+    replay_gain_track_gain          DOUBLE PRECISION,
+    replay_gain_track_peak          DOUBLE PRECISION,
+    created_at                      TIMESTAMP NOT NULL
+);
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"fmt"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+// UpdateAlbumGain computes the album gain from all converted tracks of the album and stores it on each track document.
+// It's called after every track conversion, so the value is final once all tracks of the album are converted.
+// INFO: The album gain is only stored in the database, the already uploaded files keep their track tags.
+func UpdateAlbumGain(repo database.ContentRepository, collectionName, artist, album string) error {
+	tracks, err := repo.FindAlbumTracks(collectionName, artist, album)
+	if err != nil {
+		return err
+	}
+
+	loudness := make([]converter.TrackLoudness, 0, len(tracks))
+	for _, track := range tracks {
+		loudness = append(loudness, converter.TrackLoudness{
+			IntegratedLoudness: track.ReplayGain.IntegratedLoudness,
+			TruePeak:           track.ReplayGain.TruePeak,
+			Duration:           utils.ParserTimeToSeconds(track.Duration),
+		})
+	}
+
+	albumGain, err := converter.AlbumReplayGain(loudness)
+	if err != nil {
+		return fmt.Errorf("failed to compute album gain of %s: %w", album, err)
+	}
+
+	return repo.SaveAlbumGain(collectionName, artist, album, albumGain.TrackGain, albumGain.TrackPeak)
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"pitanguinha.com/audio-converter/internal/analysis"
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+const defaultAnalysisPresignMinutes = 15
+
+// LoudnessAnalysisEnabled reports whether the loudness of the converted content is measured, it's disabled by
+// setting LOUDNESS_ANALYSIS to false.
+func LoudnessAnalysisEnabled() bool {
+	return os.Getenv("LOUDNESS_ANALYSIS") != "false"
+}
+
+// MusicAnalysisEnabled reports whether the tempo and key of the content are estimated: only for music, and
+// it's disabled by setting MUSIC_ANALYSIS to false.
+func MusicAnalysisEnabled(metadata map[string]string) bool {
+	return metadata["type"] == "music" && os.Getenv("MUSIC_ANALYSIS") != "false"
+}
+
+// MusicAnalysisTagsEnabled reports whether the tempo and key are written as tags (TBPM and TKEY on mp3),
+// enabled by setting MUSIC_ANALYSIS_TAGS to true.
+func MusicAnalysisTagsEnabled() bool {
+	return os.Getenv("MUSIC_ANALYSIS_TAGS") == "true"
+}
+
+// AnalyzeOutput measures the loudness of the converted content on every job and estimates the tempo and key of
+// music, see AnalyzeLoudness and AnalyzeMusic. The tempo and key tags are written if the processed file is given,
+// which must then be verified after. The failures are logged, the values which were not measured are nil.
+func AnalyzeOutput(ctx context.Context, store storage.ObjectStore, bucket, contentKey, filePath string, metadata map[string]string) (*analysis.Loudness, *analysis.MusicAnalysis) {
+	var loudness *analysis.Loudness
+	var musicAnalysis *analysis.MusicAnalysis
+	var err error
+
+	if LoudnessAnalysisEnabled() {
+		loudness, err = AnalyzeLoudness(ctx, store, bucket, contentKey, filePath)
+		if err != nil {
+			slog.Warn("failed to analyze loudness", "err", err)
+		}
+	}
+	if !MusicAnalysisEnabled(metadata) {
+		return loudness, nil
+	}
+
+	musicAnalysis, err = AnalyzeMusic(ctx, store, bucket, contentKey, filePath)
+	if err != nil {
+		slog.Warn("failed to analyze tempo and key", "err", err)
+	} else if musicAnalysis != nil {
+		slog.Info("Music analyzed", "bpm", musicAnalysis.BPM, "key", musicAnalysis.Key)
+	}
+
+	// The tags can only be written before the upload.
+	if musicAnalysis != nil && filePath != "" && MusicAnalysisTagsEnabled() {
+		audioFormat := os.Getenv("AUDIO_FORMAT")
+		if err := converter.WriteTags(filePath, audioFormat, converter.MusicAnalysisTags(musicAnalysis, audioFormat)); err != nil {
+			slog.Warn("failed to write tempo and key tags", "err", err)
+		}
+	}
+	return loudness, musicAnalysis
+}
+
+// AnalyzeLoudness measures the loudness of the converted content: the processed file or, if it's empty (streaming
+// mode or copied cached conversion), the uploaded object through a presigned URL.
+// Returns nil if the object can't be read by FFmpeg, i.e. the store can't create presigned URLs.
+func AnalyzeLoudness(ctx context.Context, store storage.ObjectStore, bucket, contentKey, filePath string) (*analysis.Loudness, error) {
+	input, err := analysisInput(store, bucket, contentKey, filePath)
+	if input == "" || err != nil {
+		return nil, err
+	}
+	return converter.MeasureLoudness(ctx, input)
+}
+
+// AnalyzeMusic estimates the tempo and key of the converted content, read as by AnalyzeLoudness.
+func AnalyzeMusic(ctx context.Context, store storage.ObjectStore, bucket, contentKey, filePath string) (*analysis.MusicAnalysis, error) {
+	input, err := analysisInput(store, bucket, contentKey, filePath)
+	if input == "" || err != nil {
+		return nil, err
+	}
+	return converter.AnalyzeMusic(ctx, input)
+}
+
+// analysisInput returns the input of FFmpeg to analyze the converted content: the processed file or a presigned URL
+// of the uploaded object, valid for ANALYSIS_PRESIGN_EXPIRY_MINUTES. Empty if the store can't create presigned URLs.
+func analysisInput(store storage.ObjectStore, bucket, contentKey, filePath string) (string, error) {
+	if filePath != "" {
+		return filePath, nil
+	}
+
+	presigner, ok := store.(storage.Presigner)
+	if !ok {
+		return "", nil
+	}
+	expiry, err := presignExpiry("ANALYSIS_PRESIGN_EXPIRY_MINUTES", defaultAnalysisPresignMinutes)
+	if err != nil {
+		return "", err
+	}
+	return presigner.PresignGetObject(bucket, contentKey, expiry)
+}
+
+// newStoredLoudness converts the measured loudness to be stored, nil if it was not measured.
+func newStoredLoudness(loudness *analysis.Loudness) *database.Loudness {
+	if loudness == nil {
+		return nil
+	}
+	return &database.Loudness{
+		Integrated:   loudness.Integrated,
+		ShortTermMax: loudness.ShortTermMax,
+		Range:        loudness.Range,
+		TruePeak:     loudness.TruePeak,
+	}
+}
+
+// newStoredMusicAnalysis converts the estimated tempo and key to be stored, nil if they were not estimated.
+func newStoredMusicAnalysis(result *analysis.MusicAnalysis) *database.MusicAnalysis {
+	if result == nil {
+		return nil
+	}
+	return &database.MusicAnalysis{
+		BPM:           result.BPM,
+		BPMConfidence: result.BPMConfidence,
+		Key:           result.Key,
+		KeyConfidence: result.KeyConfidence,
+	}
+}
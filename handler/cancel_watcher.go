@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+const defaultCancelPollInterval = 5 // seconds
+
+// CancelWatcher polls the cancel_requested flag of the document of a run every CANCEL_POLL_INTERVAL_SECONDS and
+// cancels its context when the flag is set, which kills FFmpeg.
+type CancelWatcher struct {
+	run       *ConversionRun
+	cancel    context.CancelFunc
+	requested atomic.Bool
+	stop      chan struct{}
+	done      sync.WaitGroup
+	stopOnce  sync.Once
+}
+
+// WatchCancellation starts a CancelWatcher for the run, it must be stopped with Stop.
+// Returns the context cancelled when the cancellation is requested.
+func WatchCancellation(parent context.Context, run *ConversionRun) (context.Context, *CancelWatcher) {
+	ctx, cancel := context.WithCancel(parent)
+	w := &CancelWatcher{run: run, cancel: cancel, stop: make(chan struct{})}
+
+	interval := time.Duration(max(utils.GetEnvInt("CANCEL_POLL_INTERVAL_SECONDS", defaultCancelPollInterval), 1)) * time.Second
+	w.done.Add(1)
+	go w.poll(interval)
+	return ctx, w
+}
+
+// Requested reports whether the cancellation was requested, checking the flag if it was not seen yet.
+func (w *CancelWatcher) Requested() bool {
+	if w.requested.Load() {
+		return true
+	}
+	w.check()
+	return w.requested.Load()
+}
+
+// Stop stops the polling and releases the context, which must not be used after it. It can be called more than once.
+func (w *CancelWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		w.done.Wait()
+		w.cancel()
+	})
+}
+
+// poll checks the flag at each interval, until it's set or the watcher is stopped.
+func (w *CancelWatcher) poll(interval time.Duration) {
+	defer w.done.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if w.check() {
+				return
+			}
+		}
+	}
+}
+
+// check reads the flag and cancels the context if it's set, returns true if so.
+func (w *CancelWatcher) check() bool {
+	requested, err := w.run.repo.IsCancelRequested(w.run.CollectionName, w.run.DocumentID)
+	if err != nil {
+		slog.Warn("failed to check conversion cancellation", "run", w.run.ID, "err", err)
+		return false
+	}
+	if requested && w.requested.CompareAndSwap(false, true) {
+		slog.Info("Conversion cancellation requested", "run", w.run.ID)
+		w.cancel()
+	}
+	return requested
+}
+
+// cancelConversion sets CANCELLED on the document of the run and removes the scratch files, the job files in the
+// bucket are left in place.
+func cancelConversion(run *ConversionRun) {
+	if err := run.Cancel(); err != nil {
+		slog.Error("error setting conversion status", "status", database.StatusCancelled, "err", err)
+	} else {
+		slog.Info("Conversion cancelled", "run", run.ID)
+	}
+
+	if err := utils.DeleteFiles(utils.GetWorkDir()); err != nil {
+		slog.Warn("failed to clean up temporary files", "err", err)
+	}
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/storage"
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+const (
+	defaultContentKeyTemplate = "{parent}/{safe(title)}.{ext}"
+	defaultKeySegmentMaxBytes = 200  // Max length of each key segment, S3 limits the whole key to 1024 bytes
+	maxKeyBytes               = 1024 // S3 limit
+	maxKeyCollisionAttempts   = 10
+
+	documentIDMetadataKey = "document-id"
+)
+
+// placeholderRegex matches the template placeholders, e.g. {title} or {slug(title)}.
+var placeholderRegex = regexp.MustCompile(`\{(?:(\w+)\()?(\w+)\)?\}`)
+
+// keyFuncs are the functions that can be applied to a placeholder value.
+var keyFuncs = map[string]func(string) string{
+	"slug":  utils.Slugify,
+	"safe":  safeKeySegment,
+	"lower": strings.ToLower,
+}
+
+// BuildContentKey builds the output key from the CONTENT_KEY_TEMPLATE environment variable, e.g.
+// "{parent}/{slug(title)}-{id}.{ext}". The placeholders are parent, id, title, type, collection and ext,
+// optionally wrapped by slug, safe or lower. Each segment of the key is checked and truncated to
+// CONTENT_KEY_SEGMENT_MAX_BYTES bytes, keeping the extension of the last one. A title which renders empty (e.g. a
+// slug of symbols only) is replaced by the id, so the file name is never only the extension.
+func BuildContentKey(parent, ext string, metadata map[string]string) (string, error) {
+	template := os.Getenv("CONTENT_KEY_TEMPLATE")
+	if template == "" {
+		template = defaultContentKeyTemplate
+	}
+
+	values := map[string]string{
+		"parent":     parent,
+		"id":         strings.TrimSpace(metadata["id"]),
+		"title":      metadata["title"],
+		"type":       metadata["type"],
+		"collection": metadata["collection_name"],
+		"ext":        ext,
+	}
+
+	var renderErr error
+	key := placeholderRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		match := placeholderRegex.FindStringSubmatch(placeholder)
+		fn, name := match[1], match[2]
+
+		value, err := renderPlaceholder(fn, name, values)
+		if err == nil && value == "" && name == "title" {
+			value, err = renderPlaceholder(fn, "id", values)
+			if err == nil && value == "" {
+				err = fmt.Errorf("content key template renders an empty title and id")
+			}
+		}
+		renderErr = errors.Join(renderErr, err)
+		return value
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+
+	return canonicalKey(key, utils.GetEnvInt("CONTENT_KEY_SEGMENT_MAX_BYTES", defaultKeySegmentMaxBytes))
+}
+
+// renderPlaceholder returns the value of the placeholder, with the function applied if not empty.
+func renderPlaceholder(fn, name string, values map[string]string) (string, error) {
+	value, ok := values[name]
+	if !ok {
+		return "", fmt.Errorf("unknown placeholder in content key template: %s", name)
+	}
+
+	if fn == "" {
+		// INFO: The parent comes from the event key, it's already a valid key prefix.
+		if name == "parent" {
+			return value, nil
+		}
+		return utils.StripControlChars(value), nil
+	}
+
+	apply, ok := keyFuncs[fn]
+	if !ok {
+		return "", fmt.Errorf("unknown function in content key template: %s", fn)
+	}
+	return apply(value), nil
+}
+
+// ResolveContentKey checks whether the key, before it's versioned (see VersionedKey), is used by another document
+// and, if so, appends a numeric suffix (-2, -3, ...) to the file name until a free key is found. The owner is the
+// document id metadata of the last version of the key or, if it has none, of the object at the key. Objects without
+// the document id metadata are outputs from before it was stored and are overwritten, as they were.
+func ResolveContentKey(store storage.ObjectStore, bucket, key, documentID string) (string, error) {
+	ext := path.Ext(key)
+	base := strings.TrimSuffix(key, ext)
+	candidate := key
+
+	for attempt := 2; attempt <= maxKeyCollisionAttempts+1; attempt++ {
+		info, err := lastObjectOfKey(store, bucket, candidate)
+		if errors.Is(err, storage.ErrNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to check content key %s: %w", candidate, err)
+		}
+
+		owner, ok := info.Metadata[documentIDMetadataKey]
+		if !ok || owner == strings.TrimSpace(documentID) {
+			return candidate, nil
+		}
+
+		candidate = fmt.Sprintf("%s-%d%s", base, attempt, ext)
+	}
+
+	return "", fmt.Errorf("content key %s collides with other documents after %d attempts", key, maxKeyCollisionAttempts)
+}
+
+// lastObjectOfKey returns the attributes of the last version of the key or, if it has none, of the object at the
+// key. The error wraps storage.ErrNotFound if there is neither.
+func lastObjectOfKey(store storage.ObjectStore, bucket, key string) (storage.ObjectInfo, error) {
+	dir, file := path.Split(key)
+	versionsPrefix := dir + versionsDir + "/"
+	keys, err := storage.ListKeys(store, bucket, versionsPrefix)
+	if err != nil {
+		return storage.ObjectInfo{}, err
+	}
+
+	// INFO: The listing is sorted by key and the version IDs by time, so the last match is the last version.
+	for _, versionKey := range slices.Backward(keys) {
+		versionID, name, ok := strings.Cut(strings.TrimPrefix(versionKey, versionsPrefix), "/")
+		if ok && name == file && versionIDRegex.MatchString(versionID) {
+			return store.HeadObject(bucket, versionKey)
+		}
+	}
+	return store.HeadObject(bucket, key)
+}
+
+// encodeContentKey URL encodes each segment of the key, the format of the keys stored in the database.
+func encodeContentKey(contentKey string) string {
+	segments := strings.Split(contentKey, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalKey validates the segments of the key and truncates them to maxSegmentBytes, keeping the extension.
+func canonicalKey(key string, maxSegmentBytes int) (string, error) {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid content key %q: empty or relative segment", key)
+		}
+
+		if len(segment) > maxSegmentBytes {
+			ext := ""
+			if i == len(segments)-1 {
+				ext = path.Ext(segment)
+			}
+			segment = utils.TruncateBytes(strings.TrimSuffix(segment, ext), maxSegmentBytes-len(ext)) + ext
+		}
+		segments[i] = segment
+	}
+
+	key = strings.Join(segments, "/")
+	if len(key) > maxKeyBytes {
+		return "", fmt.Errorf("content key is longer than %d bytes: %s", maxKeyBytes, key)
+	}
+	return key, nil
+}
+
+// safeKeySegment keeps the value readable but makes it a single valid key segment: the value is normalized (NFC),
+// the characters invalid in file names are replaced, control characters are removed and leading or trailing dots
+// and spaces are trimmed.
+func safeKeySegment(value string) string {
+	value = utils.StripControlChars(converter.NormalizeFilename(norm.NFC.String(value)))
+	return strings.Trim(value, ". ")
+}
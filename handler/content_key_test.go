@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+// putOutput writes an output of the document at the key, with the document id metadata as the upload profile does.
+func putOutput(t *testing.T, store storage.ObjectStore, key, documentID string) {
+	t.Helper()
+	opts := storage.PutOptions{Metadata: map[string]string{"Document-Id": documentID}}
+	if err := store.PutObject("bucket", key, strings.NewReader("output"), opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveContentKey(t *testing.T) {
+	createdAt := time.Date(2025, 6, 29, 22, 19, 58, 0, time.UTC)
+	stores := map[string]func(t *testing.T) storage.ObjectStore{
+		"memory":     func(t *testing.T) storage.ObjectStore { return storage.NewMemoryStore() },
+		"filesystem": func(t *testing.T) storage.ObjectStore { return storage.NewFileSystemStore(t.TempDir()) },
+	}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, store storage.ObjectStore)
+		want  string
+	}{
+		{"free key", func(t *testing.T, store storage.ObjectStore) {}, "doc/Title.m4a"},
+		{"version of the document", func(t *testing.T, store storage.ObjectStore) {
+			putOutput(t, store, VersionedKey("doc/Title.m4a", createdAt), "doc")
+		}, "doc/Title.m4a"},
+		{"version of another document", func(t *testing.T, store storage.ObjectStore) {
+			putOutput(t, store, VersionedKey("doc/Title.m4a", createdAt), "other")
+		}, "doc/Title-2.m4a"},
+		{"last version of another document", func(t *testing.T, store storage.ObjectStore) {
+			putOutput(t, store, VersionedKey("doc/Title.m4a", createdAt), "doc")
+			putOutput(t, store, VersionedKey("doc/Title.m4a", createdAt.Add(time.Second)), "other")
+		}, "doc/Title-2.m4a"},
+		{"version of another file", func(t *testing.T, store storage.ObjectStore) {
+			putOutput(t, store, VersionedKey("doc/Other.m4a", createdAt), "other")
+		}, "doc/Title.m4a"},
+		{"output of another document before the versions", func(t *testing.T, store storage.ObjectStore) {
+			putOutput(t, store, "doc/Title.m4a", "other")
+		}, "doc/Title-2.m4a"},
+		{"output without the document id", func(t *testing.T, store storage.ObjectStore) {
+			if err := store.PutObject("bucket", "doc/Title.m4a", strings.NewReader("output"), storage.PutOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}, "doc/Title.m4a"},
+		{"suffixed keys of other documents", func(t *testing.T, store storage.ObjectStore) {
+			putOutput(t, store, VersionedKey("doc/Title.m4a", createdAt), "other")
+			putOutput(t, store, VersionedKey("doc/Title-2.m4a", createdAt), "another")
+		}, "doc/Title-3.m4a"},
+	}
+	for storeName, newStore := range stores {
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				store := newStore(t)
+				tt.setup(t, store)
+
+				got, err := ResolveContentKey(store, "bucket", "doc/Title.m4a", "doc")
+				if err != nil || got != tt.want {
+					t.Errorf("ResolveContentKey() = %q, %v, want %q", got, err, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestBuildContentKey(t *testing.T) {
+	metadata := func(id, title string) map[string]string {
+		return map[string]string{"id": id, "title": title, "type": "music", "collection_name": "Songs"}
+	}
+	tests := []struct {
+		name     string
+		template string
+		maxBytes string
+		metadata map[string]string
+		want     string
+		wantErr  bool
+	}{
+		{"default template", "", "", metadata("doc", "My Song"), "doc/Title/My Song.m4a", false},
+		{"invalid file name characters", "", "", metadata("doc", "AC/DC: Live?"), "doc/Title/AC_DC_ Live_.m4a", false},
+		{"decomposed title is composed", "", "", metadata("doc", "Cafe\u0301"), "doc/Title/Caf\u00e9.m4a", false},
+		{"control characters and trailing dots", "", "", metadata("doc", "\tLine\nbreak..."), "doc/Title/Linebreak.m4a", false},
+		{"dots only title uses the id", "", "", metadata("doc", "..."), "doc/Title/doc.m4a", false},
+		{"slug", "{parent}/{slug(title)}-{id}.{ext}", "", metadata("doc", "Canção Nº 1"), "doc/Title/cancao-no-1-doc.m4a", false},
+		{"symbols only slug uses the id", "{parent}/{slug(title)}.{ext}", "", metadata("Doc 1", "!!!"), "doc/Title/doc-1.m4a", false},
+		{"empty title and id", "{parent}/{slug(title)}.{ext}", "", metadata(" ", "🎵"), "", true},
+		{"other placeholders", "{lower(collection)}/{type}/{id}.{ext}", "", metadata("doc", "Title"), "songs/music/doc.m4a", false},
+		{"unknown placeholder", "{parent}/{artist}.{ext}", "", metadata("doc", "Title"), "", true},
+		{"unknown function", "{parent}/{upper(title)}.{ext}", "", metadata("doc", "Title"), "", true},
+		{"title with a slash in a raw placeholder", "{parent}/{title}.{ext}", "", metadata("doc", "a/../b"), "", true},
+		{"long title truncated", "", "10", metadata("doc", "A very long title"), "doc/Title/A very.m4a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONTENT_KEY_TEMPLATE", tt.template)
+			t.Setenv("CONTENT_KEY_SEGMENT_MAX_BYTES", tt.maxBytes)
+
+			got, err := BuildContentKey("doc/Title", "m4a", tt.metadata)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("BuildContentKey() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCanonicalKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		maxBytes int
+		want     string
+		wantErr  bool
+	}{
+		{"valid key", "doc/Title/song.m4a", 200, "doc/Title/song.m4a", false},
+		{"last segment keeps the extension", "doc/abcdefghij.m4a", 8, "doc/abcd.m4a", false},
+		{"other segments are cut", "abcdefghij/song.m4a", 8, "abcdefgh/song.m4a", false},
+		{"multibyte characters are not split", "doc/ããããã.m4a", 9, "doc/ãã.m4a", false},
+		{"empty key", "", 200, "", true},
+		{"empty segment", "doc//song.m4a", 200, "", true},
+		{"leading slash", "/doc/song.m4a", 200, "", true},
+		{"dot segment", "doc/./song.m4a", 200, "", true},
+		{"parent segment", "doc/../song.m4a", 200, "", true},
+		{"longer than the S3 limit", strings.Repeat("a/", 512) + "b.m4a", 200, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalKey(tt.key, tt.maxBytes)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("canonicalKey(%q) = %q, %v, want %q, error %v", tt.key, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
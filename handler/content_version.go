@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+const (
+	versionsDir             = "versions"
+	versionIDLayout         = "20060102T150405.000000Z" // Sortable, so the listing order is the version order
+	defaultVersionRetention = 5
+)
+
+// versionIDRegex matches the version IDs, also the ones without fraction of second of the first versions.
+var versionIDRegex = regexp.MustCompile(`^\d{8}T\d{6}(\.\d+)?Z$`)
+
+// VersionedKey returns the key of a version of the content, in the versions directory next to the content key,
+// e.g. "parent/title.m4a" to "parent/versions/20250629T221958.123456Z/title.m4a". The file name is kept for downloads.
+func VersionedKey(contentKey string, createdAt time.Time) string {
+	dir, file := path.Split(contentKey)
+	return path.Join(dir, versionsDir, createdAt.UTC().Format(versionIDLayout), file)
+}
+
+// isVersionedKey reports whether the key is a version of a content of the parent directory, which must be kept for
+// rollbacks: its path under the parent ends with "versions/<version ID>/<file>".
+// INFO: The parent is skipped, it can have a "versions" directory, e.g. "music/versions/<document id>".
+func isVersionedKey(parent, key string) bool {
+	relative, ok := strings.CutPrefix(key, parent+"/")
+	if !ok {
+		return false
+	}
+	segments := strings.Split(relative, "/")
+	n := len(segments)
+	return n >= 3 && segments[n-3] == versionsDir && versionIDRegex.MatchString(segments[n-2]) && segments[n-1] != ""
+}
+
+// PruneVersions removes the oldest versions of the document, keeping the last retention ones.
+// The objects are deleted from the store and their entries are removed from the document.
+func PruneVersions(store storage.ObjectStore, repo database.ContentRepository, bucket, collectionName, id string, retention int) error {
+	if retention < 1 {
+		retention = 1 // The current version is never pruned
+	}
+
+	last, err := repo.FindLastConversion(collectionName, id)
+	if err != nil {
+		return err
+	}
+
+	if len(last.Versions) <= retention {
+		return nil
+	}
+
+	pruned := last.Versions[:len(last.Versions)-retention]
+	prunedKeys := make([]string, 0, len(pruned))
+	for _, version := range pruned {
+		key, err := url.PathUnescape(version.Key)
+		if err != nil {
+			return fmt.Errorf("invalid version key %s: %w", version.Key, err)
+		}
+		if err := store.DeleteObject(bucket, key); err != nil {
+			return fmt.Errorf("failed to delete version %s: %w", key, err)
+		}
+		prunedKeys = append(prunedKeys, version.Key)
+	}
+
+	if err := repo.RemoveVersions(collectionName, id, prunedKeys); err != nil {
+		return fmt.Errorf("failed to remove pruned versions from document with ID %s: %w", id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+// CachedConversion is an entry of the conversion cache: the output of a source converted with a preset.
+type CachedConversion struct {
+	database.CachedConversion
+}
+
+// conversionCacheEnabled reports whether the conversion cache is enabled, by the CONVERSION_CACHE_COLLECTION
+// environment variable (the collection or table of the entries).
+func conversionCacheEnabled() bool {
+	return os.Getenv("CONVERSION_CACHE_COLLECTION") != ""
+}
+
+// conversionCacheID returns the key of the cache entry of a source converted with the current preset.
+func conversionCacheID(sourceSHA256 string) string {
+	return sourceSHA256 + ":" + converter.Preset()
+}
+
+// FindCachedConversion returns the cached output of an identical source converted with the current preset,
+// nil if there is none or if the cache is disabled. Entries whose output was removed or replaced (e.g. a pruned
+// version) are stale, they are deleted and nil is returned.
+func FindCachedConversion(store storage.ObjectStore, repo database.CacheRepository, sourceSHA256 string) (*CachedConversion, error) {
+	if !conversionCacheEnabled() {
+		return nil, nil
+	}
+
+	entry, err := repo.FindCachedConversion(conversionCacheID(sourceSHA256))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cached := &CachedConversion{entry}
+
+	info, err := store.HeadObject(cached.Bucket, cached.Key)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if errors.Is(err, storage.ErrNotFound) || cached.verify(info) != nil {
+		return nil, repo.DeleteCachedConversion(cached.ID)
+	}
+
+	return cached, nil
+}
+
+// StoreCachedConversion adds the output of a conversion to the cache, replacing the previous entry of the source.
+// It does nothing if the cache is disabled.
+func StoreCachedConversion(repo database.CacheRepository, cached database.CachedConversion) error {
+	if !conversionCacheEnabled() {
+		return nil
+	}
+	return repo.SaveCachedConversion(cached)
+}
+
+// CanCopy reports whether the cached output can be copied as is: it has the same tags and it's in the same bucket,
+// as the cache is shared by all collections. Otherwise only its audio is reused.
+func (c *CachedConversion) CanCopy(bucket, tagsChecksum string) bool {
+	return c.Bucket == bucket && c.TagsChecksum == tagsChecksum
+}
+
+// CopyCachedConversion copies the cached output to the key server-side, with the attributes of the options.
+// The copy is checked against the checksum of the cached output. Returns the checksum of the copy.
+func CopyCachedConversion(store storage.ObjectStore, cached *CachedConversion, bucket, key string, opts storage.PutOptions) (storage.Checksum, error) {
+	sum, err := hex.DecodeString(cached.OutputChecksum)
+	if err != nil {
+		return storage.Checksum{}, fmt.Errorf("invalid checksum of cached conversion %s: %w", cached.ID, err)
+	}
+	checksum := storage.Checksum{SHA256: sum}
+
+	opts.ChecksumSHA256 = sum
+	if err := store.CopyObject(bucket, cached.Key, key, opts); err != nil {
+		return checksum, err
+	}
+
+	info, err := store.HeadObject(bucket, key)
+	if err == nil {
+		err = cached.verify(info)
+	}
+	if err != nil {
+		if deleteErr := store.DeleteObject(bucket, key); deleteErr != nil {
+			err = errors.Join(err, deleteErr)
+		}
+		return checksum, fmt.Errorf("failed to verify copy of cached conversion %s: %w", cached.ID, err)
+	}
+
+	return checksum, nil
+}
+
+// verify compares the full object SHA-256 checksum of the object with the one of the cached output,
+// if the object has one. The ETag can't be compared, the MD5 of the output is not cached.
+func (c *CachedConversion) verify(info storage.ObjectInfo) error {
+	sum, err := hex.DecodeString(c.OutputChecksum)
+	if err != nil {
+		return fmt.Errorf("invalid checksum of cached conversion %s: %w", c.ID, err)
+	}
+	if info.ChecksumSHA256 == "" || strings.Contains(info.ChecksumSHA256, "-") {
+		return nil
+	}
+
+	expected := storage.Checksum{SHA256: sum}.SHA256Base64()
+	if info.ChecksumSHA256 != expected {
+		return fmt.Errorf("%w: object %s has SHA-256 %s, cached %s", storage.ErrChecksumMismatch, info.Key, info.ChecksumSHA256, expected)
+	}
+	return nil
+}
+
+// TagsChecksum returns the SHA-256 (hex) of what is written to the output besides the audio: the metadata
+// (except the id and collection, which are not written), the cover and the lyrics. Two outputs of the same
+// source and preset with the same tags checksum are the same file.
+func TagsChecksum(metadata map[string]string, checksums map[string]storage.Checksum) string {
+	h := sha256.New()
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		if key != "id" && key != "collection_name" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%s\n", key, metadata[key])
+	}
+
+	for _, fileName := range []string{"thumbnail", "lyrics", "synced_lyrics"} {
+		if checksum, ok := checksums[fileName]; ok {
+			fmt.Fprintf(h, "%s:%s\n", fileName, checksum.SHA256Hex())
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
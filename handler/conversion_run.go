@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+// ConversionRun is the conversion of a document by an invocation, identified by a random run ID.
+// INFO: The status transitions of a run are conditional, so a retry which was taken over by a newer run
+// (e.g. after a timeout) can't overwrite its result.
+type ConversionRun struct {
+	ID             string
+	CollectionName string
+	DocumentID     string
+	repo           database.ContentRepository
+	finished       bool
+	failure        *database.ConversionFailure
+	command        []string           // Last FFmpeg command, for the debug bundle
+	debug          *debugBundleTarget // nil if the debug bundle is not written
+}
+
+// StartConversionRun sets PROCESSING on the document with a new run ID, taking over any previous run unless it was
+// started by a newer S3 event, the sequencer of the event file.
+func StartConversionRun(repo database.ContentRepository, collectionName, id, sequencer string) (*ConversionRun, error) {
+	runID := make([]byte, 16)
+	if _, err := rand.Read(runID); err != nil {
+		return nil, fmt.Errorf("failed to generate run ID: %w", err)
+	}
+
+	run := &ConversionRun{ID: hex.EncodeToString(runID), CollectionName: collectionName, DocumentID: id, repo: repo}
+	if err := repo.StartConversion(collectionName, id, run.ID, sequencer); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Transition sets the status on the document, the error wraps database.ErrTransitionRejected if the run was
+// taken over, the run is then finished.
+func (r *ConversionRun) Transition(to database.ConversionStatus) error {
+	err := r.repo.TransitionStatus(r.CollectionName, r.DocumentID, r.ID, to)
+	if errors.Is(err, database.ErrTransitionRejected) {
+		r.finished = true
+	}
+	return err
+}
+
+// Finish marks the run as finished, its final status was set on the document.
+func (r *ConversionRun) Finish() {
+	r.finished = true
+}
+
+// Cancel sets CANCELLED on the document, the run is then finished.
+func (r *ConversionRun) Cancel() error {
+	r.finished = true
+	return r.repo.CancelConversion(r.CollectionName, r.DocumentID, r.ID)
+}
+
+// EnableDebugBundle writes a debug bundle when the run fails, with the inputs and the metadata of the job,
+// unless DEBUG_BUNDLE_PREFIX is set to empty.
+func (r *ConversionRun) EnableDebugBundle(store storage.ObjectStore, bucket string, filesPaths, metadata map[string]string) {
+	if _, ok := debugBundlePrefix(); !ok {
+		return
+	}
+	r.debug = &debugBundleTarget{store: store, bucket: bucket, filesPaths: filesPaths, metadata: metadata}
+}
+
+// SetFailure records the error as the cause of the failure, classified if it's an FFmpeg error, and the
+// FFmpeg command of the details (if not nil). It's stored on the document by FailIfUnfinished.
+func (r *ConversionRun) SetFailure(err error, details *converter.FFmpegProgressDetails) {
+	code, stderr := converter.ErrorDetails(err)
+	r.failure = &database.ConversionFailure{
+		Code:      string(code),
+		Message:   err.Error(),
+		Stderr:    stderr,
+		Retryable: code.Retryable(),
+		At:        time.Now(),
+	}
+	if details != nil {
+		r.command = details.Command
+	}
+}
+
+// FailIfUnfinished sets FAILED and the failure on the document if the run was not finished, with the key of the
+// debug bundle if it's enabled. To be deferred after the start.
+func (r *ConversionRun) FailIfUnfinished() {
+	if r.finished {
+		return
+	}
+	r.finished = true
+
+	failure := database.ConversionFailure{
+		Code:      string(converter.ErrCodeUnknown),
+		Message:   "conversion stopped before the end",
+		Retryable: true,
+		At:        time.Now(),
+	}
+	if r.failure != nil {
+		failure = *r.failure
+	}
+
+	if r.debug != nil {
+		prefix, _ := debugBundlePrefix()
+		key, err := WriteDebugBundle(r.debug.store, r.debug.bucket, prefix, newDebugBundle(r, failure, r.debug))
+		if err != nil {
+			slog.Warn("failed to write debug bundle", "run", r.ID, "err", err)
+		} else {
+			slog.Info("Debug bundle written", "run", r.ID, "key", key)
+			failure.DebugBundleKey = key
+		}
+	}
+
+	if err := r.repo.FailConversion(r.CollectionName, r.DocumentID, r.ID, failure); err != nil {
+		slog.Warn("failed to set conversion status", "status", database.StatusFailed, "run", r.ID, "err", err)
+	}
+}
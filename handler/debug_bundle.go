@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+const (
+	defaultDebugBundlePrefix = "debug/"
+	redactedValue            = "[REDACTED]"
+)
+
+// probedInputs are the inputs of FFmpeg described by ffprobe in the debug bundle.
+var probedInputs = []string{"content", "thumbnail"}
+
+// configEnvKeys are the environment variables of the converter written to the debug bundle.
+var configEnvKeys = []string{
+	"AUDIO_CODEC", "AUDIO_CONTENT_TYPE", "AUDIO_FORMAT", "CONTENT_KEY_SEGMENT_MAX_BYTES", "CONTENT_KEY_TEMPLATE",
+	"CONTENT_SUFFIX", "CONVERSION_CACHE_COLLECTION", "DATABASE_BACKEND", "DATABASE_URL", "DEBUG_BUNDLE_BUCKET",
+	"DEBUG_BUNDLE_PREFIX", "FFMPEG_BIN_PATH", "FFPROBE_BIN_PATH", "LYRICS_SUFFIX", "MONGO_DB", "MONGO_URI",
+	"PRESIGNED_GET_EXPIRY_MINUTES", "PROGRESS_REPORT_INTERVAL_SECONDS", "PROGRESS_REPORT_STEP_PERCENT",
+	"STORAGE_BACKEND", "STORAGE_ROOT", "STREAMING_MODE", "SYNCED_LYRICS_SUFFIX", "THUMBNAIL_SUFFIX",
+	"UPLOAD_PROFILES", "VERSION_RETENTION", "WORK_DIR",
+}
+
+// DebugBundle holds what is needed to reproduce a failed conversion locally.
+type DebugBundle struct {
+	RunID          string                     `json:"run_id"`
+	CollectionName string                     `json:"collection_name"`
+	DocumentID     string                     `json:"document_id"`
+	CreatedAt      time.Time                  `json:"created_at"`
+	ErrorCode      string                     `json:"error_code"`
+	Error          string                     `json:"error"`
+	Stderr         []string                   `json:"stderr,omitempty"`
+	Command        []string                   `json:"command,omitempty"` // Empty if the failure was before FFmpeg
+	FFmpegVersion  string                     `json:"ffmpeg_version,omitempty"`
+	Probes         map[string]json.RawMessage `json:"probes,omitempty"`
+	ProbeErrors    map[string]string          `json:"probe_errors,omitempty"`
+	Metadata       map[string]string          `json:"metadata"`
+	Config         map[string]string          `json:"config"` // Secrets are redacted
+}
+
+// debugBundleTarget holds where the debug bundle of a run is written and the inputs it describes.
+type debugBundleTarget struct {
+	store      storage.ObjectStore
+	bucket     string
+	filesPaths map[string]string
+	metadata   map[string]string
+}
+
+// debugBundlePrefix returns the prefix of the debug bundles (DEBUG_BUNDLE_PREFIX), false if it's set to empty.
+func debugBundlePrefix() (string, bool) {
+	prefix, ok := os.LookupEnv("DEBUG_BUNDLE_PREFIX")
+	if !ok {
+		return defaultDebugBundlePrefix, true
+	}
+	return prefix, prefix != ""
+}
+
+// newDebugBundle collects the debug bundle of the failed run, the inputs are probed if they were downloaded.
+func newDebugBundle(run *ConversionRun, failure database.ConversionFailure, target *debugBundleTarget) DebugBundle {
+	bundle := DebugBundle{
+		RunID:          run.ID,
+		CollectionName: run.CollectionName,
+		DocumentID:     run.DocumentID,
+		CreatedAt:      failure.At,
+		ErrorCode:      failure.Code,
+		Error:          failure.Message,
+		Stderr:         failure.Stderr,
+		Command:        run.command,
+		Metadata:       target.metadata,
+		Config:         debugConfig(),
+	}
+
+	if version, err := converter.FFmpegVersion(); err == nil {
+		bundle.FFmpegVersion = version
+	}
+
+	for _, name := range probedInputs {
+		filePath := target.filesPaths[name]
+		if filePath == "" {
+			continue
+		}
+		probe, err := converter.ProbeJSON(filePath)
+		if err != nil {
+			if bundle.ProbeErrors == nil {
+				bundle.ProbeErrors = make(map[string]string)
+			}
+			bundle.ProbeErrors[name] = err.Error()
+			continue
+		}
+		if bundle.Probes == nil {
+			bundle.Probes = make(map[string]json.RawMessage)
+		}
+		bundle.Probes[name] = probe
+	}
+
+	return bundle
+}
+
+// WriteDebugBundle writes the bundle as JSON to <prefix><collection>/<id>/<run id>.json, in DEBUG_BUNDLE_BUCKET or
+// the given bucket. Returns the key of the bundle.
+// NOTE: The prefix must be excluded from the event notifications of the bucket.
+func WriteDebugBundle(store storage.ObjectStore, bucket, prefix string, bundle DebugBundle) (string, error) {
+	if debugBucket := os.Getenv("DEBUG_BUNDLE_BUCKET"); debugBucket != "" {
+		bucket = debugBucket
+	}
+
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding debug bundle: %w", err)
+	}
+
+	key := prefix + path.Join(bundle.CollectionName, bundle.DocumentID, bundle.RunID+".json")
+	opts := storage.PutOptions{ContentType: "application/json"}
+	if err := store.PutObject(bucket, key, bytes.NewReader(data), opts); err != nil {
+		return "", fmt.Errorf("error writing debug bundle %s/%s: %w", bucket, key, err)
+	}
+	return key, nil
+}
+
+// debugConfig returns the configuration of the converter from the environment, with the secrets redacted.
+func debugConfig() map[string]string {
+	config := make(map[string]string)
+	for _, key := range configEnvKeys {
+		if value, ok := os.LookupEnv(key); ok {
+			config[key] = redactConfigValue(key, value)
+		}
+	}
+	return config
+}
+
+// redactConfigValue hides the passwords of connection URLs and the values of secret variables.
+func redactConfigValue(key, value string) string {
+	for _, secret := range []string{"SECRET", "TOKEN", "PASSWORD"} {
+		if strings.Contains(key, secret) {
+			return redactedValue
+		}
+	}
+
+	// INFO: The DSNs of the databases (MONGO_URI, DATABASE_URL) may have credentials in the user info.
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	if strings.Contains(value, "password=") {
+		return redactedValue // Key/value DSN, e.g. "host=... password=..."
+	}
+	return value
+}
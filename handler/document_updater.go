@@ -1,11 +1,8 @@
 package handler
 
 import (
-	"context"
-	"fmt"
-	"strings"
-
-	"go.mongodb.org/mongo-driver/v2/bson"
+	"pitanguinha.com/audio-converter/internal/analysis"
+	"pitanguinha.com/audio-converter/internal/converter"
 	"pitanguinha.com/audio-converter/internal/database"
 	"pitanguinha.com/audio-converter/internal/utils"
 )
@@ -15,66 +12,44 @@ type UpdateDocumentInput struct {
 	ID             string
 	CollectionName string
 	ContentKey     string
+	LyricsKey      string // Key of the synced lyrics sidecar, empty if the job has no synced lyrics.
 	Duration       float64
-	Status         Status
+	ReplayGain     *converter.ReplayGain    // Loudness of the track, nil if it was not measured.
+	Loudness       *analysis.Loudness       // BS.1770 loudness of the content, nil if it was not measured.
+	MusicAnalysis  *analysis.MusicAnalysis  // Tempo and key of a music, nil if they were not estimated.
+	SourceChecksum string                   // SHA-256 (hex) of the source content
+	OutputChecksum string                   // SHA-256 (hex) of the converted content
+	Version        *database.ContentVersion // Appended to the versions of the document, nil to keep them as is.
+	PresignedURLs  *database.PresignedURLs  // Presigned GET URLs of the outputs, nil if they are not generated.
+	RunID          string                   // ID of the conversion run, see ConversionRun
+	Status         database.ConversionStatus
 }
 
-// Status represents the status of a document update operation.
-type Status uint8
-
-const (
-	Success Status = iota
-	Failure
-)
-
-// SetStatus converts a boolean value to a Status type.
-func SetStatus(isSuccess bool) Status {
+// SetStatus converts a boolean value to the final status of a conversion.
+func SetStatus(isSuccess bool) database.ConversionStatus {
 	if isSuccess {
-		return Success
+		return database.StatusSuccess
 	}
-	return Failure
+	return database.StatusFailed
 }
 
-// UpdateDocument updates the status of a document in the specified collection.
-func (doc *UpdateDocumentInput) UpdateDocument() error {
-	db, err := database.GetDatabase()
-	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
-	}
-
-	collection := db.Collection(doc.CollectionName)
-
-	var setFields any
+// UpdateDocument sets the final status of the conversion run on a document in the specified collection.
+func (doc *UpdateDocumentInput) UpdateDocument(repo database.ContentRepository) error {
 	switch doc.Status {
-	case Success:
-		setFields = map[string]any{
-			"conversion_status": "SUCCESS",
-			"content_key":       doc.ContentKey,
-			"duration":          utils.FormatSecondsToTime(doc.Duration),
-		}
-	case Failure:
-		setFields = map[string]any{
-			"conversion_status": "ERROR",
-		}
-	}
-
-	updateBson := bson.M{
-		"$set": setFields,
-	}
-
-	id, err := bson.ObjectIDFromHex(strings.TrimSpace(doc.ID))
-	if err != nil {
-		return fmt.Errorf("invalid ID format: %w", err)
-	}
-
-	result, err := collection.UpdateByID(context.TODO(), id, updateBson)
-	if err != nil {
-		return fmt.Errorf("failed to update document with ID %s: %w", id, err)
-	}
-
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("no document found with ID %s", id)
+	case database.StatusSuccess:
+		return repo.SaveConversion(doc.CollectionName, doc.ID, doc.RunID, database.ConversionResult{
+			ContentKey:     doc.ContentKey,
+			LyricsKey:      doc.LyricsKey,
+			Duration:       utils.FormatSecondsToTime(doc.Duration),
+			ReplayGain:     newStoredReplayGain(doc.ReplayGain),
+			Loudness:       newStoredLoudness(doc.Loudness),
+			MusicAnalysis:  newStoredMusicAnalysis(doc.MusicAnalysis),
+			SourceChecksum: doc.SourceChecksum,
+			OutputChecksum: doc.OutputChecksum,
+			Version:        doc.Version,
+			PresignedURLs:  doc.PresignedURLs,
+		})
+	default:
+		return repo.TransitionStatus(doc.CollectionName, doc.ID, doc.RunID, doc.Status)
 	}
-
-	return nil
 }
@@ -7,10 +7,12 @@ import (
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
-	"pitanguinha.com/audio-converter/internal/s3"
+	"pitanguinha.com/audio-converter/internal/storage"
 	"pitanguinha.com/audio-converter/internal/utils"
 )
 
+const syncedLyricsExt = ".lrc"
+
 // EventParsed holds the parsed information from an S3 event.
 type EventParsed struct {
 	Bucket         string `json:"bucket.name"`
@@ -20,7 +22,7 @@ type EventParsed struct {
 }
 
 // ParseEvent parses the S3 event and retrieves the bucket name, event file key, and other files in the same directory.
-func ParseEvent(s3Service *s3.S3Service, event events.S3Event) (EventParsed, error) {
+func ParseEvent(store storage.ObjectStore, event events.S3Event) (EventParsed, error) {
 	var eventParsed EventParsed
 
 	eventParsed.Bucket = event.Records[0].S3.Bucket.Name
@@ -34,26 +36,39 @@ func ParseEvent(s3Service *s3.S3Service, event events.S3Event) (EventParsed, err
 	dir := utils.GetParentDir(decodeKey)
 	eventParsed.ParentDirKey = dir
 
-	if err := eventParsed.loadAdditionalFileKeys(s3Service, dir); err != nil {
+	if err := eventParsed.loadAdditionalFileKeys(store, dir); err != nil {
 		return eventParsed, fmt.Errorf("error loading additional file keys: %w", err)
 	}
 
 	return eventParsed, nil
 }
 
+// DocumentID returns the id of the document of the job files, the first segment of the event file key.
+// Returns an empty string if the key has a single segment.
+func (e EventParsed) DocumentID() string {
+	documentID, _, ok := strings.Cut(e.EventFileKey, "/")
+	if !ok {
+		return ""
+	}
+	return documentID
+}
+
 // loadAdditionalFileKeys retrieves the paths of other files in the same directory as the event file.
-func (e *EventParsed) loadAdditionalFileKeys(s3Service *s3.S3Service, dir string) error {
-	keys, err := s3Service.ListObjectsForPrefix(e.Bucket, dir) // NOTE: Expect: Event file, thumbnail file and one or two content files.
+func (e *EventParsed) loadAdditionalFileKeys(store storage.ObjectStore, dir string) error {
+	keys, err := storage.ListKeys(store, e.Bucket, dir) // NOTE: Expect: Event file, thumbnail file and one or two content files.
 	if err != nil {
 		return err
 	}
 
 	// INFO: On creation, we have 3 files (event file, content file and thumbnail file).
 	// On update, we have 3 (same the creation) or 4 files (same the creation + content file wich will replace the old one).
+	// Lyrics files are optional: a plain lyrics file and/or a synced .lrc file.
 	ContentSuffix := os.Getenv("CONTENT_SUFFIX")
 	ThumbnailSuffix := os.Getenv("THUMBNAIL_SUFFIX")
+	LyricsSuffix := os.Getenv("LYRICS_SUFFIX")
+	SyncedLyricsSuffix := os.Getenv("SYNCED_LYRICS_SUFFIX")
 	e.OthersFilesKey = make(map[string]string)
-	var contentWithoutSuffix string
+	var contentWithoutSuffix, latestVersion string
 
 	for _, key := range keys {
 		// Skip the event file itself and the content file if it has a specific suffix.
@@ -64,6 +79,28 @@ func (e *EventParsed) loadAdditionalFileKeys(s3Service *s3.S3Service, dir string
 		// Remove the spaces from the key
 		key = strings.TrimSpace(key)
 
+		// INFO: The listing is sorted by key and the version directories by time, so the last one is the latest.
+		// It's only the content when no new content was uploaded, e.g. on a metadata update.
+		if isVersionedKey(e.ParentDirKey, key) {
+			latestVersion = key
+			continue
+		}
+
+		if SyncedLyricsSuffix != "" && strings.HasSuffix(key, SyncedLyricsSuffix) {
+			e.OthersFilesKey["synced_lyrics"] = key
+			continue
+		}
+
+		if LyricsSuffix != "" && strings.HasSuffix(key, LyricsSuffix) {
+			e.OthersFilesKey["lyrics"] = key
+			continue
+		}
+
+		// Skip the synced lyrics sidecar of a previous conversion, it will be replaced.
+		if strings.HasSuffix(key, syncedLyricsExt) {
+			continue
+		}
+
 		if strings.HasSuffix(key, ThumbnailSuffix) {
 			e.OthersFilesKey["thumbnail"] = key
 			continue
@@ -81,5 +118,9 @@ func (e *EventParsed) loadAdditionalFileKeys(s3Service *s3.S3Service, dir string
 		e.OthersFilesKey["content"] = contentWithoutSuffix
 	}
 
+	if _, ok := e.OthersFilesKey["content"]; !ok && latestVersion != "" {
+		e.OthersFilesKey["content"] = latestVersion
+	}
+
 	return nil
 }
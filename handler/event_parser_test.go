@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateDocumentID(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		id      string
+		wantDoc string
+		wantErr bool
+	}{
+		{"same document", "doc/Title/metadata.json", "doc", "doc", false},
+		{"job files at the document root", "doc/metadata.json", "doc", "doc", false},
+		{"other document", "doc/Title/metadata.json", "other", "doc", true},
+		{"id of a sub directory", "doc/Title/metadata.json", "doc/Title", "doc", true},
+		{"id with spaces", "doc/Title/metadata.json", " doc", "doc", true},
+		{"missing id", "doc/Title/metadata.json", "", "doc", true},
+		{"key without a document", "metadata.json", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventParsed := EventParsed{EventFileKey: tt.key}
+			if got := eventParsed.DocumentID(); got != tt.wantDoc {
+				t.Errorf("DocumentID() = %q, want %q", got, tt.wantDoc)
+			}
+
+			err := ValidateDocumentID(eventParsed, map[string]string{"id": tt.id})
+			var validationErr *ValidationError
+			if (err != nil) != tt.wantErr || (err != nil && (!errors.As(err, &validationErr) || validationErr.ErrorCode().Retryable())) {
+				t.Errorf("ValidateDocumentID() = %v, want a not retryable validation error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
 
 	"pitanguinha.com/audio-converter/internal/converter"
 	"pitanguinha.com/audio-converter/internal/converter/music"
@@ -10,27 +12,50 @@ import (
 )
 
 // ProcessAudioFile processes the files based on their type (music or podcast) and executes the FFmpeg command.
+// If remux is true, the content is the output of the last conversion and the audio is copied instead of re-encoded.
+// onProgress (if not nil) is called with the progress of FFmpeg, which is killed if the context is cancelled.
 // Returns the details of the conversion process and any error encountered during the process.
-func ProcessAudioFile(duration float64, filesPaths, metadataMap map[string]string) (*converter.FFmpegProgressDetails, error) {
-	cmd, err := buildFFmpegCommand(filesPaths, metadataMap)
+func ProcessAudioFile(ctx context.Context, duration float64, filesPaths, metadataMap map[string]string, remux bool, onProgress converter.ProgressFunc) (*converter.FFmpegProgressDetails, error) {
+	cmd, err := buildFFmpegCommand(filesPaths, metadataMap, remux)
 	if err != nil {
 		return nil, fmt.Errorf("error building ffmpeg command: %w", err)
 	}
 
 	log.Println("FFmpeg command:", cmd)
 
-	return converter.FFmpegExecutor(cmd, duration)
+	return converter.FFmpegExecutor(ctx, cmd, duration, onProgress)
+}
+
+// ApplyReplayGain measures the loudness of the processed file and writes the gain tags that fit the output container.
+// A previous measure of the same audio (remux) is reused instead of measuring it again.
+// Returns the measured values, so they can be stored in the database.
+func ApplyReplayGain(filePath string, previous *converter.ReplayGain) (*converter.ReplayGain, error) {
+	replayGain := previous
+	if replayGain == nil {
+		var err error
+		replayGain, err = converter.MeasureReplayGain(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("error measuring loudness: %w", err)
+		}
+	}
+
+	audioFormat := os.Getenv("AUDIO_FORMAT")
+	if err := converter.WriteTags(filePath, audioFormat, replayGain.Tags(audioFormat)); err != nil {
+		return replayGain, fmt.Errorf("error writing replay gain tags: %w", err)
+	}
+
+	return replayGain, nil
 }
 
 // buildFFmpegCommand constructs the FFmpeg command based on the type of media (music or podcast).
-func buildFFmpegCommand(filesPaths, metadataMap map[string]string) ([]string, error) {
+func buildFFmpegCommand(filesPaths, metadataMap map[string]string, copyAudio bool) ([]string, error) {
 	var cmd []string
 	var err error
 	switch metadataMap["type"] {
 	case "music":
-		cmd, err = music.BuildCommand(filesPaths, metadataMap)
+		cmd, err = music.BuildCommand(filesPaths, metadataMap, copyAudio)
 	case "podcast":
-		cmd, err = podcast.BuildCommand(filesPaths, metadataMap)
+		cmd, err = podcast.BuildCommand(filesPaths, metadataMap, copyAudio)
 	}
 
 	if err != nil {
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/media"
+	"pitanguinha.com/audio-converter/internal/storage"
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+const (
+	defaultInputMaxSizeMB        = 1024
+	defaultInputMinDuration      = 1        // seconds
+	defaultInputMaxDuration      = 4 * 3600 // seconds
+	defaultThumbnailMinDimension = 100      // pixels
+	defaultInputAllowedFormats   = "mp3,aac,mp4,flac,wav,aiff,ogg,webm"
+)
+
+// InputLimits are the guardrails checked on the job files before the conversion.
+type InputLimits struct {
+	MaxSize               int64    // Bytes
+	MinDuration           float64  // Seconds
+	MaxDuration           float64  // Seconds, 0 for no limit
+	Formats               []string // Containers detected by their magic bytes, see media.Format
+	Codecs                []string // Audio codecs as reported by ffprobe, empty to accept any
+	ThumbnailMinDimension int      // Minimum width and height of the thumbnail in pixels
+}
+
+// LoadInputLimits reads the InputLimits from INPUT_MAX_SIZE_MB, INPUT_MIN_DURATION_SECONDS,
+// INPUT_MAX_DURATION_SECONDS, INPUT_ALLOWED_FORMATS, INPUT_ALLOWED_CODECS and THUMBNAIL_MIN_DIMENSION.
+func LoadInputLimits() InputLimits {
+	formats := os.Getenv("INPUT_ALLOWED_FORMATS")
+	if formats == "" {
+		formats = defaultInputAllowedFormats
+	}
+
+	return InputLimits{
+		MaxSize:               int64(utils.GetEnvInt("INPUT_MAX_SIZE_MB", defaultInputMaxSizeMB)) << 20,
+		MinDuration:           float64(utils.GetEnvInt("INPUT_MIN_DURATION_SECONDS", defaultInputMinDuration)),
+		MaxDuration:           float64(utils.GetEnvInt("INPUT_MAX_DURATION_SECONDS", defaultInputMaxDuration)),
+		Formats:               splitList(formats),
+		Codecs:                splitList(os.Getenv("INPUT_ALLOWED_CODECS")),
+		ThumbnailMinDimension: utils.GetEnvInt("THUMBNAIL_MIN_DIMENSION", defaultThumbnailMinDimension),
+	}
+}
+
+// ValidationError lists the guardrails violated by the job files. The job fails without running FFmpeg and is not
+// retryable, the files must be uploaded again.
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid input: " + strings.Join(e.Violations, "; ")
+}
+
+func (e *ValidationError) ErrorCode() converter.ErrorCode {
+	return converter.ErrCodeInvalidInput
+}
+
+// ValidateInputs checks the downloaded content (skipped if it's not downloaded, see ValidateStreamSource)
+// and the thumbnail against the limits. The error is a *ValidationError if a limit is violated.
+func ValidateInputs(filesPaths map[string]string, limits InputLimits) error {
+	var violations []string
+
+	if contentPath := filesPaths["content"]; contentPath != "" {
+		contentViolations, err := validateContent(contentPath, limits)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, contentViolations...)
+	}
+
+	if thumbnailPath := filesPaths["thumbnail"]; thumbnailPath != "" {
+		violations = append(violations, validateThumbnail(thumbnailPath, limits)...)
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// ValidateDocumentID checks that the id of the metadata is the document of the job files (see EventParsed.DocumentID),
+// so a job can't convert or update another document. The error is a *ValidationError if they differ.
+func ValidateDocumentID(eventParsed EventParsed, metadata map[string]string) error {
+	if documentID := eventParsed.DocumentID(); metadata["id"] != documentID {
+		return &ValidationError{Violations: []string{
+			fmt.Sprintf("metadata id %q is not the document %q of the job files", metadata["id"], documentID),
+		}}
+	}
+	return nil
+}
+
+// ValidateStreamSource checks the size, the format and the duration (see StreamSourceDuration) of the content read on
+// streaming mode, from its attributes and first bytes. The codec is not known before the conversion.
+func ValidateStreamSource(store storage.ObjectStore, bucket, key string, duration float64, limits InputLimits) error {
+	info, err := store.HeadObject(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	body, err := store.GetObject(bucket, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	format, err := media.DetectReaderFormat(body)
+	if err != nil {
+		return fmt.Errorf("error reading content header: %w", err)
+	}
+
+	violations := append(checkSizeAndFormat(info.Size, format, limits), checkDuration(duration, limits)...)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// validateContent returns the violations of the content, the error is returned if it can't be checked.
+func validateContent(contentPath string, limits InputLimits) ([]string, error) {
+	stat, err := os.Stat(contentPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading content: %w", err)
+	}
+	format, err := media.DetectFileFormat(contentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	violations := checkSizeAndFormat(stat.Size(), format, limits)
+	if len(violations) > 0 {
+		return violations, nil // Not a media file, or too large to probe
+	}
+
+	info, err := converter.Probe(contentPath)
+	if err != nil {
+		return nil, fmt.Errorf("error probing content: %w", err)
+	}
+
+	audio, ok := info.AudioStream()
+	if !ok {
+		return append(violations, "content has no audio stream"), nil
+	}
+	if len(limits.Codecs) > 0 && !slices.Contains(limits.Codecs, audio.Codec) {
+		violations = append(violations, fmt.Sprintf("audio codec %s is not allowed", audio.Codec))
+	}
+	return append(violations, checkDuration(info.Duration, limits)...), nil
+}
+
+// checkDuration returns the violations of the duration of the content.
+func checkDuration(duration float64, limits InputLimits) []string {
+	var violations []string
+	if duration < limits.MinDuration {
+		violations = append(violations, fmt.Sprintf("duration %.2fs is shorter than %.0fs", duration, limits.MinDuration))
+	}
+	if limits.MaxDuration > 0 && duration > limits.MaxDuration {
+		violations = append(violations, fmt.Sprintf("duration %.2fs is longer than %.0fs", duration, limits.MaxDuration))
+	}
+	return violations
+}
+
+// checkSizeAndFormat returns the violations of the size and the detected format of the content.
+func checkSizeAndFormat(size int64, format media.Format, limits InputLimits) []string {
+	var violations []string
+	if limits.MaxSize > 0 && size > limits.MaxSize {
+		violations = append(violations, fmt.Sprintf("content size %d bytes is larger than %d bytes", size, limits.MaxSize))
+	}
+	switch {
+	case format == media.FormatUnknown:
+		violations = append(violations, "content format is not recognized")
+	case !slices.Contains(limits.Formats, string(format)):
+		violations = append(violations, fmt.Sprintf("content format %s is not allowed", format))
+	}
+	return violations
+}
+
+// validateThumbnail returns the violations of the thumbnail, which must be an image with the minimum dimensions.
+func validateThumbnail(thumbnailPath string, limits InputLimits) []string {
+	info, err := media.ReadImageInfo(thumbnailPath)
+	if err != nil {
+		return []string{fmt.Sprintf("thumbnail is not a valid image: %v", err)}
+	}
+
+	minDimension := limits.ThumbnailMinDimension
+	if info.Width < minDimension || info.Height < minDimension {
+		return []string{fmt.Sprintf("thumbnail is %dx%d, smaller than %dx%d", info.Width, info.Height, minDimension, minDimension)}
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, trimming and lowercasing the items and skipping the empty ones.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
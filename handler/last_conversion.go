@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+// LastConversion holds the fields of a document about its last successful conversion.
+type LastConversion struct {
+	database.LastConversion
+}
+
+// FindLastConversion returns the last conversion of the document, nil if it was never converted.
+func FindLastConversion(repo database.ContentRepository, collectionName, id string) (*LastConversion, error) {
+	last, err := repo.FindLastConversion(collectionName, id)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if last.OutputChecksum == "" || len(last.Versions) == 0 {
+		return nil, nil
+	}
+	return &LastConversion{last}, nil
+}
+
+// CanRemux reports whether the content is the output of the last conversion with the current preset, e.g. when
+// only the metadata or the thumbnail was uploaded. Then the audio can be copied instead of re-encoded.
+func (c *LastConversion) CanRemux(content storage.Checksum) bool {
+	if c == nil {
+		return false
+	}
+
+	current := c.Versions[len(c.Versions)-1]
+	return current.Preset == converter.Preset() &&
+		current.Checksum == c.OutputChecksum &&
+		content.SHA256Hex() == c.OutputChecksum
+}
+
+// TrackReplayGain returns the loudness measured on the last conversion, nil if it was not measured.
+func (c *LastConversion) TrackReplayGain() *converter.ReplayGain {
+	if c == nil {
+		return nil
+	}
+	return toReplayGain(c.ReplayGain)
+}
+
+// newStoredReplayGain converts the measured loudness to be stored, nil if it was not measured.
+func newStoredReplayGain(replayGain *converter.ReplayGain) *database.ReplayGain {
+	if replayGain == nil {
+		return nil
+	}
+	return &database.ReplayGain{
+		IntegratedLoudness: replayGain.IntegratedLoudness,
+		TruePeak:           replayGain.TruePeak,
+		TrackGain:          replayGain.TrackGain,
+		TrackPeak:          replayGain.TrackPeak,
+	}
+}
+
+// toReplayGain converts the stored loudness back, nil if it was not stored.
+func toReplayGain(stored *database.ReplayGain) *converter.ReplayGain {
+	if stored == nil {
+		return nil
+	}
+	return &converter.ReplayGain{
+		IntegratedLoudness: stored.IntegratedLoudness,
+		TruePeak:           stored.TruePeak,
+		TrackGain:          stored.TrackGain,
+		TrackPeak:          stored.TrackPeak,
+	}
+}
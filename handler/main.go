@@ -2,20 +2,25 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
-	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"pitanguinha.com/audio-converter/internal/analysis"
 	"pitanguinha.com/audio-converter/internal/converter"
-	"pitanguinha.com/audio-converter/internal/s3"
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/lyrics"
+	"pitanguinha.com/audio-converter/internal/storage"
 	"pitanguinha.com/audio-converter/internal/utils"
 )
 
+const syncedLyricsContentType = "text/plain; charset=utf-8"
+
 // parseMetadata reads and parses the metadata file from S3.
 func parseMetadata(metadataPath string) (map[string]string, error) {
 	data, err := utils.ReadFile(metadataPath)
@@ -48,33 +53,73 @@ func parseMetadata(metadataPath string) (map[string]string, error) {
 	return metadata, nil
 }
 
-func encodeContentKey(contentKey string) string {
-	lastSlash := strings.LastIndex(contentKey, "/")
-	folder := contentKey[:lastSlash]
-	fileName := contentKey[lastSlash+1:]
-	return fmt.Sprintf("%s/%s", folder, url.PathEscape(fileName))
+// validateSyncedLyrics checks the synced lyrics file, if the job has one. The error is a *ValidationError if
+// it's not a valid LRC file.
+func validateSyncedLyrics(filesPaths map[string]string) error {
+	path := filesPaths["synced_lyrics"]
+	if path == "" {
+		return nil
+	}
+
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := lyrics.ValidateLRC(data); err != nil {
+		return &ValidationError{Violations: []string{fmt.Sprintf("synced lyrics are invalid: %v", err)}}
+	}
+	return nil
 }
 
 // Handler processes an audio conversion Lambda event.
 func Handler(ctx context.Context, event events.S3Event) error {
-	audioContentType := os.Getenv("AUDIO_CONTENT_TYPE")
+	store, err := NewObjectStore(ctx)
+	if err != nil {
+		slog.Error("failed to create object store", "err", err)
+		return nil
+	}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	repo, err := NewRepository()
 	if err != nil {
-		slog.Error("failed to load AWS config", "err", err)
+		slog.Error("failed to create repository", "err", err)
 		return nil
 	}
 
-	s3Service := s3.NewService(cfg)
+	return HandleEvent(store, repo, event)
+}
 
-	eventParsed, err := ParseEvent(s3Service, event)
+// HandleEvent runs the conversion pipeline for the event, reading and writing the files on the given object store
+// and the documents on the given repository.
+func HandleEvent(store storage.ObjectStore, repo database.Repository, event events.S3Event) error {
+	audioContentType := os.Getenv("AUDIO_CONTENT_TYPE")
+
+	eventParsed, err := ParseEvent(store, event)
 	if err != nil {
 		slog.Error("error parsing event", "err", err)
 		return nil
 	}
 	log.Printf("Parsed event: %+v", eventParsed)
 
-	filesPaths, err := GetFilesFromS3(s3Service, eventParsed)
+	// INFO: On streaming mode the content is read directly from S3 by FFmpeg, so it's not downloaded.
+	streaming := StreamingEnabled() && CanStream(eventParsed.ParentDirKey, eventParsed.OthersFilesKey["content"])
+
+	// INFO: The streamed output is verified against the duration of the source, it can't be measured on the output
+	// itself. The content is downloaded if it's unknown.
+	var sourceDuration float64
+	if streaming {
+		sourceDuration, err = StreamSourceDuration(store, eventParsed.Bucket, eventParsed.OthersFilesKey["content"])
+		if err != nil || sourceDuration <= 0 {
+			slog.Warn("source duration is unknown, the content will be downloaded", "err", err)
+			streaming = false
+		}
+	}
+
+	var skipFiles []string
+	if streaming {
+		skipFiles = append(skipFiles, "content")
+	}
+
+	filesPaths, checksums, err := GetFilesFromS3(store, eventParsed, skipFiles...)
 	if err != nil {
 		slog.Error("error getting files from S3", "err", err)
 		return nil
@@ -87,52 +132,341 @@ func Handler(ctx context.Context, event events.S3Event) error {
 	}
 	log.Printf("Parsed metadata: %+v", metadata)
 
-	duration, err := converter.GetDurationFromFile(filesPaths["content"])
+	// INFO: The run is started on the document of the event key, the id of the metadata is only trusted once it's
+	// validated to be the same.
+	documentID := eventParsed.DocumentID()
+	if documentID == "" {
+		slog.Error("event key has no document id", "key", eventParsed.EventFileKey)
+		return nil
+	}
+
+	run, err := StartConversionRun(repo, metadata["collection_name"], documentID, event.Records[0].S3.Object.Sequencer)
+	if errors.Is(err, database.ErrTransitionRejected) {
+		slog.Warn("conversion not started, the event is older than the last conversion or was already converted", "err", err)
+		return nil
+	}
+	if err != nil {
+		slog.Error("error starting conversion", "err", err)
+		return nil
+	}
+	defer run.FailIfUnfinished()
+	run.EnableDebugBundle(store, eventParsed.Bucket, filesPaths, metadata)
+	log.Printf("Conversion started: run %s", run.ID)
+
+	// INFO: An operator cancels the conversion by setting cancel_requested on the document, FFmpeg is killed and
+	// the job files are kept. It's checked until the upload starts, the flag was cleared when the run started.
+	ctx, cancelWatcher := WatchCancellation(context.Background(), run)
+	defer cancelWatcher.Stop()
+	if cancelWatcher.Requested() {
+		cancelConversion(run)
+		return nil
+	}
+
+	// INFO: The job files are checked before the conversion, a violation fails the job without retries.
+	limits := LoadInputLimits()
+	err = ValidateDocumentID(eventParsed, metadata)
+	if err == nil {
+		err = ValidateInputs(filesPaths, limits)
+	}
+	if err == nil && streaming {
+		err = ValidateStreamSource(store, eventParsed.Bucket, eventParsed.OthersFilesKey["content"], sourceDuration, limits)
+	}
 	if err != nil {
-		slog.Error("error getting duration", "err", err)
+		slog.Error("error validating input files", "err", err)
+		run.SetFailure(err, nil)
+		return nil
+	}
+
+	if err := validateSyncedLyrics(filesPaths); err != nil {
+		slog.Error("error validating synced lyrics", "err", err)
+		run.SetFailure(err, nil)
 		return nil
 	}
-	log.Printf("Duration of the audio file: %f seconds", duration)
 
-	details, err := ProcessAudioFile(duration, filesPaths, metadata)
+	uploadProfile, err := LoadUploadProfile(metadata["collection_name"])
 	if err != nil {
-		slog.Error("error processing audio file", "err", err, "details", details)
+		slog.Error("error loading upload profile", "err", err)
 		return nil
 	}
-	slog.Info("File processed successfully", "details", details)
 
 	bucket := eventParsed.Bucket
-	keysToDelete := []string{
-		eventParsed.EventFileKey,
-		eventParsed.OthersFilesKey["content"],
+	audioFormat := os.Getenv("AUDIO_FORMAT")
+	versionCreatedAt := time.Now()
+	// INFO: The collisions are checked on the key of the content before it's versioned, a version key is always new.
+	contentKey, err := BuildContentKey(eventParsed.ParentDirKey, audioFormat, metadata)
+	if err == nil {
+		contentKey, err = ResolveContentKey(store, bucket, contentKey, metadata["id"])
 	}
+	if err != nil {
+		slog.Error("error building content key", "err", err)
+		return nil
+	}
+	contentKey = VersionedKey(contentKey, versionCreatedAt)
+	contentOpts := uploadProfile.PutOptions(audioContentType, metadata["title"]+"."+audioFormat, metadata)
 
-	if err := DeleteFilesFromS3(s3Service, bucket, keysToDelete...); err != nil {
-		slog.Error("error deleting old files from S3", "err", err)
+	var duration float64
+	var details *converter.FFmpegProgressDetails
+	var sourceChecksum, outputChecksum storage.Checksum
+	var sourceSHA256 string
+	var replayGain, previousGain *converter.ReplayGain // previousGain is the loudness of the reused audio, if remuxed
+	var loudness *analysis.Loudness
+	var musicAnalysis *analysis.MusicAnalysis
+	remux, uploaded := false, streaming // uploaded is true when the output is already at the content key
+	tagsChecksum := TagsChecksum(metadata, checksums)
+
+	// INFO: The progress of FFmpeg is published to the subscribers, e.g. the document of the run.
+	progress := converter.NewProgressFeed()
+	progressReporter := NewProgressReporter(run)
+	progress.Subscribe(progressReporter.Report)
+	defer progressReporter.Close()
+	defer progress.Close()
+
+	if streaming {
+		var streamChecksums *StreamChecksums
+		details, streamChecksums, err = ProcessAudioStream(ctx, store, bucket, eventParsed.OthersFilesKey["content"], contentKey, sourceDuration, contentOpts, filesPaths, metadata, progress.Publish)
+		if err != nil && cancelWatcher.Requested() {
+			cancelConversion(run)
+			return nil
+		}
+		if err != nil {
+			code, stderr := converter.ErrorDetails(err)
+			slog.Error("error processing audio stream", "err", err, "code", code, "stderr", stderr, "details", details)
+			run.SetFailure(err, details)
+			return nil
+		}
+		duration = sourceDuration
+		sourceChecksum, outputChecksum = streamChecksums.Source, streamChecksums.Output
+		sourceSHA256 = sourceChecksum.SHA256Hex()
+		slog.Info("File processed and uploaded successfully (streaming)", "details", details)
+	} else {
+		sourceChecksum = checksums["content"]
+		sourceSHA256 = sourceChecksum.SHA256Hex()
+
+		// INFO: When the content is the output of the last conversion (metadata or thumbnail update),
+		// the audio is copied instead of re-encoded.
+		lastConversion, err := FindLastConversion(repo, metadata["collection_name"], metadata["id"])
+		if err != nil {
+			slog.Warn("failed to find last conversion, the content will be re-encoded", "err", err)
+		}
+		if lastConversion.CanRemux(sourceChecksum) {
+			slog.Info("Content is the output of the last conversion, remuxing it")
+			remux, previousGain = true, lastConversion.TrackReplayGain()
+			// A remuxed content keeps the checksum of the original upload, it's the same audio.
+			sourceSHA256 = lastConversion.SourceChecksum
+		}
+
+		// INFO: An identical source already converted with the same preset is reused: its output is copied
+		// if it has the same tags, otherwise its audio is remuxed with the tags of this document.
+		var cached *CachedConversion
+		if !remux {
+			cached, err = FindCachedConversion(store, repo, sourceSHA256)
+			if err != nil {
+				slog.Warn("failed to find cached conversion, the content will be converted", "err", err)
+			}
+		}
+		switch {
+		case cached == nil:
+		case cached.CanCopy(bucket, tagsChecksum):
+			outputChecksum, err = CopyCachedConversion(store, cached, bucket, contentKey, contentOpts)
+			if err != nil {
+				slog.Error("error copying cached conversion", "bucket", bucket, "key", contentKey, "err", err)
+				return nil
+			}
+			duration, replayGain, uploaded = cached.Duration, toReplayGain(cached.ReplayGain), true
+			details = &converter.FFmpegProgressDetails{Duration: duration, CurrentTime: duration, Progress: 100, Finished: true}
+			log.Printf("Cached conversion copied successfully to S3: %s/%s", bucket, contentKey)
+		default:
+			cachedPath, _, err := downloadFile(store, cached.Bucket, cached.Key, utils.GetWorkDir(), "cached_content")
+			if err != nil {
+				slog.Warn("failed to download cached conversion, the content will be converted", "err", err)
+				break
+			}
+			slog.Info("Remuxing cached conversion", "key", cached.Key)
+			filesPaths["content"], remux, previousGain = cachedPath, true, toReplayGain(cached.ReplayGain)
+		}
+	}
+
+	// INFO: On streaming mode there is no processed file to measure, the replay gain is skipped.
+	if !uploaded {
+		duration, err = converter.GetDurationFromFile(filesPaths["content"])
+		if err != nil {
+			slog.Error("error getting duration", "err", err)
+			return nil
+		}
+		log.Printf("Duration of the audio file: %f seconds", duration)
+
+		details, err = ProcessAudioFile(ctx, duration, filesPaths, metadata, remux, progress.Publish)
+		if err != nil && cancelWatcher.Requested() {
+			cancelConversion(run)
+			return nil
+		}
+		if err != nil {
+			code, stderr := converter.ErrorDetails(err)
+			slog.Error("error processing audio file", "err", err, "code", code, "stderr", stderr, "details", details)
+			run.SetFailure(err, details)
+			return nil
+		}
+		slog.Info("File processed successfully", "details", details)
+
+		replayGain, err = ApplyReplayGain(details.ProcessedFilePath, previousGain)
+		if err != nil {
+			slog.Warn("failed to apply replay gain", "err", err)
+		}
+
+		// The tempo and key tags are written before the verification, so the uploaded file is the verified one.
+		loudness, musicAnalysis = AnalyzeOutput(ctx, store, bucket, contentKey, details.ProcessedFilePath, metadata)
+
+		// INFO: The output is checked against the preset before the job files are deleted, a truncated or
+		// wrong output fails the job.
+		expected := converter.ExpectedOutput(duration, filesPaths["thumbnail"] != "")
+		if err := converter.VerifyOutput(details.ProcessedFilePath, expected); err != nil {
+			slog.Error("error verifying converted content", "err", err)
+			run.SetFailure(err, details)
+			return nil
+		}
+	}
+
+	// A streamed or copied output is verified and analyzed from the store, it's removed if it doesn't match.
+	if uploaded {
+		expected := converter.ExpectedOutput(duration, filesPaths["thumbnail"] != "")
+		if err := VerifyStoredOutput(store, bucket, contentKey, expected); err != nil {
+			slog.Error("error verifying uploaded content", "key", contentKey, "err", err)
+			if err := store.DeleteObject(bucket, contentKey); err != nil {
+				slog.Warn("failed to remove unverified output", "key", contentKey, "err", err)
+			}
+			run.SetFailure(err, details)
+			return nil
+		}
+		loudness, musicAnalysis = AnalyzeOutput(ctx, store, bucket, contentKey, "", metadata)
+	}
+
+	// The last progress is written before the next status.
+	progress.Close()
+	progressReporter.Close()
+
+	cancelWatcher.Stop()
+	if cancelWatcher.Requested() {
+		// The output already written (streaming or cached copy) is not a version of the document.
+		if uploaded {
+			if err := store.DeleteObject(bucket, contentKey); err != nil {
+				slog.Warn("failed to remove output of cancelled conversion", "key", contentKey, "err", err)
+			}
+		}
+		cancelConversion(run)
 		return nil
 	}
 
-	contentKey := fmt.Sprintf("%s/%s.%s", eventParsed.ParentDirKey, metadata["title"], os.Getenv("AUDIO_FORMAT"))
-	if err := UploadContentToS3(s3Service, bucket, contentKey, audioContentType, details.ProcessedFilePath); err != nil {
-		slog.Error("error uploading converted content to S3", "bucket", bucket, "key", contentKey, "err", err)
+	// INFO: A content which is a previous version (re-conversion) is kept for rollbacks, it's pruned by retention.
+	keysToDelete := []string{eventParsed.EventFileKey}
+	if sourceKey := eventParsed.OthersFilesKey["content"]; !isVersionedKey(eventParsed.ParentDirKey, sourceKey) {
+		keysToDelete = append(keysToDelete, sourceKey)
+	}
+	for _, name := range []string{"lyrics", "synced_lyrics"} {
+		if key := eventParsed.OthersFilesKey[name]; key != "" {
+			keysToDelete = append(keysToDelete, key)
+		}
+	}
+
+	// INFO: A run taken over stops here, the files of the job belong to the newer run.
+	if err := run.Transition(database.StatusUploading); err != nil {
+		slog.Error("error setting conversion status", "status", database.StatusUploading, "err", err)
 		return nil
 	}
-	log.Printf("Content uploaded successfully to S3: %s/%s", bucket, contentKey)
+
+	if err := DeleteFilesFromS3(store, bucket, keysToDelete...); err != nil {
+		slog.Error("error deleting old files from S3", "err", err)
+		return nil
+	}
+
+	if !uploaded {
+		outputChecksum, err = UploadContentToS3(store, bucket, contentKey, details.ProcessedFilePath, contentOpts)
+		if err != nil {
+			slog.Error("error uploading converted content to S3", "bucket", bucket, "key", contentKey, "err", err)
+			return nil
+		}
+		log.Printf("Content uploaded successfully to S3: %s/%s", bucket, contentKey)
+	}
+
+	var lyricsKey string
+	if lyricsPath := filesPaths["synced_lyrics"]; lyricsPath != "" {
+		lyricsKey, err = BuildContentKey(eventParsed.ParentDirKey, strings.TrimPrefix(syncedLyricsExt, "."), metadata)
+		if err == nil {
+			lyricsKey, err = ResolveContentKey(store, bucket, lyricsKey, metadata["id"])
+		}
+		if err != nil {
+			slog.Error("error building synced lyrics key", "err", err)
+			return nil
+		}
+
+		lyricsOpts := uploadProfile.PutOptions(syncedLyricsContentType, metadata["title"]+syncedLyricsExt, metadata)
+		if _, err := UploadContentToS3(store, bucket, lyricsKey, lyricsPath, lyricsOpts); err != nil {
+			slog.Error("error uploading synced lyrics to S3", "bucket", bucket, "key", lyricsKey, "err", err)
+			return nil
+		}
+		log.Printf("Synced lyrics uploaded successfully to S3: %s/%s", bucket, lyricsKey)
+	}
+
+	presignedURLs, err := PresignOutputs(store, bucket, contentKey, lyricsKey)
+	if err != nil {
+		slog.Warn("failed to presign output URLs", "err", err)
+	}
 
 	doc := UpdateDocumentInput{
 		ID:             metadata["id"],
 		CollectionName: metadata["collection_name"],
 		ContentKey:     encodeContentKey(contentKey),
+		LyricsKey:      encodeContentKey(lyricsKey),
 		Duration:       duration,
-		Status:         SetStatus(details.Finished),
+		ReplayGain:     replayGain,
+		Loudness:       loudness,
+		MusicAnalysis:  musicAnalysis,
+		SourceChecksum: sourceSHA256,
+		OutputChecksum: outputChecksum.SHA256Hex(),
+		PresignedURLs:  presignedURLs,
+		Version: &database.ContentVersion{
+			Key:       encodeContentKey(contentKey),
+			Checksum:  outputChecksum.SHA256Hex(),
+			Preset:    converter.Preset(),
+			CreatedAt: versionCreatedAt,
+		},
+		RunID:  run.ID,
+		Status: SetStatus(details.Finished),
 	}
 
-	if err := doc.UpdateDocument(); err != nil {
+	if err := doc.UpdateDocument(repo); err != nil {
 		slog.Error("error updating document in database", "err", err)
 		return nil
 	}
+	run.Finish()
 	log.Printf("Document updated successfully: %+v", doc)
 
+	if doc.Status == database.StatusSuccess {
+		cached := database.CachedConversion{
+			ID:             conversionCacheID(sourceSHA256),
+			Bucket:         bucket,
+			Key:            contentKey,
+			OutputChecksum: outputChecksum.SHA256Hex(),
+			TagsChecksum:   tagsChecksum,
+			Duration:       duration,
+			ReplayGain:     newStoredReplayGain(replayGain),
+			CreatedAt:      versionCreatedAt,
+		}
+		if err := StoreCachedConversion(repo, cached); err != nil {
+			slog.Warn("failed to store cached conversion", "err", err)
+		}
+	}
+
+	retention := utils.GetEnvInt("VERSION_RETENTION", defaultVersionRetention)
+	if err := PruneVersions(store, repo, bucket, doc.CollectionName, doc.ID, retention); err != nil {
+		slog.Warn("failed to prune old content versions", "err", err)
+	}
+
+	if metadata["type"] == "music" && replayGain != nil {
+		if err := UpdateAlbumGain(repo, metadata["collection_name"], metadata["artist"], metadata["album"]); err != nil {
+			slog.Warn("failed to update album gain", "err", err)
+		}
+	}
+
 	if err := utils.DeleteFiles(utils.GetWorkDir()); err != nil {
 		slog.Warn("failed to clean up temporary files", "err", err)
 	}
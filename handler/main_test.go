@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+// ffmpegStub writes the m4a output, the last argument, and its progress. The other commands (e.g. the replay gain
+// measure) fail, their errors are only logged.
+const ffmpegStub = `#!/bin/sh
+for last; do :; done
+case "$last" in
+*.m4a) printf 'converted' > "$last" ;;
+*) exit 1 ;;
+esac
+printf 'out_time_us=5000000\nprogress=continue\nout_time_us=10000000\nprogress=end\n'
+`
+
+// ffprobeStub describes every file as a 10 seconds m4a with a cover.
+const ffprobeStub = `#!/bin/sh
+case "$*" in
+*json*) cat <<'EOF'
+{"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "10.000000", "size": "9"},
+ "streams": [{"codec_type": "audio", "codec_name": "aac", "sample_rate": "44100", "channels": 2},
+             {"codec_type": "video", "codec_name": "png", "width": 100, "height": 100, "disposition": {"attached_pic": 1}}]}
+EOF
+;;
+*) echo 10.000000 ;;
+esac
+`
+
+// setupPipeline sets the environment of the pipeline with the FFmpeg and ffprobe stubs, and returns an empty store
+// and a repository with the documents "doc" and "other" of the music collection.
+func setupPipeline(t *testing.T) (*storage.MemoryStore, *database.MemoryRepository) {
+	t.Helper()
+	bin := t.TempDir()
+	for name, script := range map[string]string{"ffmpeg": ffmpegStub, "ffprobe": ffprobeStub} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for key, value := range map[string]string{
+		"WORK_DIR":             t.TempDir(),
+		"FFMPEG_BIN_PATH":      filepath.Join(bin, "ffmpeg"),
+		"FFPROBE_BIN_PATH":     filepath.Join(bin, "ffprobe"),
+		"AUDIO_FORMAT":         "m4a",
+		"AUDIO_CODEC":          "aac",
+		"AUDIO_CONTENT_TYPE":   "audio/mp4",
+		"CONTENT_SUFFIX":       "_content",
+		"THUMBNAIL_SUFFIX":     "_thumbnail",
+		"SYNCED_LYRICS_SUFFIX": "_synced.lrc",
+		"STREAMING_MODE":       "false",
+		"LOUDNESS_ANALYSIS":    "false",
+		"MUSIC_ANALYSIS":       "false",
+		"DEBUG_BUNDLE_PREFIX":  "",
+	} {
+		t.Setenv(key, value)
+	}
+
+	repo := database.NewMemoryRepository()
+	repo.PutDocument("music", "doc", database.MemoryDocument{})
+	repo.PutDocument("music", "other", database.MemoryDocument{})
+	return storage.NewMemoryStore(), repo
+}
+
+// putJobFiles uploads the job files of the document "doc", the metadata with the id and the extra files.
+func putJobFiles(t *testing.T, store storage.ObjectStore, id string, extra map[string]string) {
+	t.Helper()
+	var thumbnail bytes.Buffer
+	if err := png.Encode(&thumbnail, image.NewGray(image.Rect(0, 0, 100, 100))); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"doc/Title/metadata.json": `{"id": "` + id + `", "title": "Title", "collection_name": "music", "type": "music",
+			"artist": "Artist", "album": "Album", "genre": "ROCK", "year": "2003"}`,
+		"doc/Title/song_content":    "ID3\x04\x00\x00\x00\x00\x00\x00audio", // Detected as mp3 by its tag, probed by the stub
+		"doc/Title/cover_thumbnail": thumbnail.String(),
+	}
+	for key, content := range extra {
+		files[key] = content
+	}
+	for key, content := range files {
+		if err := store.PutObject("bucket", key, strings.NewReader(content), storage.PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// metadataEvent is the event of the upload of the metadata file of the document "doc".
+func metadataEvent(sequencer string) events.S3Event {
+	return events.S3Event{Records: []events.S3EventRecord{{S3: events.S3Entity{
+		Bucket: events.S3Bucket{Name: "bucket"},
+		Object: events.S3Object{Key: "doc/Title/metadata.json", Sequencer: sequencer},
+	}}}}
+}
+
+// versionKeys returns the keys of the versions of the document "doc" in the store.
+func versionKeys(t *testing.T, store storage.ObjectStore) []string {
+	t.Helper()
+	keys, err := storage.ListKeys(store, "bucket", "doc/Title/"+versionsDir+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestHandleEvent(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		store, repo := setupPipeline(t)
+		putJobFiles(t, store, "doc", map[string]string{"doc/Title/song_synced.lrc": "[00:01.00]Line"})
+
+		if err := HandleEvent(store, repo, metadataEvent("0A")); err != nil {
+			t.Fatal(err)
+		}
+
+		doc, _ := repo.Document("music", "doc")
+		versions := versionKeys(t, store)
+		if doc.ConversionStatus != database.StatusSuccess || doc.Failure != nil || len(versions) != 1 || len(doc.Versions) != 1 {
+			t.Fatalf("document = %+v, versions = %v, want a successful conversion with one version", doc, versions)
+		}
+		if doc.ContentKey != versions[0] || !strings.HasSuffix(doc.ContentKey, "/Title.m4a") || doc.Duration == "" {
+			t.Errorf("content key = %s, duration = %s, want the stored version %s and a duration", doc.ContentKey, doc.Duration, versions[0])
+		}
+		if doc.LyricsKey != "doc/Title/Title.lrc" {
+			t.Errorf("lyrics key = %s, want doc/Title/Title.lrc", doc.LyricsKey)
+		}
+		if got := getOutput(t, store, doc.ContentKey); got != "converted" {
+			t.Errorf("output = %q, want the FFmpeg output", got)
+		}
+
+		// The job files are deleted, except the thumbnail.
+		keys, _ := storage.ListKeys(store, "bucket", "doc/Title/")
+		for _, key := range keys {
+			if strings.HasPrefix(key, "doc/Title/metadata.json") || strings.HasSuffix(key, "_content") || strings.HasSuffix(key, "_synced.lrc") {
+				t.Errorf("job file %s was not deleted", key)
+			}
+		}
+	})
+
+	validationTests := []struct {
+		name  string
+		id    string
+		extra map[string]string
+	}{
+		{"metadata id of another document", "other", nil},
+		{"invalid synced lyrics", "doc", map[string]string{"doc/Title/song_synced.lrc": "not synced lyrics"}},
+	}
+	for _, tt := range validationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, repo := setupPipeline(t)
+			putJobFiles(t, store, tt.id, tt.extra)
+
+			if err := HandleEvent(store, repo, metadataEvent("0A")); err != nil {
+				t.Fatal(err)
+			}
+
+			doc, _ := repo.Document("music", "doc")
+			if doc.ConversionStatus != database.StatusFailed || doc.Failure == nil ||
+				doc.Failure.Code != string(converter.ErrCodeInvalidInput) || doc.Failure.Retryable {
+				t.Fatalf("document = %+v, failure = %+v, want a not retryable %s failure", doc, doc.Failure, converter.ErrCodeInvalidInput)
+			}
+			if other, _ := repo.Document("music", "other"); len(other.StatusHistory) != 0 {
+				t.Errorf("other document = %+v, want it untouched", other)
+			}
+			if versions := versionKeys(t, store); len(versions) != 0 {
+				t.Errorf("versions = %v, want none", versions)
+			}
+			if _, err := store.HeadObject("bucket", "doc/Title/metadata.json"); err != nil {
+				t.Errorf("job files of a failed conversion were deleted: %v", err)
+			}
+		})
+	}
+
+	t.Run("stale event ignored", func(t *testing.T) {
+		store, repo := setupPipeline(t)
+		putJobFiles(t, store, "doc", nil)
+		if err := HandleEvent(store, repo, metadataEvent("0B")); err != nil {
+			t.Fatal(err)
+		}
+		converted, _ := repo.Document("music", "doc")
+
+		// A delayed event, older than the converted one, of job files uploaded again.
+		putJobFiles(t, store, "doc", nil)
+		if err := HandleEvent(store, repo, metadataEvent("0A")); err != nil {
+			t.Fatal(err)
+		}
+
+		doc, _ := repo.Document("music", "doc")
+		if doc.ConversionStatus != database.StatusSuccess || doc.ConversionRunID != converted.ConversionRunID ||
+			len(doc.StatusHistory) != len(converted.StatusHistory) {
+			t.Errorf("document = %+v, want the conversion of the newer event", doc)
+		}
+		if versions := versionKeys(t, store); len(versions) != 1 {
+			t.Errorf("versions = %v, want only the one of the newer event", versions)
+		}
+		if _, err := store.HeadObject("bucket", "doc/Title/metadata.json"); err != nil {
+			t.Errorf("job files of the ignored event were deleted: %v", err)
+		}
+	})
+}
+
+func getOutput(t *testing.T, store storage.ObjectStore, key string) string {
+	t.Helper()
+	body, err := store.GetObject("bucket", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	var data bytes.Buffer
+	if _, err := data.ReadFrom(body); err != nil {
+		t.Fatal(err)
+	}
+	return data.String()
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"pitanguinha.com/audio-converter/internal/s3"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+var (
+	memoryStore     *storage.MemoryStore
+	memoryStoreOnce sync.Once
+)
+
+// NewObjectStore creates the object store selected by the STORAGE_BACKEND environment variable:
+// "s3" (default), "fs" (rooted at STORAGE_ROOT) or "memory" (shared by all the invocations of the process).
+func NewObjectStore(ctx context.Context) (storage.ObjectStore, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "s3":
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		return s3.NewService(cfg), nil
+	case "fs":
+		root := os.Getenv("STORAGE_ROOT")
+		if root == "" {
+			return nil, fmt.Errorf("STORAGE_ROOT environment variable must be set for the fs storage backend")
+		}
+		return storage.NewFileSystemStore(root), nil
+	case "memory":
+		memoryStoreOnce.Do(func() { memoryStore = storage.NewMemoryStore() })
+		return memoryStore, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", backend)
+	}
+}
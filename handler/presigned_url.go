@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/storage"
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+const maxPresignExpiry = 7 * 24 * time.Hour // SigV4 limit of presigned URLs
+
+// presignExpiry reads the expiry of presigned URLs in minutes from the environment variable.
+// Returns 0 if it's not positive, the limit of presigned URLs is 7 days.
+func presignExpiry(envKey string, defaultMinutes int) (time.Duration, error) {
+	expiry := time.Duration(utils.GetEnvInt(envKey, defaultMinutes)) * time.Minute
+	if expiry > maxPresignExpiry {
+		return 0, fmt.Errorf("%s is longer than %s", envKey, maxPresignExpiry)
+	}
+	return max(expiry, 0), nil
+}
+
+// PresignOutputs creates presigned GET URLs for the content and the synced lyrics sidecar (if the key is not empty),
+// valid for PRESIGNED_GET_EXPIRY_MINUTES. Returns nil if it's not set or the store can't create presigned URLs.
+func PresignOutputs(store storage.ObjectStore, bucket, contentKey, lyricsKey string) (*database.PresignedURLs, error) {
+	expiry, err := presignExpiry("PRESIGNED_GET_EXPIRY_MINUTES", 0)
+	if err != nil || expiry == 0 {
+		return nil, err
+	}
+
+	presigner, ok := store.(storage.Presigner)
+	if !ok {
+		return nil, nil
+	}
+
+	urls := &database.PresignedURLs{ExpiresAt: time.Now().Add(expiry)}
+	if urls.Content, err = presigner.PresignGetObject(bucket, contentKey, expiry); err != nil {
+		return nil, err
+	}
+	if lyricsKey != "" {
+		if urls.SyncedLyrics, err = presigner.PresignGetObject(bucket, lyricsKey, expiry); err != nil {
+			return nil, err
+		}
+	}
+
+	return urls, nil
+}
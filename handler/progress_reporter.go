@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/database"
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+const (
+	defaultProgressInterval    = 3 // seconds
+	defaultProgressStepPercent = 5
+)
+
+// ProgressReporter writes the progress of FFmpeg to the document of a conversion run, at most every
+// PROGRESS_REPORT_STEP_PERCENT percent or PROGRESS_REPORT_INTERVAL_SECONDS seconds.
+// INFO: Report is called by the goroutine reading the FFmpeg output, so the writes are done by another goroutine.
+// Only the latest pending progress is kept, the older ones are dropped if the database is slower than FFmpeg.
+type ProgressReporter struct {
+	run      *ConversionRun
+	interval time.Duration
+	step     float64
+
+	lastPercent float64
+	lastAt      time.Time
+
+	updates   chan database.ConversionProgress
+	done      sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewProgressReporter creates a ProgressReporter for the run and starts its writer, it must be closed with Close.
+func NewProgressReporter(run *ConversionRun) *ProgressReporter {
+	r := &ProgressReporter{
+		run:      run,
+		interval: time.Duration(utils.GetEnvInt("PROGRESS_REPORT_INTERVAL_SECONDS", defaultProgressInterval)) * time.Second,
+		step:     float64(utils.GetEnvInt("PROGRESS_REPORT_STEP_PERCENT", defaultProgressStepPercent)),
+		lastAt:   time.Now(),
+		updates:  make(chan database.ConversionProgress, 1),
+	}
+
+	r.done.Add(1)
+	go r.write()
+	return r
+}
+
+// Report queues the progress if the step or the interval was reached since the last one, it never blocks.
+func (r *ProgressReporter) Report(details converter.FFmpegProgressDetails) {
+	now := time.Now()
+	if !details.Finished && details.Progress-r.lastPercent < r.step && now.Sub(r.lastAt) < r.interval {
+		return
+	}
+	r.lastPercent, r.lastAt = details.Progress, now
+
+	progress := database.ConversionProgress{
+		Percent:    details.Progress,
+		Speed:      details.Speed,
+		ETASeconds: details.ETA().Seconds(),
+		UpdatedAt:  now,
+	}
+
+	// Replace the pending progress, if any. Report is the only sender, so the second send can't block.
+	select {
+	case <-r.updates:
+	default:
+	}
+	r.updates <- progress
+}
+
+// Close waits for the pending progress to be written and stops the writer, it can be called more than once.
+func (r *ProgressReporter) Close() {
+	r.closeOnce.Do(func() {
+		close(r.updates)
+		r.done.Wait()
+	})
+}
+
+// write saves the queued progress on the document, until the run is not processing anymore.
+func (r *ProgressReporter) write() {
+	defer r.done.Done()
+
+	stopped := false
+	for progress := range r.updates {
+		if stopped {
+			continue
+		}
+
+		err := r.run.repo.SaveProgress(r.run.CollectionName, r.run.DocumentID, r.run.ID, progress)
+		switch {
+		case errors.Is(err, database.ErrTransitionRejected):
+			slog.Warn("conversion is not processing anymore, progress is not reported", "run", r.run.ID)
+			stopped = true
+		case err != nil:
+			slog.Warn("failed to report conversion progress", "run", r.run.ID, "err", err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"pitanguinha.com/audio-converter/internal/database"
+)
+
+var (
+	repository     database.Repository
+	repositoryErr  error
+	repositoryOnce sync.Once
+)
+
+// NewRepository returns the repository selected by the DATABASE_BACKEND environment variable: "mongo" (default),
+// "postgres" or "sqlite" (opened with DATABASE_URL) or "memory". It's shared by all the invocations of the process.
+func NewRepository() (database.Repository, error) {
+	repositoryOnce.Do(func() {
+		cacheCollection := os.Getenv("CONVERSION_CACHE_COLLECTION")
+
+		switch backend := os.Getenv("DATABASE_BACKEND"); backend {
+		case "", "mongo":
+			repository, repositoryErr = database.NewMongoRepository(cacheCollection)
+		case "postgres", "sqlite":
+			driver := map[string]string{"postgres": "pgx", "sqlite": "sqlite"}[backend]
+			dsn := os.Getenv("DATABASE_URL")
+			if dsn == "" {
+				repositoryErr = fmt.Errorf("DATABASE_URL environment variable must be set for the %s database backend", backend)
+				return
+			}
+			repository, repositoryErr = database.NewSQLRepository(driver, dsn, cacheCollection)
+		case "memory":
+			repository = database.NewMemoryRepository()
+		default:
+			repositoryErr = fmt.Errorf("unknown database backend: %s", backend)
+		}
+	})
+
+	return repository, repositoryErr
+}
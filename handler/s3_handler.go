@@ -1,12 +1,15 @@
 package handler
 
 import (
-	"pitanguinha.com/audio-converter/internal/s3"
+	"slices"
+
+	"pitanguinha.com/audio-converter/internal/storage"
 	"pitanguinha.com/audio-converter/internal/utils"
 )
 
 // GetFilesFromS3 retrieves the metadata, thumbnail, and content files from S3 based on the event parsed.
-func GetFilesFromS3(s3Service *s3.S3Service, eventParsed EventParsed) (map[string]string, error) {
+// Returns the paths and the verified checksums of the files. Files named in skipFiles are not downloaded.
+func GetFilesFromS3(store storage.ObjectStore, eventParsed EventParsed, skipFiles ...string) (map[string]string, map[string]storage.Checksum, error) {
 	type fileSpec struct {
 		s3KeyName string
 		fileName  string
@@ -18,38 +21,64 @@ func GetFilesFromS3(s3Service *s3.S3Service, eventParsed EventParsed) (map[strin
 		{s3KeyName: eventParsed.OthersFilesKey["content"], fileName: "content"},
 	}
 
+	// Optional files, only present if uploaded with the job.
+	for _, fileName := range []string{"lyrics", "synced_lyrics"} {
+		if key := eventParsed.OthersFilesKey[fileName]; key != "" {
+			fileSpecs = append(fileSpecs, fileSpec{s3KeyName: key, fileName: fileName})
+		}
+	}
+
 	filesPaths := make(map[string]string)
+	checksums := make(map[string]storage.Checksum)
 	workDir := utils.GetWorkDir()
 
 	for _, spec := range fileSpecs {
-		reader, err := s3Service.GetObject(eventParsed.Bucket, spec.s3KeyName)
-		if err != nil {
-			return nil, err
+		if slices.Contains(skipFiles, spec.fileName) {
+			continue
 		}
 
-		filePath, err := utils.WriteToFileFromReader(workDir, spec.fileName, reader)
+		filePath, checksum, err := downloadFile(store, eventParsed.Bucket, spec.s3KeyName, workDir, spec.fileName)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		filesPaths[spec.fileName] = filePath
+		checksums[spec.fileName] = checksum
+	}
+	return filesPaths, checksums, nil
+}
+
+// downloadFile downloads an object from S3 to a file in the directory, large objects are downloaded in parallel ranges.
+// The checksum of the file is verified against the one stored by S3.
+func downloadFile(store storage.ObjectStore, bucket, key, dir, fileName string) (string, storage.Checksum, error) {
+	file, err := utils.CreateFile(dir, fileName)
+	if err != nil {
+		return "", storage.Checksum{}, err
+	}
+	defer file.Close()
+
+	checksum, err := storage.DownloadFile(store, bucket, key, file)
+	if err != nil {
+		return "", checksum, err
 	}
-	return filesPaths, nil
+	return file.Name(), checksum, file.Sync()
 }
 
-// UploadContentToS3 uploads the content file to the specified S3 bucket with the given key and content type.
-func UploadContentToS3(s3Service *s3.S3Service, bucket, key, contentType, filePath string) error {
+// UploadContentToS3 uploads the content file to the specified S3 bucket with the given key and object attributes.
+// The file is sent with its SHA-256 checksum, so S3 verifies it. Files larger than the multipart threshold are
+// uploaded with a concurrent multipart upload. Returns the checksum of the file.
+func UploadContentToS3(store storage.ObjectStore, bucket, key, filePath string, opts storage.PutOptions) (storage.Checksum, error) {
 	file, err := utils.OpenFile(filePath)
 	if err != nil {
-		return err
+		return storage.Checksum{}, err
 	}
 	defer file.Close()
-	return s3Service.PutObject(bucket, key, contentType, file)
+	return storage.PutFile(store, bucket, key, file, opts)
 }
 
 // DeleteFilesFromS3 deletes the specified files from the S3 bucket.
-func DeleteFilesFromS3(s3Service *s3.S3Service, bucket string, keys ...string) error {
+func DeleteFilesFromS3(store storage.ObjectStore, bucket string, keys ...string) error {
 	for _, key := range keys {
-		if err := s3Service.DeleteObject(bucket, key); err != nil {
+		if err := store.DeleteObject(bucket, key); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"fmt"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/storage"
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+// VerifyStoredOutput checks an output already at the content key (streamed or copied from the cache) against the
+// spec, like converter.VerifyOutput. ffprobe reads it from a presigned URL (ANALYSIS_PRESIGN_EXPIRY_MINUTES),
+// or from a downloaded copy if the store can't presign URLs.
+func VerifyStoredOutput(store storage.ObjectStore, bucket, contentKey string, spec converter.OutputSpec) error {
+	input, err := analysisInput(store, bucket, contentKey, "")
+	if err != nil {
+		return fmt.Errorf("error presigning stored output: %w", err)
+	}
+	if input == "" {
+		input, _, err = downloadFile(store, bucket, contentKey, utils.GetWorkDir(), "stored_content")
+		if err != nil {
+			return fmt.Errorf("error downloading stored output: %w", err)
+		}
+	}
+	return converter.VerifyOutput(input, spec)
+}
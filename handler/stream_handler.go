@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+// stagingSuffix is appended to the output key to get the key the output is streamed to, it's only copied to the
+// output key once FFmpeg succeeded and the source was verified.
+const stagingSuffix = ".partial"
+
+// seekableSourceExts are the source extensions which FFmpeg may need to seek to read (moov atom at the end).
+var seekableSourceExts = []string{".m4a", ".mp4", ".m4b", ".mov", ".3gp"}
+
+// StreamingEnabled reports whether the opt-in streaming mode is enabled by the STREAMING_MODE environment variable.
+func StreamingEnabled() bool {
+	return os.Getenv("STREAMING_MODE") == "true"
+}
+
+// CanStream reports whether the content can be converted on streaming mode, otherwise it falls back to disk.
+// The output format must be writable to a non seekable output and the source must be readable from one.
+// A source with the content suffix is a previous output being converted again, which is written to the same key.
+// A previous version is downloaded too, so its checksum can be compared to decide whether the audio can be copied.
+func CanStream(parent, sourceKey string) bool {
+	if _, ok := converter.StreamMuxer(os.Getenv("AUDIO_FORMAT")); !ok {
+		return false
+	}
+
+	if isVersionedKey(parent, sourceKey) {
+		return false
+	}
+
+	if contentSuffix := os.Getenv("CONTENT_SUFFIX"); contentSuffix != "" && strings.HasSuffix(sourceKey, contentSuffix) {
+		return false
+	}
+
+	return !slices.Contains(seekableSourceExts, strings.ToLower(path.Ext(sourceKey)))
+}
+
+// StreamSourceDuration returns the duration of the source read on streaming mode, probed before the conversion
+// from a presigned URL (ANALYSIS_PRESIGN_EXPIRY_MINUTES). Returns 0 if the store can't presign URLs.
+func StreamSourceDuration(store storage.ObjectStore, bucket, sourceKey string) (float64, error) {
+	input, err := analysisInput(store, bucket, sourceKey, "")
+	if err != nil || input == "" {
+		return 0, err
+	}
+
+	duration, err := converter.GetDurationFromFile(input)
+	if err != nil {
+		return 0, fmt.Errorf("error probing duration of %s: %w", sourceKey, err)
+	}
+	return duration, nil
+}
+
+// StreamChecksums holds the checksums of the source and output computed while streaming.
+type StreamChecksums struct {
+	Source storage.Checksum
+	Output storage.Checksum
+}
+
+// ProcessAudioStream converts the source object on streaming mode: the source is read from the store into FFmpeg's stdin
+// and FFmpeg's stdout is uploaded to a staging key (multipart on S3), which is copied to the output key once FFmpeg
+// exited with success and the source matches the checksum stored for it. The staging object is always removed, so
+// the output key is never written by a failed or cancelled conversion. onProgress (if not nil) is called with the progress of FFmpeg
+// on the duration of the source, FFmpeg is killed if the context is cancelled. Returns the details of the conversion
+// process.
+func ProcessAudioStream(ctx context.Context, store storage.ObjectStore, bucket, sourceKey, outputKey string, duration float64, opts storage.PutOptions, filesPaths, metadataMap map[string]string, onProgress converter.ProgressFunc) (*converter.FFmpegProgressDetails, *StreamChecksums, error) {
+	inputsPaths := maps.Clone(filesPaths)
+	inputsPaths["content"] = converter.StdinInput
+
+	cmd, err := buildFFmpegCommand(inputsPaths, metadataMap, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building ffmpeg command: %w", err)
+	}
+
+	log.Println("FFmpeg command (streaming):", cmd)
+
+	sourceInfo, err := store.HeadObject(bucket, sourceKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	source, err := store.GetObject(bucket, sourceKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer source.Close()
+
+	sourceChecksum := storage.NewChecksumWriter()
+	outputChecksum := storage.NewChecksumWriter()
+	stagingKey := outputKey + stagingSuffix
+	upload := func(output io.Reader) error {
+		return storage.PutStream(store, bucket, stagingKey, io.TeeReader(output, outputChecksum), opts)
+	}
+	defer func() {
+		if err := store.DeleteObject(bucket, stagingKey); err != nil {
+			slog.Warn("failed to remove staged streamed output", "key", stagingKey, "err", err)
+		}
+	}()
+
+	details, err := converter.FFmpegStreamExecutor(ctx, cmd, duration, io.TeeReader(source, sourceChecksum), upload, onProgress)
+	if err == nil {
+		// INFO: FFmpeg may stop reading before the end of the source, drain it so the checksum covers all of it.
+		if _, err = io.Copy(sourceChecksum, source); err == nil {
+			err = sourceChecksum.Sum().Verify(sourceInfo)
+		}
+	}
+	if err == nil {
+		err = ctx.Err() // Cancelled after FFmpeg exited, the output must not be written
+	}
+	if err != nil {
+		return details, nil, err
+	}
+
+	opts.ChecksumSHA256 = outputChecksum.Sum().SHA256
+	if err := store.CopyObject(bucket, stagingKey, outputKey, opts); err != nil {
+		return details, nil, fmt.Errorf("error copying streamed output to %s: %w", outputKey, err)
+	}
+
+	return details, &StreamChecksums{Source: sourceChecksum.Sum(), Output: outputChecksum.Sum()}, nil
+}
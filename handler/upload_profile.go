@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"os"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+const defaultUploadProfile = "default"
+
+// UploadProfile holds the S3 object attributes used to upload the files of a collection.
+type UploadProfile struct {
+	ServerSideEncryption string            `json:"server_side_encryption"` // "AES256" (SSE-S3), "aws:kms" or "aws:kms:dsse" (SSE-KMS)
+	KMSKeyID             string            `json:"kms_key_id"`
+	CacheControl         string            `json:"cache_control"`
+	ContentDisposition   string            `json:"content_disposition"` // "inline" or "attachment", the filename is the original title
+	StorageClass         string            `json:"storage_class"`
+	Metadata             map[string]string `json:"metadata"` // Custom x-amz-meta-* entries
+	Tags                 map[string]string `json:"tags"`     // Extra tags, besides the document id, media type and preset
+}
+
+// LoadUploadProfile returns the upload profile of the collection from the UPLOAD_PROFILES environment variable,
+// a JSON object of profiles by collection name, the "default" profile is used for collections without one.
+// Returns an empty profile (content type only) if the variable is unset.
+func LoadUploadProfile(collectionName string) (UploadProfile, error) {
+	var profile UploadProfile
+
+	raw := os.Getenv("UPLOAD_PROFILES")
+	if raw == "" {
+		return profile, nil
+	}
+
+	var profiles map[string]UploadProfile
+	if err := json.Unmarshal([]byte(raw), &profiles); err != nil {
+		return profile, fmt.Errorf("failed to parse UPLOAD_PROFILES: %w", err)
+	}
+
+	profile, ok := profiles[collectionName]
+	if !ok {
+		profile = profiles[defaultUploadProfile]
+	}
+
+	return profile, profile.validate()
+}
+
+// PutOptions returns the options to upload a file of the document with the profile.
+// The file name is used in the Content-Disposition header, if the profile has one.
+func (p UploadProfile) PutOptions(contentType, fileName string, metadata map[string]string) storage.PutOptions {
+	tags := maps.Clone(p.Tags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	tags["document_id"] = metadata["id"]
+	tags["media_type"] = metadata["type"]
+	tags["preset"] = converter.Preset()
+
+	// INFO: The document id is also stored as metadata, it's used to detect output key collisions.
+	objectMetadata := maps.Clone(p.Metadata)
+	if objectMetadata == nil {
+		objectMetadata = make(map[string]string)
+	}
+	objectMetadata[documentIDMetadataKey] = metadata["id"]
+
+	var disposition string
+	if p.ContentDisposition != "" {
+		disposition = mime.FormatMediaType(p.ContentDisposition, map[string]string{"filename": fileName})
+	}
+
+	return storage.PutOptions{
+		ContentType:          contentType,
+		CacheControl:         p.CacheControl,
+		ContentDisposition:   disposition,
+		ServerSideEncryption: p.ServerSideEncryption,
+		KMSKeyID:             p.KMSKeyID,
+		StorageClass:         p.StorageClass,
+		Metadata:             objectMetadata,
+		Tags:                 tags,
+	}
+}
+
+// validate checks the values of the profile which S3 would reject.
+func (p UploadProfile) validate() error {
+	switch p.ServerSideEncryption {
+	case "", "AES256":
+		if p.KMSKeyID != "" {
+			return fmt.Errorf("upload profile has a KMS key id without SSE-KMS encryption")
+		}
+	case "aws:kms", "aws:kms:dsse":
+	default:
+		return fmt.Errorf("upload profile has an invalid server side encryption: %s", p.ServerSideEncryption)
+	}
+
+	switch p.ContentDisposition {
+	case "", "inline", "attachment":
+	default:
+		return fmt.Errorf("upload profile has an invalid content disposition: %s", p.ContentDisposition)
+	}
+
+	return nil
+}
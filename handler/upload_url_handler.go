@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+const (
+	metadataFileName               = "metadata.json"
+	defaultUploadURLExpiryMinutes  = 15
+	defaultUploadAuthDocumentClaim = "document_id"
+)
+
+var (
+	errUnauthenticated = errors.New("missing authorizer")
+	errForbidden       = errors.New("parent doesn't belong to the authorized document")
+)
+
+// contentExtRegex matches the extensions accepted for the source content.
+var contentExtRegex = regexp.MustCompile(`^[A-Za-z0-9]{1,10}$`)
+
+// UploadURLsRequest is the body of a request for presigned upload URLs of a conversion job.
+type UploadURLsRequest struct {
+	Parent       string `json:"parent"`      // Directory of the job, e.g. "<document id>/<document title>", defaults to the document ID
+	ContentExt   string `json:"content_ext"` // Extension of the source content, e.g. "mp3"
+	Lyrics       bool   `json:"lyrics"`
+	SyncedLyrics bool   `json:"synced_lyrics"`
+}
+
+// UploadURLsResponse holds the presigned PUT URLs by file: metadata, content, thumbnail and the optional lyrics.
+// INFO: The metadata file triggers the conversion, the client must upload it last.
+type UploadURLsResponse struct {
+	URLs      map[string]string `json:"urls"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// UploadURLsHandler creates presigned PUT URLs for the file layout of a conversion job in UPLOAD_BUCKET,
+// valid for PRESIGNED_PUT_EXPIRY_MINUTES. It's an API Gateway (HTTP API) or Lambda function URL handler,
+// so the upload clients don't need AWS credentials.
+// NOTE: The route must have a JWT, Lambda or IAM authorizer. The parent must be the document ID of the
+// authorizer (UPLOAD_AUTH_DOCUMENT_CLAIM) or a directory under it, IAM callers may use any parent.
+func UploadURLsHandler(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	documentID, err := authorizedDocumentID(request)
+	if err != nil {
+		slog.Warn("rejected upload URLs request", "request_id", request.RequestContext.RequestID, "err", err)
+		return jsonResponse(http.StatusUnauthorized, map[string]string{"error": "unauthorized"}), nil
+	}
+
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return jsonResponse(http.StatusBadRequest, map[string]string{"error": "invalid request body"}), nil
+		}
+		body = decoded
+	}
+
+	var req UploadURLsRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return jsonResponse(http.StatusBadRequest, map[string]string{"error": "invalid request body"}), nil
+	}
+
+	keys, err := req.uploadKeys(documentID)
+	if errors.Is(err, errForbidden) {
+		slog.Warn("rejected upload URLs request", "document_id", documentID, "parent", req.Parent, "err", err)
+		return jsonResponse(http.StatusForbidden, map[string]string{"error": err.Error()}), nil
+	}
+	if err != nil {
+		return jsonResponse(http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+	}
+
+	bucket := os.Getenv("UPLOAD_BUCKET")
+	expiry, err := presignExpiry("PRESIGNED_PUT_EXPIRY_MINUTES", defaultUploadURLExpiryMinutes)
+	if err == nil && (bucket == "" || expiry == 0) {
+		err = fmt.Errorf("UPLOAD_BUCKET and PRESIGNED_PUT_EXPIRY_MINUTES environment variables must be set")
+	}
+	if err != nil {
+		slog.Error("invalid upload URLs configuration", "err", err)
+		return jsonResponse(http.StatusInternalServerError, map[string]string{"error": "internal error"}), nil
+	}
+
+	store, err := NewObjectStore(ctx)
+	if err != nil {
+		slog.Error("failed to create object store", "err", err)
+		return jsonResponse(http.StatusInternalServerError, map[string]string{"error": "internal error"}), nil
+	}
+	presigner, ok := store.(storage.Presigner)
+	if !ok {
+		return jsonResponse(http.StatusNotImplemented, map[string]string{"error": "storage backend can't presign URLs"}), nil
+	}
+
+	resp := UploadURLsResponse{URLs: make(map[string]string), ExpiresAt: time.Now().Add(expiry)}
+	for name, key := range keys {
+		url, err := presigner.PresignPutObject(bucket, key, expiry)
+		if err != nil {
+			slog.Error("failed to presign upload URL", "key", key, "err", err)
+			return jsonResponse(http.StatusInternalServerError, map[string]string{"error": "internal error"}), nil
+		}
+		resp.URLs[name] = url
+	}
+
+	return jsonResponse(http.StatusOK, resp), nil
+}
+
+// authorizedDocumentID returns the document ID of the caller, from the JWT claim or Lambda authorizer context
+// key named by UPLOAD_AUTH_DOCUMENT_CLAIM. IAM callers aren't bound to a document, so their ID is empty.
+func authorizedDocumentID(request events.APIGatewayV2HTTPRequest) (string, error) {
+	authorizer := request.RequestContext.Authorizer
+	if authorizer == nil {
+		return "", errUnauthenticated
+	}
+	if authorizer.IAM != nil {
+		return "", nil
+	}
+
+	claim := os.Getenv("UPLOAD_AUTH_DOCUMENT_CLAIM")
+	if claim == "" {
+		claim = defaultUploadAuthDocumentClaim
+	}
+
+	var documentID string
+	if authorizer.JWT != nil {
+		documentID = authorizer.JWT.Claims[claim]
+	}
+	if value, ok := authorizer.Lambda[claim].(string); ok && documentID == "" {
+		documentID = value
+	}
+
+	documentID = strings.TrimSpace(documentID)
+	if documentID == "" || strings.Contains(documentID, "/") {
+		return "", fmt.Errorf("%w: no valid %q claim", errUnauthenticated, claim)
+	}
+	return documentID, nil
+}
+
+// uploadKeys returns the keys of the files of the job by name, following the layout expected by ParseEvent.
+// The parent must be the document ID or a directory under it, unless the document ID is empty (IAM caller).
+func (r UploadURLsRequest) uploadKeys(documentID string) (map[string]string, error) {
+	parent := r.Parent
+	if parent == "" {
+		parent = documentID
+	}
+
+	parent, err := canonicalKey(parent, defaultKeySegmentMaxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parent: %w", err)
+	}
+	if documentID != "" && parent != documentID && !strings.HasPrefix(parent, documentID+"/") {
+		return nil, errForbidden
+	}
+	if !contentExtRegex.MatchString(r.ContentExt) {
+		return nil, fmt.Errorf("invalid content_ext: %q", r.ContentExt)
+	}
+
+	keys := map[string]string{
+		"metadata":  parent + "/" + metadataFileName,
+		"content":   parent + "/content." + r.ContentExt,
+		"thumbnail": parent + "/" + os.Getenv("THUMBNAIL_SUFFIX"),
+	}
+	if r.Lyrics {
+		keys["lyrics"] = parent + "/" + os.Getenv("LYRICS_SUFFIX")
+	}
+	if r.SyncedLyrics {
+		keys["synced_lyrics"] = parent + "/" + os.Getenv("SYNCED_LYRICS_SUFFIX")
+	}
+
+	for name, key := range keys {
+		if len(key) > maxKeyBytes || key == parent+"/" {
+			return nil, fmt.Errorf("invalid key for %s: %q", name, key)
+		}
+	}
+	return keys, nil
+}
+
+// jsonResponse creates an HTTP response with the JSON encoded body.
+func jsonResponse(statusCode int, body any) events.APIGatewayV2HTTPResponse {
+	data, err := json.Marshal(body)
+	if err != nil {
+		statusCode, data = http.StatusInternalServerError, []byte(`{"error":"internal error"}`)
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(data),
+	}
+}
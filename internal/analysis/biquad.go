@@ -0,0 +1,52 @@
+package analysis
+
+import "math"
+
+// biquad is a second order IIR filter, in transposed direct form II.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the two stages of the BS.1770 K-weighting filter for the sample rate.
+// INFO: The standard only gives the coefficients for 48 kHz, the analog prototypes (as derived by libebur128)
+// are used to get them for any sample rate.
+func kWeighting(sampleRate float64) (shelf, highPass biquad) {
+	const (
+		shelfFrequency    = 1681.974450955533
+		shelfGain         = 3.999843853973347 // dB
+		shelfQ            = 0.7071752369554196
+		highPassFrequency = 38.13547087602444
+		highPassQ         = 0.5003270373238773
+	)
+
+	k := math.Tan(math.Pi * shelfFrequency / sampleRate)
+	vh := math.Pow(10, shelfGain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/shelfQ + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/shelfQ + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/shelfQ + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/shelfQ + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * highPassFrequency / sampleRate)
+	a0 = 1 + k/highPassQ + k*k
+	highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/highPassQ + k*k) / a0,
+	}
+	return shelf, highPass
+}
@@ -0,0 +1,58 @@
+package analysis
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// spectrum computes the magnitude spectrum (bins 0 to size/2) of a real frame with a Hann window, size being a power of 2.
+type spectrum struct {
+	window []float64
+	buffer []complex128
+}
+
+func newSpectrum(size int) *spectrum {
+	s := &spectrum{window: make([]float64, size), buffer: make([]complex128, size)}
+	for i := range s.window {
+		s.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+	}
+	return s
+}
+
+// magnitudes writes the magnitudes of the frame into dst, which must have size/2+1 elements.
+func (s *spectrum) magnitudes(frame, dst []float64) {
+	for i, x := range frame {
+		s.buffer[i] = complex(x*s.window[i], 0)
+	}
+	fft(s.buffer)
+	for i := range dst {
+		dst[i] = cmplx.Abs(s.buffer[i])
+	}
+}
+
+// fft computes the discrete Fourier transform in place, with the iterative radix 2 algorithm.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := range size / 2 {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package analysis
+
+import "math"
+
+const (
+	minChromaFrequency = 65.4 // Hz, C2
+	maxChromaFrequency = 2093 // Hz, C7
+	chromaSilence      = 1e-3 // Frames with less magnitude are not counted
+)
+
+var (
+	// Pitch classes in the ID3 TKEY notation, from C.
+	pitchClasses = [12]string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+
+	// Krumhansl-Kessler key profiles, from the tonic.
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// chromaFrame adds the magnitudes of the frame to the chroma, each bin to the pitch class of its frequency.
+// INFO: Each frame is normalized, so the key is not decided by the loud parts only.
+func (a *MusicAnalyzer) chromaFrame(frame []float64) {
+	a.chromaFFT.magnitudes(frame, a.chromaMags)
+
+	var chroma [12]float64
+	var total float64
+	binWidth := float64(MusicSampleRate) / chromaFrameSize
+	for i := int(minChromaFrequency / binWidth); i < len(a.chromaMags); i++ {
+		frequency := float64(i) * binWidth
+		if frequency < minChromaFrequency {
+			continue
+		}
+		if frequency > maxChromaFrequency {
+			break
+		}
+		note := int(math.Round(12*math.Log2(frequency/440))) + 69 // MIDI note number
+		chroma[note%12] += a.chromaMags[i]
+		total += a.chromaMags[i]
+	}
+	if total < chromaSilence {
+		return
+	}
+
+	for i := range chroma {
+		a.chroma[i] += chroma[i] / total
+	}
+}
+
+// estimateKey returns the key which profile best correlates with the chroma and the confidence,
+// the correlation of the key.
+func estimateKey(chroma [12]float64) (string, float64) {
+	var key string
+	best := math.Inf(-1)
+	for tonic := range 12 {
+		for _, mode := range []struct {
+			profile *[12]float64
+			suffix  string
+		}{{&majorProfile, ""}, {&minorProfile, "m"}} {
+			var rotated [12]float64
+			for i := range rotated {
+				rotated[(i+tonic)%12] = mode.profile[i]
+			}
+			if r := correlation(chroma, rotated); r > best {
+				key, best = pitchClasses[tonic]+mode.suffix, r
+			}
+		}
+	}
+
+	if math.IsNaN(best) || math.IsInf(best, -1) {
+		return "", 0 // No pitched content, the chroma is flat
+	}
+	return key, math.Min(math.Max(best, 0), 1)
+}
+
+// correlation returns the Pearson correlation of the values, NaN if one of them is constant.
+func correlation(x, y [12]float64) float64 {
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i] / 12
+		meanY += y[i] / 12
+	}
+
+	var covariance, varianceX, varianceY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		covariance += dx * dy
+		varianceX += dx * dx
+		varianceY += dy * dy
+	}
+	if varianceX == 0 || varianceY == 0 {
+		return math.NaN()
+	}
+	return covariance / math.Sqrt(varianceX*varianceY)
+}
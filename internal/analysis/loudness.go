@@ -0,0 +1,180 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+	"slices"
+)
+
+const (
+	absoluteGate        = -70.0 // LUFS, also the loudness reported for silence
+	integratedGate      = -10.0 // LU, relative to the absolute gated loudness
+	rangeGate           = -20.0 // LU, relative to the absolute gated short-term loudness
+	momentarySubBlocks  = 4     // 400 ms blocks of the integrated loudness
+	shortTermSubBlocks  = 30    // 3 s windows of the short-term loudness
+	subBlocksPerSecond  = 10    // The blocks overlap by 75%, a new block starts every 100 ms
+	rangeLowPercentile  = 0.10
+	rangeHighPercentile = 0.95
+)
+
+// Loudness is the ITU-R BS.1770 / EBU R128 measurement of a signal.
+type Loudness struct {
+	Integrated   float64 // LUFS
+	ShortTermMax float64 // LUFS, loudest 3 s window
+	Range        float64 // LU (LRA), between the 10th and 95th percentiles of the short-term loudness
+	TruePeak     float64 // dBTP
+}
+
+// LoudnessMeter measures the loudness of an interleaved 32 bits float signal written to it.
+type LoudnessMeter struct {
+	channels []*channelFilter
+	weights  []float64 // BS.1770 channel weights, 0 for the LFE
+	peak     *truePeakMeter
+
+	channel      int // Channel of the next sample, the samples may be written in chunks of any size
+	subBlockSize int // Frames in 100 ms
+	frames       int // Frames in the current sub-block
+	energy       float64
+	subBlocks    []float64 // Mean square of the last sub-blocks, up to a short-term window
+	momentary    []float64 // Mean square of each 400 ms block
+	shortTerm    []float64 // Mean square of each 3 s window
+}
+
+// channelFilter is the K-weighting of a channel: a high shelf (head effects) and the RLB high pass.
+type channelFilter struct {
+	shelf, highPass biquad
+}
+
+// NewLoudnessMeter creates a meter for a signal with the sample rate and channels. A 6 channels signal is
+// taken as 5.1 (L, R, C, LFE, Ls, Rs), the others have all channels with the same weight.
+func NewLoudnessMeter(sampleRate, channels int) (*LoudnessMeter, error) {
+	if sampleRate < subBlocksPerSecond || channels <= 0 {
+		return nil, errors.New("invalid sample rate or channels")
+	}
+
+	m := &LoudnessMeter{
+		weights:      make([]float64, channels),
+		peak:         newTruePeakMeter(sampleRate, channels),
+		subBlockSize: sampleRate / subBlocksPerSecond,
+	}
+	shelf, highPass := kWeighting(float64(sampleRate))
+	for i := range channels {
+		m.channels = append(m.channels, &channelFilter{shelf: shelf, highPass: highPass})
+		m.weights[i] = 1
+	}
+	if channels == 6 {
+		m.weights[3], m.weights[4], m.weights[5] = 0, 1.41, 1.41
+	}
+	return m, nil
+}
+
+// Write measures the interleaved samples.
+func (m *LoudnessMeter) Write(samples []float32) {
+	for _, sample := range samples {
+		x := float64(sample)
+		m.peak.process(m.channel, x)
+
+		filter := m.channels[m.channel]
+		z := filter.highPass.process(filter.shelf.process(x))
+		m.energy += m.weights[m.channel] * z * z
+
+		m.channel++
+		if m.channel < len(m.channels) {
+			continue
+		}
+		m.channel = 0
+		m.frames++
+		if m.frames == m.subBlockSize {
+			m.endSubBlock()
+		}
+	}
+}
+
+// endSubBlock stores the 100 ms sub-block and the 400 ms block and 3 s window which end with it.
+func (m *LoudnessMeter) endSubBlock() {
+	m.subBlocks = append(m.subBlocks, m.energy/float64(m.subBlockSize))
+	if len(m.subBlocks) > shortTermSubBlocks {
+		m.subBlocks = m.subBlocks[1:]
+	}
+	m.energy, m.frames = 0, 0
+
+	if n := len(m.subBlocks); n >= momentarySubBlocks {
+		m.momentary = append(m.momentary, mean(m.subBlocks[n-momentarySubBlocks:]))
+	}
+	if len(m.subBlocks) == shortTermSubBlocks {
+		m.shortTerm = append(m.shortTerm, mean(m.subBlocks))
+	}
+}
+
+// Loudness returns the measurement of the samples written so far. The loudness of a silent or too short signal
+// is the absolute gate (-70 LUFS).
+func (m *LoudnessMeter) Loudness() Loudness {
+	result := Loudness{
+		Integrated:   absoluteGate,
+		ShortTermMax: absoluteGate,
+		TruePeak:     m.peak.dBTP(),
+	}
+
+	if gated := gate(m.momentary, integratedGate); len(gated) > 0 {
+		result.Integrated = loudness(mean(gated))
+	}
+	for _, energy := range m.shortTerm {
+		result.ShortTermMax = max(result.ShortTermMax, loudness(energy))
+	}
+
+	// INFO: The range is the spread of the short-term loudness, without the silences and the quiet parts
+	// (EBU Tech 3342).
+	if gated := gate(m.shortTerm, rangeGate); len(gated) > 1 {
+		levels := make([]float64, len(gated))
+		for i, energy := range gated {
+			levels[i] = loudness(energy)
+		}
+		slices.Sort(levels)
+		result.Range = percentile(levels, rangeHighPercentile) - percentile(levels, rangeLowPercentile)
+	}
+	return result
+}
+
+// gate returns the blocks above the absolute gate and the relative one, which is relative to the loudness
+// of the blocks above the absolute gate.
+func gate(blocks []float64, relative float64) []float64 {
+	var absolute []float64
+	for _, energy := range blocks {
+		if loudness(energy) > absoluteGate {
+			absolute = append(absolute, energy)
+		}
+	}
+	if len(absolute) == 0 {
+		return nil
+	}
+
+	threshold := loudness(mean(absolute)) + relative
+	var gated []float64
+	for _, energy := range absolute {
+		if loudness(energy) > threshold {
+			gated = append(gated, energy)
+		}
+	}
+	return gated
+}
+
+// loudness converts a weighted mean square to LUFS.
+func loudness(energy float64) float64 {
+	if energy <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(energy)
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// percentile returns the nearest rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	return sorted[int(math.Round(p*float64(len(sorted)-1)))]
+}
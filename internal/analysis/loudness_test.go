@@ -0,0 +1,135 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+const testSampleRate = 48000
+
+// segment is a part of a test signal: a sine on all channels, at a level in dBFS (peak) for a duration.
+type segment struct {
+	level   float64 // dBFS, -inf for silence
+	seconds float64
+}
+
+// writeSine writes a stereo sine of the frequency and phase (radians) made of the segments to the meter, in
+// chunks of 1000 samples so the sub-blocks span several writes.
+func writeSine(m *LoudnessMeter, frequency, phase float64, segments ...segment) {
+	const channels = 2
+	chunk := make([]float32, 0, 1000)
+	n := 0
+	for _, s := range segments {
+		amplitude := math.Pow(10, s.level/20)
+		for range int(s.seconds * testSampleRate) {
+			x := float32(amplitude * math.Sin(2*math.Pi*frequency*float64(n)/testSampleRate+phase))
+			for range channels {
+				chunk = append(chunk, x)
+			}
+			if len(chunk) == cap(chunk) {
+				m.Write(chunk)
+				chunk = chunk[:0]
+			}
+			n++
+		}
+	}
+	m.Write(chunk)
+}
+
+func newTestMeter(t *testing.T) *LoudnessMeter {
+	t.Helper()
+	m, err := NewLoudnessMeter(testSampleRate, 2)
+	if err != nil {
+		t.Fatalf("NewLoudnessMeter: %v", err)
+	}
+	return m
+}
+
+// The integrated loudness cases of EBU Tech 3341 (minimum requirements), stereo 1 kHz sines.
+func TestLoudnessIntegrated(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []segment
+		want     float64
+	}{
+		{"case 1: -23 dBFS", []segment{{-23, 20}}, -23},
+		{"case 2: -33 dBFS", []segment{{-33, 20}}, -33},
+		{"case 3: relative gate", []segment{{-36, 10}, {-23, 60}, {-36, 10}}, -23},
+		{"case 4: absolute and relative gates", []segment{{-72, 10}, {-36, 10}, {-23, 60}, {-36, 10}, {-72, 10}}, -23},
+		{"silence", []segment{{math.Inf(-1), 5}}, absoluteGate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMeter(t)
+			writeSine(m, 1000, 0, tt.segments...)
+
+			if got := m.Loudness().Integrated; math.Abs(got-tt.want) > 0.1 {
+				t.Errorf("integrated loudness = %.2f LUFS, want %.1f ±0.1", got, tt.want)
+			}
+		})
+	}
+}
+
+// The loudness range cases of EBU Tech 3342, stereo 1 kHz sines of 20 s at each level.
+func TestLoudnessRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []float64
+		want   float64
+	}{
+		{"case 1: -20 and -30 dBFS", []float64{-20, -30}, 10},
+		{"case 2: -20 and -15 dBFS", []float64{-20, -15}, 5},
+		{"case 3: -40 and -20 dBFS", []float64{-40, -20}, 20},
+		{"case 4: -50 to -20 dBFS and back", []float64{-50, -35, -20, -35, -50}, 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := make([]segment, len(tt.levels))
+			for i, level := range tt.levels {
+				segments[i] = segment{level, 20}
+			}
+
+			m := newTestMeter(t)
+			writeSine(m, 1000, 0, segments...)
+
+			if got := m.Loudness().Range; math.Abs(got-tt.want) > 1 {
+				t.Errorf("loudness range = %.2f LU, want %.0f ±1", got, tt.want)
+			}
+		})
+	}
+}
+
+// The true peak of EBU Tech 3341 allows +0.2/-0.4 dB of error. A sine at a quarter of the sample rate with a
+// phase of 45° has its peaks between the samples, which are at -3.01 dB of them.
+func TestLoudnessTruePeak(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency float64
+		phase     float64
+		level     float64
+		want      float64
+	}{
+		{"peak on the samples", 1000, 0, -6, -6},
+		{"inter-sample peak at fs/4", testSampleRate / 4, math.Pi / 4, 0, 0},
+		{"inter-sample peak at fs/4 below full scale", testSampleRate / 4, math.Pi / 4, -12, -12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMeter(t)
+			writeSine(m, tt.frequency, tt.phase, segment{tt.level, 5})
+
+			if got := m.Loudness().TruePeak; got > tt.want+0.2 || got < tt.want-0.4 {
+				t.Errorf("true peak = %.2f dBTP, want %.1f +0.2/-0.4", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("silence", func(t *testing.T) {
+		m := newTestMeter(t)
+		writeSine(m, 1000, 0, segment{math.Inf(-1), 1})
+
+		if got := m.Loudness().TruePeak; got != truePeakFloor {
+			t.Errorf("true peak of silence = %.2f dBTP, want %.0f", got, truePeakFloor)
+		}
+	})
+}
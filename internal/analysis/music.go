@@ -0,0 +1,78 @@
+package analysis
+
+// MusicSampleRate is the sample rate of the mono signal written to a MusicAnalyzer.
+const MusicSampleRate = 22050
+
+const (
+	onsetFrameSize  = 1024
+	onsetHopSize    = 256  // ~86 onset frames per second
+	chromaFrameSize = 8192 // ~2.7 Hz bins, to separate the semitones of the low notes
+	chromaEvery     = 8    // Onset hops between two chroma frames
+)
+
+// MusicAnalysis is the tempo and the key estimated from a signal.
+type MusicAnalysis struct {
+	BPM           float64 // 0 if the signal has no steady beat
+	BPMConfidence float64 // 0 to 1
+	Key           string  // In the ID3 TKEY notation, e.g. "C", "F#m", empty if the signal has no pitched content
+	KeyConfidence float64 // 0 to 1
+}
+
+// MusicAnalyzer estimates the tempo and the key of a mono signal at MusicSampleRate written to it.
+// The tempo is the period of the onset strength (spectral flux) with the strongest autocorrelation, and the key
+// is the major or minor profile which best correlates with the chroma (energy of each pitch class).
+type MusicAnalyzer struct {
+	buffer     []float64 // Last samples, at least the size of a chroma frame once it's full
+	sinceHop   int
+	hops       int
+	onsetFFT   *spectrum
+	chromaFFT  *spectrum
+	magnitudes []float64
+	previous   []float64 // Log magnitudes of the previous onset frame
+	onsets     []float64 // Onset strength of each onset frame
+	chroma     [12]float64
+	chromaMags []float64
+}
+
+// NewMusicAnalyzer creates an analyzer for a mono signal at MusicSampleRate.
+func NewMusicAnalyzer() *MusicAnalyzer {
+	return &MusicAnalyzer{
+		buffer:     make([]float64, 0, 2*chromaFrameSize),
+		onsetFFT:   newSpectrum(onsetFrameSize),
+		chromaFFT:  newSpectrum(chromaFrameSize),
+		magnitudes: make([]float64, onsetFrameSize/2+1),
+		previous:   make([]float64, onsetFrameSize/2+1),
+		chromaMags: make([]float64, chromaFrameSize/2+1),
+	}
+}
+
+// Write analyzes the samples.
+func (a *MusicAnalyzer) Write(samples []float32) {
+	for _, sample := range samples {
+		a.buffer = append(a.buffer, float64(sample))
+		a.sinceHop++
+		if a.sinceHop < onsetHopSize {
+			continue
+		}
+		a.sinceHop = 0
+		a.hops++
+
+		if len(a.buffer) >= onsetFrameSize {
+			a.onsetFrame(a.buffer[len(a.buffer)-onsetFrameSize:])
+		}
+		if a.hops%chromaEvery == 0 && len(a.buffer) >= chromaFrameSize {
+			a.chromaFrame(a.buffer[len(a.buffer)-chromaFrameSize:])
+		}
+		if len(a.buffer) == cap(a.buffer) {
+			a.buffer = a.buffer[:copy(a.buffer, a.buffer[len(a.buffer)-chromaFrameSize:])]
+		}
+	}
+}
+
+// Analysis returns the estimation from the samples written so far.
+func (a *MusicAnalyzer) Analysis() MusicAnalysis {
+	var result MusicAnalysis
+	result.BPM, result.BPMConfidence = estimateTempo(a.onsets, float64(MusicSampleRate)/onsetHopSize)
+	result.Key, result.KeyConfidence = estimateKey(a.chroma)
+	return result
+}
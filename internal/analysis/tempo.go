@@ -0,0 +1,96 @@
+package analysis
+
+import "math"
+
+const (
+	minBPM              = 60.0
+	maxBPM              = 200.0
+	preferredBPM        = 120.0 // Center of the tempo prior, which resolves the half and double tempo ambiguity
+	tempoPriorOctaves   = 1.0   // Standard deviation of the prior
+	minTempoSeconds     = 5.0   // Shorter signals have no tempo
+	onsetMeanWindowSecs = 1.0
+	onsetCompression    = 1000.0
+)
+
+// onsetFrame appends the onset strength of the frame: the increase of its log magnitudes from the previous frame.
+func (a *MusicAnalyzer) onsetFrame(frame []float64) {
+	a.onsetFFT.magnitudes(frame, a.magnitudes)
+
+	var flux float64
+	for i, magnitude := range a.magnitudes {
+		level := math.Log1p(onsetCompression * magnitude)
+		flux += max(level-a.previous[i], 0)
+		a.previous[i] = level
+	}
+	if len(a.onsets) == 0 {
+		flux = 0 // The first frame has no previous one
+	}
+	a.onsets = append(a.onsets, flux)
+}
+
+// estimateTempo returns the tempo of the onset strength (frames per second at the rate) and the confidence,
+// the autocorrelation at the beat period relative to the one at lag 0.
+func estimateTempo(onsets []float64, rate float64) (float64, float64) {
+	if float64(len(onsets)) < minTempoSeconds*rate {
+		return 0, 0
+	}
+
+	// INFO: Only the onsets above the local mean are kept, so the slow changes of level don't correlate.
+	envelope := make([]float64, len(onsets))
+	window := int(onsetMeanWindowSecs * rate)
+	var sum float64
+	for i := range onsets {
+		sum += onsets[i]
+		if i >= window {
+			sum -= onsets[i-window]
+		}
+		envelope[i] = max(onsets[i]-sum/float64(min(i+1, window)), 0)
+	}
+
+	minLag := int(math.Floor(60 * rate / maxBPM))
+	maxLag := int(math.Ceil(60 * rate / minBPM))
+	acf := make([]float64, 2*maxLag+2)
+	for lag := range acf {
+		acf[lag] = autocorrelation(envelope, lag)
+	}
+	if acf[0] == 0 {
+		return 0, 0
+	}
+
+	// INFO: The multiple of the period is added, a beat also correlates at two beats.
+	bestLag, bestScore := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		bpm := 60 * rate / float64(lag)
+		prior := math.Exp(-0.5 * math.Pow(math.Log2(bpm/preferredBPM)/tempoPriorOctaves, 2))
+		score := prior * (acf[lag] + acf[2*lag]/2)
+		if score > bestScore {
+			bestLag, bestScore = lag, score
+		}
+	}
+	if bestLag == 0 {
+		return 0, 0
+	}
+
+	// INFO: The period is refined between the lags with a parabola through the peak and its neighbors.
+	lag := float64(bestLag)
+	left, center, right := acf[bestLag-1], acf[bestLag], acf[bestLag+1]
+	if denominator := left - 2*center + right; denominator < 0 {
+		lag += 0.5 * (left - right) / denominator
+	}
+
+	bpm := math.Round(600*rate/lag) / 10
+	confidence := math.Min(math.Max(acf[bestLag]/acf[0], 0), 1)
+	return bpm, confidence
+}
+
+// autocorrelation returns the mean of the products of the values lag apart.
+func autocorrelation(values []float64, lag int) float64 {
+	if lag >= len(values) {
+		return 0
+	}
+	var sum float64
+	for i := lag; i < len(values); i++ {
+		sum += values[i] * values[i-lag]
+	}
+	return sum / float64(len(values)-lag)
+}
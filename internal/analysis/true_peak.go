@@ -0,0 +1,83 @@
+package analysis
+
+import "math"
+
+const (
+	truePeakTapsPerPhase = 12
+	truePeakTargetRate   = 192000 // Hz, the signal is oversampled up to it
+	truePeakFloor        = -144.0 // dBTP reported for silence, below the noise floor of 24 bits
+)
+
+// truePeakMeter measures the peak of the signal oversampled with a polyphase windowed sinc filter
+// (BS.1770 Annex 2), which finds the inter-sample peaks of a reconstructed signal.
+type truePeakMeter struct {
+	phases  [][]float64 // Taps of each phase, normalized to unity gain
+	history [][]float64 // Last samples of each channel, the newest first
+	peak    float64     // Linear
+}
+
+func newTruePeakMeter(sampleRate, channels int) *truePeakMeter {
+	factor := max(truePeakTargetRate/sampleRate, 1)
+	if factor > 4 {
+		factor = 4
+	}
+
+	m := &truePeakMeter{history: make([][]float64, channels)}
+	for i := range channels {
+		m.history[i] = make([]float64, truePeakTapsPerPhase)
+	}
+
+	// INFO: A windowed sinc low pass at the original Nyquist frequency, split into one phase for
+	// each oversampled position between two samples.
+	taps := truePeakTapsPerPhase * factor
+	center := float64(taps-1) / 2
+	for phase := range factor {
+		coefficients := make([]float64, truePeakTapsPerPhase)
+		var sum float64
+		for k := range truePeakTapsPerPhase {
+			n := float64(phase + k*factor)
+			t := (n - center) / float64(factor)
+			window := 0.5 - 0.5*math.Cos(2*math.Pi*(n+0.5)/float64(taps))
+			coefficients[k] = sinc(t) * window
+			sum += coefficients[k]
+		}
+		for k := range coefficients {
+			coefficients[k] /= sum
+		}
+		m.phases = append(m.phases, coefficients)
+	}
+	return m
+}
+
+func (m *truePeakMeter) process(channel int, x float64) {
+	history := m.history[channel]
+	copy(history[1:], history[:len(history)-1])
+	history[0] = x
+
+	m.peak = max(m.peak, math.Abs(x))
+	if len(m.phases) == 1 {
+		return
+	}
+	for _, coefficients := range m.phases {
+		var y float64
+		for k, coefficient := range coefficients {
+			y += coefficient * history[k]
+		}
+		m.peak = max(m.peak, math.Abs(y))
+	}
+}
+
+// dBTP returns the true peak relative to the full scale.
+func (m *truePeakMeter) dBTP() float64 {
+	if m.peak == 0 {
+		return truePeakFloor
+	}
+	return max(20*math.Log10(m.peak), truePeakFloor)
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -26,8 +26,22 @@ type FFmpegCommand struct {
 
 const (
 	processedFileName = "processed_file"
+
+	// StdinInput is the content path used on streaming mode, the content is read from the stdin of FFmpeg
+	// and the output is written to its stdout, so the progress is written to the extra file descriptor 3.
+	StdinInput     = "pipe:0"
+	stdoutOutput   = "pipe:1"
+	progressOutput = "pipe:3"
 )
 
+// streamMuxers maps the audio formats which can be written to a non seekable output to their FFmpeg muxer.
+// INFO: mp4 based formats (m4a, mp4) need a seekable output to write the moov atom (faststart), and the adts, ogg
+// and opus muxers can't hold the cover stream, which is always mapped.
+var streamMuxers = map[string]string{
+	"mp3":  "mp3",
+	"flac": "flac",
+}
+
 // NewFFmpegCommand creates a new FFmpegCommand with default values.
 func NewFFmpegCommand(inputsPaths, metadataMap map[string]string, requiredKeys []string) (*FFmpegCommand, error) {
 	ffmpegBinPath := os.Getenv("FFMPEG_BIN_PATH")
@@ -56,7 +70,7 @@ func NewFFmpegCommand(inputsPaths, metadataMap map[string]string, requiredKeys [
 
 	outputPath := filepath.Join(utils.GetWorkDir(), processedFileName+"."+audioFormat)
 
-	return &FFmpegCommand{
+	command := &FFmpegCommand{
 		GlobalOptions: []string{ffmpegBinPath, "-y", "-progress", "pipe:1", "-nostats"},
 		Inputs:        []string{"-i", absPaths["content"], "-i", absPaths["thumbnail"]},
 		Filter:        []string{"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2"},
@@ -65,7 +79,57 @@ func NewFFmpegCommand(inputsPaths, metadataMap map[string]string, requiredKeys [
 		Metadata:      metadataArr,
 		Flags:         []string{"-movflags", "faststart"},
 		Output:        outputPath,
-	}, nil
+	}
+
+	// INFO: The sample rate and channels are only set when configured, they are part of the preset.
+	// CopyAudio replaces the codec options, a copied audio keeps them.
+	if sampleRate := os.Getenv("AUDIO_SAMPLE_RATE"); sampleRate != "" {
+		command.Codec = append(command.Codec, "-ar", sampleRate)
+	}
+	if channels := os.Getenv("AUDIO_CHANNELS"); channels != "" {
+		command.Codec = append(command.Codec, "-ac", channels)
+	}
+
+	if absPaths["content"] == StdinInput {
+		muxer, ok := StreamMuxer(audioFormat)
+		if !ok {
+			return nil, fmt.Errorf("audio format %s can't be streamed", audioFormat)
+		}
+		command.GlobalOptions = []string{ffmpegBinPath, "-y", "-progress", progressOutput, "-nostats"}
+		command.Flags = []string{"-f", muxer}
+		command.Output = stdoutOutput
+	}
+
+	return command, nil
+}
+
+// Preset returns the name of the effective encode preset, from the audio codec and format, e.g. "aac-m4a",
+// with the sample rate and channels if they are set, e.g. "aac-m4a-44100hz-2ch".
+func Preset() string {
+	preset := fmt.Sprintf("%s-%s", os.Getenv("AUDIO_CODEC"), os.Getenv("AUDIO_FORMAT"))
+	if sampleRate := os.Getenv("AUDIO_SAMPLE_RATE"); sampleRate != "" {
+		preset += "-" + sampleRate + "hz"
+	}
+	if channels := os.Getenv("AUDIO_CHANNELS"); channels != "" {
+		preset += "-" + channels + "ch"
+	}
+	return preset
+}
+
+// StreamMuxer returns the FFmpeg muxer to write the audio format to a non seekable output,
+// returns false if the format needs a seekable output.
+func StreamMuxer(audioFormat string) (string, bool) {
+	muxer, ok := streamMuxers[strings.ToLower(audioFormat)]
+	return muxer, ok
+}
+
+// CopyAudio copies the audio stream of the content instead of encoding it, so only the metadata and the cover
+// are replaced. The content must already be an output of the same preset.
+// INFO: The global and stream metadata of the content are not copied, so the tags removed from the document
+// (e.g. the lyrics or an old title) don't survive the remux. The replay gain is written again after it.
+func (c *FFmpegCommand) CopyAudio() {
+	c.Codec = []string{"-c:a", "copy"}
+	c.Metadata = append([]string{"-map_metadata", "-1", "-map_metadata:s:a", "-1"}, c.Metadata...)
 }
 
 // GetOutputFilePath returns the output file path of the FFmpeg command.
@@ -82,6 +146,13 @@ func (c *FFmpegCommand) AddMetadataFromMap(keys []string, metadataMap map[string
 	}
 }
 
+// AddMetadata adds a single metadata entry to the FFmpeg command, empty values are ignored.
+func (c *FFmpegCommand) AddMetadata(key, value string) {
+	if value != "" {
+		c.Metadata = append(c.Metadata, "-metadata", fmt.Sprintf("%s=%s", key, value))
+	}
+}
+
 // BuildCommand constructs the FFmpeg command as a slice of strings.
 func (c *FFmpegCommand) BuildCommand() []string {
 	command := append(c.GlobalOptions, c.Inputs...)
@@ -113,6 +184,11 @@ func parseToAbsPaths(inputPaths map[string]string) (map[string]string, error) {
 			return nil, fmt.Errorf("path for %s is empty", key)
 		}
 
+		if strings.HasPrefix(path, "pipe:") {
+			absPaths[key] = path
+			continue
+		}
+
 		absPath, err := filepath.Abs(path)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get absolute path for %s: %v", key, err)
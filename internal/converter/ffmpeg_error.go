@@ -0,0 +1,186 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+const (
+	stderrTailLines    = 20  // Lines of the stderr of FFmpeg kept for the errors
+	stderrMaxLineBytes = 512 // Longer lines are truncated
+)
+
+// ErrorCode classifies the failure of an FFmpeg command.
+type ErrorCode string
+
+const (
+	ErrCodeInvalidData      ErrorCode = "INVALID_DATA"
+	ErrCodeUnsupportedCodec ErrorCode = "UNSUPPORTED_CODEC"
+	ErrCodeMissingStream    ErrorCode = "MISSING_STREAM"
+	ErrCodeDiskFull         ErrorCode = "DISK_FULL"
+	ErrCodePermissionDenied ErrorCode = "PERMISSION_DENIED"
+	ErrCodeTimeout          ErrorCode = "TIMEOUT"
+	ErrCodeCancelled        ErrorCode = "CANCELLED"
+	ErrCodeInvalidInput     ErrorCode = "INVALID_INPUT" // Rejected by the input validation, FFmpeg didn't run
+	ErrCodeUnknown          ErrorCode = "UNKNOWN"
+)
+
+// Retryable reports whether a job which failed with the code may succeed when retried with the same inputs.
+func (c ErrorCode) Retryable() bool {
+	switch c {
+	case ErrCodeInvalidData, ErrCodeUnsupportedCodec, ErrCodeMissingStream, ErrCodeInvalidInput, ErrCodeOutputMismatch:
+		return false
+	}
+	return true
+}
+
+// errorSignatures maps the messages of FFmpeg to the error codes, the first match wins.
+// INFO: The system errors go first, FFmpeg often reports them after a generic message about the input or output.
+var errorSignatures = []struct {
+	code     ErrorCode
+	messages []string
+}{
+	{ErrCodeDiskFull, []string{"No space left on device", "Disk quota exceeded"}},
+	{ErrCodePermissionDenied, []string{"Permission denied", "Operation not permitted"}},
+	{ErrCodeUnsupportedCodec, []string{"Unknown decoder", "Unknown encoder", "Decoder not found", "Encoder not found",
+		"not currently supported", "Unsupported codec", "Could not find tag for codec", "codec not supported"}},
+	{ErrCodeMissingStream, []string{"matches no streams", "does not contain any stream", "Output file is empty",
+		"Could not find codec parameters", "no audio stream"}},
+	{ErrCodeInvalidData, []string{"Invalid data found when processing input", "moov atom not found",
+		"Error while decoding stream", "could not find sync word", "Header missing"}},
+}
+
+// CodedError is implemented by the errors of the converter classified with an ErrorCode.
+type CodedError interface {
+	error
+	ErrorCode() ErrorCode
+}
+
+// FFmpegError is the error of a failed FFmpeg command, with the last lines of its stderr.
+type FFmpegError struct {
+	Code   ErrorCode
+	Stderr []string
+	Err    error
+}
+
+// Error returns the code, the error and the last line of the stderr.
+func (e *FFmpegError) Error() string {
+	msg := fmt.Sprintf("ffmpeg failed (%s): %v", e.Code, e.Err)
+	if len(e.Stderr) > 0 {
+		msg += ": " + e.Stderr[len(e.Stderr)-1]
+	}
+	return msg
+}
+
+func (e *FFmpegError) Unwrap() error {
+	return e.Err
+}
+
+func (e *FFmpegError) ErrorCode() ErrorCode {
+	return e.Code
+}
+
+// ErrorDetails returns the code of the CodedError wrapped by err and the last lines of the stderr if it's an FFmpeg
+// error, ErrCodeUnknown and nil if it doesn't wrap one.
+func ErrorDetails(err error) (ErrorCode, []string) {
+	var coded CodedError
+	if !errors.As(err, &coded) {
+		return ErrCodeUnknown, nil
+	}
+
+	var ffmpegErr *FFmpegError
+	if errors.As(err, &ffmpegErr) {
+		return coded.ErrorCode(), ffmpegErr.Stderr
+	}
+	return coded.ErrorCode(), nil
+}
+
+// newFFmpegError classifies the error of the command from its context if it was cancelled or timed out,
+// otherwise from its stderr.
+func newFFmpegError(ctx context.Context, err error, stderr []string) *FFmpegError {
+	ffmpegErr := &FFmpegError{Code: classifyStderr(stderr), Stderr: stderr, Err: err}
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		ffmpegErr.Code = ErrCodeCancelled
+	case ffmpegErr.Code == ErrCodeUnknown && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		ffmpegErr.Code = ErrCodeTimeout
+	}
+	return ffmpegErr
+}
+
+// classifyStderr returns the code of the first signature found in the stderr lines.
+func classifyStderr(stderr []string) ErrorCode {
+	for _, signature := range errorSignatures {
+		for _, line := range stderr {
+			for _, message := range signature.messages {
+				if strings.Contains(line, message) {
+					return signature.code
+				}
+			}
+		}
+	}
+	return ErrCodeUnknown
+}
+
+// stderrTail is an io.Writer keeping the last lines written to it, to be set as the stderr of a command.
+type stderrTail struct {
+	mu      sync.Mutex
+	lines   []string // Ring buffer, next is the index of the oldest line once it's full
+	next    int
+	partial []byte
+}
+
+func newStderrTail() *stderrTail {
+	return &stderrTail{lines: make([]string, 0, stderrTailLines)}
+}
+
+// Write splits the data in lines, a line is ended by \n or \r (FFmpeg rewrites the stats line with \r).
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, b := range p {
+		if b == '\n' || b == '\r' {
+			t.push()
+			continue
+		}
+		// The bytes after the limit are kept up to a character, TruncateBytes cuts the line at a character start.
+		if len(t.partial) < stderrMaxLineBytes+utf8.UTFMax {
+			t.partial = append(t.partial, b)
+		}
+	}
+	return len(p), nil
+}
+
+// push adds the partial line to the ring buffer, empty lines are skipped.
+func (t *stderrTail) push() {
+	line := strings.TrimSpace(utils.TruncateBytes(string(t.partial), stderrMaxLineBytes))
+	t.partial = t.partial[:0]
+	if line == "" {
+		return
+	}
+
+	if len(t.lines) < stderrTailLines {
+		t.lines = append(t.lines, line)
+		return
+	}
+	t.lines[t.next] = line
+	t.next = (t.next + 1) % stderrTailLines
+}
+
+// Lines returns the kept lines, from the oldest to the newest, including the unterminated last one.
+func (t *stderrTail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.partial) > 0 {
+		t.push()
+	}
+	return append(append([]string{}, t.lines[t.next:]...), t.lines[:t.next]...)
+}
@@ -0,0 +1,123 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr []string
+		want   ErrorCode
+	}{
+		{"invalid data", []string{"input.mp3: Invalid data found when processing input"}, ErrCodeInvalidData},
+		{"moov atom", []string{"[mov,mp4,m4a,3gp,3g2,mj2 @ 0x1] moov atom not found"}, ErrCodeInvalidData},
+		{"unknown encoder", []string{"Unknown encoder 'libfdk_aac'"}, ErrCodeUnsupportedCodec},
+		{"missing stream", []string{"Stream map '0:a' matches no streams."}, ErrCodeMissingStream},
+		{"disk full", []string{"Error writing trailer: No space left on device"}, ErrCodeDiskFull},
+		{"permission denied", []string{"/tmp/out.m4a: Permission denied"}, ErrCodePermissionDenied},
+		{"system error after a generic message", []string{"Invalid data found when processing input", "No space left on device"}, ErrCodeDiskFull},
+		{"unknown lines", []string{"Press [q] to stop", "Conversion failed!"}, ErrCodeUnknown},
+		{"empty", nil, ErrCodeUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyStderr(tt.stderr); got != tt.want {
+				t.Errorf("classifyStderr() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFFmpegError(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timedOut, cancelTimeout := context.WithTimeout(context.Background(), 0)
+	defer cancelTimeout()
+	<-timedOut.Done()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		stderr []string
+		want   ErrorCode
+	}{
+		{"from the stderr", context.Background(), []string{"Invalid data found when processing input"}, ErrCodeInvalidData},
+		{"cancelled", cancelled, []string{"Invalid data found when processing input"}, ErrCodeCancelled},
+		{"timeout", timedOut, []string{"Conversion failed!"}, ErrCodeTimeout},
+		{"stderr before the timeout", timedOut, []string{"No space left on device"}, ErrCodeDiskFull},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("error waiting for ffmpeg command: %w", newFFmpegError(tt.ctx, errors.New("exit status 1"), tt.stderr))
+
+			code, stderr := ErrorDetails(err)
+			if code != tt.want || !reflect.DeepEqual(stderr, tt.stderr) {
+				t.Errorf("ErrorDetails() = %s, %v, want %s, %v", code, stderr, tt.want, tt.stderr)
+			}
+		})
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+	mismatch := fmt.Errorf("verify: %w", &OutputMismatchError{Mismatches: []string{"no audio stream"}})
+	if code, stderr := ErrorDetails(mismatch); code != ErrCodeOutputMismatch || stderr != nil || code.Retryable() {
+		t.Errorf("ErrorDetails() of a coded error = %s, %v, want %s, nil and not retryable", code, stderr, ErrCodeOutputMismatch)
+	}
+	if code, stderr := ErrorDetails(errors.New("other")); code != ErrCodeUnknown || stderr != nil || !code.Retryable() {
+		t.Errorf("ErrorDetails() of another error = %s, %v, want %s, nil and retryable", code, stderr, ErrCodeUnknown)
+	}
+}
+
+func TestStderrTail(t *testing.T) {
+	lines := func(n int) string {
+		var b strings.Builder
+		for i := range n {
+			fmt.Fprintf(&b, "line %d\n", i)
+		}
+		return b.String()
+	}
+	numbered := func(from, to int) []string {
+		var want []string
+		for i := from; i < to; i++ {
+			want = append(want, fmt.Sprintf("line %d", i))
+		}
+		return want
+	}
+	long := strings.Repeat("a", stderrMaxLineBytes-1) + "é" + strings.Repeat("b", 100)
+
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string
+	}{
+		{"fewer lines than the tail", []string{lines(3)}, numbered(0, 3)},
+		{"full tail", []string{lines(stderrTailLines)}, numbered(0, stderrTailLines)},
+		{"wrapped ring buffer", []string{lines(stderrTailLines + 5)}, numbered(5, stderrTailLines+5)},
+		{"wrapped many times", []string{lines(3*stderrTailLines + 7)}, numbered(2*stderrTailLines+7, 3*stderrTailLines+7)},
+		{"lines split across writes", []string{"li", "ne 0\nline", " 1\n"}, numbered(0, 2)},
+		{"carriage returns and empty lines", []string{"size=1\rsize=2\r\n\n  \nline 0\n"}, []string{"size=1", "size=2", "line 0"}},
+		{"unterminated last line", []string{"line 0\nline 1"}, numbered(0, 2)},
+		{"long line cut at a character", []string{long + "\n"}, []string{strings.Repeat("a", stderrMaxLineBytes-1)}},
+		{"nothing written", nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tail := newStderrTail()
+			for _, w := range tt.writes {
+				if n, err := tail.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write() = %d, %v", n, err)
+				}
+			}
+
+			if got := tail.Lines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package converter
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 	"time"
 
@@ -15,26 +17,46 @@ type FFmpegProgressDetails struct {
 	CurrentTime       float64
 	CurrentLine       string
 	Progress          float64
+	Speed             float64          // Encoding speed relative to real time, 0 if it's not known yet
+	Snapshot          ProgressSnapshot // Last progress block
+	Command           []string
 	TimeElapsed       string
 	Finished          bool
 	ProcessedFilePath string
 }
 
-const (
-	ctxTimeOut  = 6 * time.Minute // 5 minutes timeout for FFmpeg command execution
-	keyOutTime  = "out_time"
-	keyProgress = "progress"
-)
+const defaultCommandTimeout = 14 // minutes, below the maximum Lambda timeout of 15 minutes
+
+// commandTimeout returns the timeout of the FFmpeg commands, FFMPEG_TIMEOUT_MINUTES.
+// NOTE: It must be below the timeout of the Lambda, so a conversion which takes too long fails as TIMEOUT on the
+// document instead of being stopped with the Lambda.
+func commandTimeout() time.Duration {
+	minutes := utils.GetEnvInt("FFMPEG_TIMEOUT_MINUTES", defaultCommandTimeout)
+	if minutes <= 0 {
+		minutes = defaultCommandTimeout
+	}
+	return time.Duration(minutes) * time.Minute
+}
 
-// FFmpegExecutor executes an FFmpeg command and tracks its progress.
-func FFmpegExecutor(command []string, duration float64) (*FFmpegProgressDetails, error) {
+// ProgressFunc is called with a copy of the progress details at the end of each progress block of FFmpeg,
+// see ProgressFeed to have many subscribers.
+// It's called from the goroutine reading the progress, so it must not block.
+type ProgressFunc func(details FFmpegProgressDetails)
+
+// FFmpegExecutor executes an FFmpeg command and tracks its progress, calling onProgress (if not nil) on each update.
+// If the command fails, the error wraps an *FFmpegError with the last lines of its stderr.
+// The command is killed when the context is cancelled.
+func FFmpegExecutor(ctx context.Context, command []string, duration float64, onProgress ProgressFunc) (*FFmpegProgressDetails, error) {
 	startTime := time.Now()
 	details := newFFmpegProgressDetails(duration)
+	details.Command = command
 
-	ctx, cancel := context.WithTimeout(context.Background(), ctxTimeOut)
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout())
 	defer cancel()
 
 	cmd := utils.ExecCommand(ctx, command...)
+	stderr := newStderrTail()
+	cmd.Stderr = stderr
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -45,10 +67,10 @@ func FFmpegExecutor(command []string, duration float64) (*FFmpegProgressDetails,
 		return details, fmt.Errorf("error starting ffmpeg command: %w", err)
 	}
 
-	utils.ScanStd(stdout, ffmpegProgressHandler(details))
+	utils.ScanStd(stdout, ffmpegProgressHandler(details, onProgress))
 
 	if err := cmd.Wait(); err != nil {
-		return details, fmt.Errorf("error waiting for ffmpeg command: %w", err)
+		return details, fmt.Errorf("error waiting for ffmpeg command: %w", newFFmpegError(ctx, err, stderr.Lines()))
 	}
 
 	details.TimeElapsed = utils.FormatDuration(time.Since(startTime))
@@ -56,6 +78,83 @@ func FFmpegExecutor(command []string, duration float64) (*FFmpegProgressDetails,
 	return details, nil
 }
 
+// FFmpegStreamExecutor executes an FFmpeg command built for streaming mode, writing the input to its stdin and
+// passing its stdout to the output function, which must consume it until EOF. The progress is read from the
+// extra file descriptor 3 and onProgress (if not nil) is called on each update. If the duration is unknown (0), it's
+// set from the last output time at the end. If the command fails, the error wraps an *FFmpegError.
+// The command is killed when the context is cancelled.
+func FFmpegStreamExecutor(ctx context.Context, command []string, duration float64, input io.Reader, output func(io.Reader) error, onProgress ProgressFunc) (*FFmpegProgressDetails, error) {
+	startTime := time.Now()
+	details := newFFmpegProgressDetails(duration)
+	details.Command = command
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout())
+	defer cancel()
+
+	cmd := utils.ExecCommand(ctx, command...)
+	cmd.Stdin = input
+	stderr := newStderrTail()
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return details, fmt.Errorf("error getting stdout pipe: %w", err)
+	}
+
+	progressReader, progressWriter, err := os.Pipe()
+	if err != nil {
+		return details, fmt.Errorf("error creating progress pipe: %w", err)
+	}
+	cmd.ExtraFiles = []*os.File{progressWriter} // INFO: The first extra file is the file descriptor 3 of the child process
+
+	if err := cmd.Start(); err != nil {
+		progressReader.Close()
+		progressWriter.Close()
+		return details, fmt.Errorf("error starting ffmpeg command: %w", err)
+	}
+	progressWriter.Close() // The child process keeps its own copy
+
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		utils.ScanStd(progressReader, ffmpegProgressHandler(details, onProgress))
+	}()
+
+	outputErr := output(stdout)
+	if outputErr != nil {
+		cancel() // Stop FFmpeg, nobody is reading its output anymore
+	}
+
+	<-progressDone
+	waitErr := cmd.Wait()
+
+	if outputErr != nil {
+		return details, fmt.Errorf("error writing ffmpeg output: %w", outputErr)
+	}
+	if waitErr != nil {
+		return details, fmt.Errorf("error waiting for ffmpeg command: %w", newFFmpegError(ctx, waitErr, stderr.Lines()))
+	}
+
+	if details.Duration == 0 {
+		details.Duration = details.CurrentTime
+	}
+	details.TimeElapsed = utils.FormatDuration(time.Since(startTime))
+	return details, nil
+}
+
+// FFmpegVersion returns the first line of the version of FFmpeg, e.g. "ffmpeg version 7.1 Copyright ...".
+func FFmpegVersion() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	output, err := utils.ExecCommand(ctx, os.Getenv("FFMPEG_BIN_PATH"), "-version").Output()
+	if err != nil {
+		return "", fmt.Errorf("error getting ffmpeg version: %w", err)
+	}
+	version, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(version), nil
+}
+
 // newFFmpegProgressDetails creates a new instance of FFmpegProgressDetails with the specified duration.
 func newFFmpegProgressDetails(duration float64) *FFmpegProgressDetails {
 	return &FFmpegProgressDetails{
@@ -68,6 +167,15 @@ func newFFmpegProgressDetails(duration float64) *FFmpegProgressDetails {
 	}
 }
 
+// ETA returns the estimated time until the end of the conversion, 0 if the duration or the speed is not known.
+func (t *FFmpegProgressDetails) ETA() time.Duration {
+	if t.Duration <= 0 || t.Speed <= 0 {
+		return 0
+	}
+	remaining := max(t.Duration-t.CurrentTime, 0) / t.Speed
+	return time.Duration(remaining * float64(time.Second))
+}
+
 // String returns a string representation of the FFmpegProgressDetails.
 func (t *FFmpegProgressDetails) String() string {
 	return fmt.Sprintf("Progress: %.2f%%. Current Time: %s. Duration: %.2fs. Finished: %t. Elapsed Time: %s. Current Line: %s",
@@ -75,7 +183,9 @@ func (t *FFmpegProgressDetails) String() string {
 }
 
 // ffmpegProgressHandler processes each line of output from the FFmpeg command to update the progress details.
-func ffmpegProgressHandler(t *FFmpegProgressDetails) func(line string) {
+// The progress key ends each block, onProgress (if not nil) is called there.
+func ffmpegProgressHandler(t *FFmpegProgressDetails, onProgress ProgressFunc) func(line string) {
+	var parser progressParser
 	return func(line string) {
 		if t.Finished {
 			return
@@ -83,31 +193,32 @@ func ffmpegProgressHandler(t *FFmpegProgressDetails) func(line string) {
 
 		t.CurrentLine = line
 
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
+		snapshot, ok := parser.parseLine(line)
+		if !ok {
 			return
 		}
 
-		key, value := parts[0], parts[1]
-
-		switch key {
-		case keyOutTime:
-			if t.Duration > 0 {
-				seconds := utils.ParserTimeToSeconds(value)
-				if seconds > t.CurrentTime {
-					t.CurrentTime = seconds
-				}
-
-				progress := (t.CurrentTime / t.Duration) * 100
-
-				if progress > t.Progress {
-					t.Progress = progress
-				}
-			}
-		case keyProgress:
-			if value == "end" {
-				t.Finished = true
-			}
+		if seconds := snapshot.OutTime.Seconds(); seconds > t.CurrentTime {
+			t.CurrentTime = seconds
+		}
+		if t.Duration > 0 {
+			t.Progress = max(t.Progress, min(t.CurrentTime/t.Duration*100, 100))
+		}
+		if snapshot.Speed > 0 {
+			t.Speed = snapshot.Speed
+		}
+
+		// INFO: The last out_time is the start of the last packet, so it's a bit before the duration.
+		if snapshot.End {
+			t.Finished = true
+			t.Progress = 100
+		}
+
+		snapshot.Percent = t.Progress
+		t.Snapshot = snapshot
+
+		if onProgress != nil {
+			onProgress(*t)
 		}
 	}
 }
@@ -0,0 +1,191 @@
+package converter
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys of a progress block of FFmpeg (-progress), the block ends with the progress key.
+const (
+	keyFrame      = "frame"
+	keyFPS        = "fps"
+	keyBitrate    = "bitrate"
+	keyTotalSize  = "total_size"
+	keyOutTimeUS  = "out_time_us"
+	keyOutTimeMS  = "out_time_ms" // INFO: Also in microseconds, kept by FFmpeg for compatibility
+	keyOutTime    = "out_time"
+	keyDupFrames  = "dup_frames"
+	keyDropFrames = "drop_frames"
+	keySpeed      = "speed"
+	keyProgress   = "progress"
+
+	valueNotAvailable = "N/A"
+	valueEnd          = "end"
+)
+
+// ProgressSnapshot holds the values of a progress block of FFmpeg. The values written as N/A are left at zero
+// and their keys are listed in Unavailable.
+type ProgressSnapshot struct {
+	Frame       int64
+	FPS         float64
+	Bitrate     float64 // kbit/s
+	TotalSize   int64   // Bytes written to the output
+	OutTime     time.Duration
+	DupFrames   int64
+	DropFrames  int64
+	Speed       float64 // Relative to real time
+	Percent     float64 // Progress of the conversion, 0 if the duration is not known
+	End         bool    // Last block, progress=end
+	Unavailable []string
+}
+
+// progressParser reads the lines of the progress of FFmpeg into snapshots, one for each block.
+type progressParser struct {
+	block      ProgressSnapshot
+	hasOutTime bool // out_time_us or out_time_ms was read, out_time is less precise
+}
+
+// parseLine reads a line of the progress, returns the snapshot of the block and true when the line ends it.
+func (p *progressParser) parseLine(line string) (ProgressSnapshot, bool) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return ProgressSnapshot{}, false
+	}
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+	if key == keyProgress {
+		snapshot := p.block
+		snapshot.End = value == valueEnd
+		p.block, p.hasOutTime = ProgressSnapshot{}, false
+		return snapshot, true
+	}
+
+	if value == valueNotAvailable {
+		p.block.Unavailable = append(p.block.Unavailable, key)
+		return ProgressSnapshot{}, false
+	}
+
+	switch key {
+	case keyFrame:
+		p.block.Frame = parseProgressInt(value)
+	case keyFPS:
+		p.block.FPS = parseProgressFloat(value)
+	case keyBitrate:
+		p.block.Bitrate = parseProgressFloat(strings.TrimSuffix(value, "kbits/s"))
+	case keyTotalSize:
+		p.block.TotalSize = parseProgressInt(value)
+	case keyOutTimeUS, keyOutTimeMS:
+		// INFO: It's negative (the minimum int64) before the first packet.
+		p.block.OutTime = time.Duration(max(parseProgressInt(value), 0)) * time.Microsecond
+		p.hasOutTime = true
+	case keyOutTime:
+		if !p.hasOutTime {
+			p.block.OutTime = max(parseProgressTime(value), 0)
+		}
+	case keyDupFrames:
+		p.block.DupFrames = parseProgressInt(value)
+	case keyDropFrames:
+		p.block.DropFrames = parseProgressInt(value)
+	case keySpeed:
+		p.block.Speed = parseProgressFloat(strings.TrimSuffix(value, "x"))
+	}
+	return ProgressSnapshot{}, false
+}
+
+func parseProgressInt(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+func parseProgressFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return f
+}
+
+// parseProgressTime parses the out_time value, in the format "HH:MM:SS.micros" (negative before the first frame).
+func parseProgressTime(value string) time.Duration {
+	sign := time.Duration(1)
+	if rest, ok := strings.CutPrefix(value, "-"); ok {
+		sign, value = -1, rest
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	h, _ := strconv.Atoi(parts[0])
+	m, _ := strconv.Atoi(parts[1])
+	s, _ := strconv.ParseFloat(parts[2], 64)
+	return sign * (time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s*float64(time.Second)))
+}
+
+// ProgressFeed fans out the progress of an FFmpeg execution to its subscribers. Its Publish method is the
+// ProgressFunc given to the executor.
+type ProgressFeed struct {
+	mu     sync.Mutex
+	funcs  []ProgressFunc
+	chans  []chan ProgressSnapshot
+	closed bool
+}
+
+// NewProgressFeed creates a new ProgressFeed without subscribers.
+func NewProgressFeed() *ProgressFeed {
+	return &ProgressFeed{}
+}
+
+// Subscribe adds a function called with the details on each progress block, it must not block.
+func (f *ProgressFeed) Subscribe(fn ProgressFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.funcs = append(f.funcs, fn)
+}
+
+// SubscribeChan returns a channel receiving the snapshot of each progress block, closed by Close.
+// The snapshots are dropped while the channel is full.
+func (f *ProgressFeed) SubscribeChan(size int) <-chan ProgressSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan ProgressSnapshot, size)
+	if f.closed {
+		close(ch)
+		return ch
+	}
+	f.chans = append(f.chans, ch)
+	return ch
+}
+
+// Publish sends the details to the functions and their snapshot to the channels of the subscribers.
+func (f *ProgressFeed) Publish(details FFmpegProgressDetails) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	for _, fn := range f.funcs {
+		fn(details)
+	}
+	for _, ch := range f.chans {
+		select {
+		case ch <- details.Snapshot:
+		default:
+		}
+	}
+}
+
+// Close closes the channels of the subscribers, the progress published after it is ignored.
+func (f *ProgressFeed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.closed = true
+	for _, ch := range f.chans {
+		close(ch)
+	}
+}
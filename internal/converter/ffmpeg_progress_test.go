@@ -0,0 +1,187 @@
+package converter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseBlock parses the lines and returns the snapshot of the first block they end, false if they don't end one.
+func parseBlock(lines string) (ProgressSnapshot, bool) {
+	var parser progressParser
+	for _, line := range strings.Split(lines, "\n") {
+		if snapshot, ok := parser.parseLine(line); ok {
+			return snapshot, true
+		}
+	}
+	return ProgressSnapshot{}, false
+}
+
+func TestProgressParser(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines string
+		want  ProgressSnapshot
+	}{
+		{
+			name: "full block",
+			lines: "frame=10\nfps=2.5\nbitrate= 128.0kbits/s\ntotal_size=262144\nout_time_us=16500000\nout_time_ms=16500000\n" +
+				"out_time=00:00:16.500000\ndup_frames=1\ndrop_frames=2\nspeed=33.1x\nprogress=continue",
+			want: ProgressSnapshot{Frame: 10, FPS: 2.5, Bitrate: 128, TotalSize: 262144, OutTime: 16500 * time.Millisecond,
+				DupFrames: 1, DropFrames: 2, Speed: 33.1},
+		},
+		{
+			name:  "N/A values",
+			lines: "bitrate=N/A\ntotal_size=N/A\nout_time_us=N/A\nout_time=N/A\nspeed=N/A\nprogress=continue",
+			want:  ProgressSnapshot{Unavailable: []string{"bitrate", "total_size", "out_time_us", "out_time", "speed"}},
+		},
+		{
+			name:  "out_time without out_time_us",
+			lines: "out_time=01:02:03.500000\nprogress=continue",
+			want:  ProgressSnapshot{OutTime: time.Hour + 2*time.Minute + 3500*time.Millisecond},
+		},
+		{
+			name:  "out_time_us is more precise than out_time",
+			lines: "out_time_us=1234567\nout_time=00:00:01.000000\nprogress=continue",
+			want:  ProgressSnapshot{OutTime: 1234567 * time.Microsecond},
+		},
+		{
+			name:  "negative time before the first packet",
+			lines: "out_time_us=-9223372036854775807\nout_time=-00:00:01.000000\nprogress=continue",
+			want:  ProgressSnapshot{},
+		},
+		{
+			name:  "negative out_time",
+			lines: "out_time=-00:00:01.000000\nprogress=continue",
+			want:  ProgressSnapshot{},
+		},
+		{
+			name:  "last block",
+			lines: "out_time_us=2000000\nprogress=end",
+			want:  ProgressSnapshot{OutTime: 2 * time.Second, End: true},
+		},
+		{
+			name:  "invalid values and lines",
+			lines: "frame=abc\nnot a key value\nunknown=1\nout_time=1:2\nprogress=continue",
+			want:  ProgressSnapshot{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseBlock(tt.lines)
+			if !ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("snapshot = %+v, %v, want %+v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestProgressParserBlocks(t *testing.T) {
+	var parser progressParser
+	var snapshots []ProgressSnapshot
+	for _, line := range []string{"frame=1", "out_time_us=1000000", "progress=continue", "speed=2x", "progress=end"} {
+		if snapshot, ok := parser.parseLine(line); ok {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	// Each block starts empty, the values of the previous one are not kept.
+	want := []ProgressSnapshot{{Frame: 1, OutTime: time.Second}, {Speed: 2, End: true}}
+	if !reflect.DeepEqual(snapshots, want) {
+		t.Errorf("snapshots = %+v, want %+v", snapshots, want)
+	}
+}
+
+func TestFFmpegProgressHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		duration     float64
+		lines        []string
+		wantProgress []float64 // Percent of each published block
+		wantFinished bool
+	}{
+		{
+			name:         "progress of the duration",
+			duration:     10,
+			lines:        []string{"out_time_us=2500000", "speed=2x", "progress=continue", "out_time_us=5000000", "progress=continue"},
+			wantProgress: []float64{25, 50},
+		},
+		{
+			name:         "100% at the end before the duration",
+			duration:     8,
+			lines:        []string{"out_time_us=7000000", "progress=continue", "out_time_us=7500000", "progress=end"},
+			wantProgress: []float64{87.5, 100},
+			wantFinished: true,
+		},
+		{
+			name:         "out_time N/A keeps the last time",
+			duration:     10,
+			lines:        []string{"out_time_us=5000000", "progress=continue", "out_time_us=N/A", "out_time=N/A", "progress=continue"},
+			wantProgress: []float64{50, 50},
+		},
+		{
+			name:         "time after the duration",
+			duration:     10,
+			lines:        []string{"out_time_us=12000000", "progress=continue"},
+			wantProgress: []float64{100},
+		},
+		{
+			name:         "unknown duration",
+			duration:     0,
+			lines:        []string{"out_time_us=5000000", "progress=continue", "progress=end"},
+			wantProgress: []float64{0, 100},
+			wantFinished: true,
+		},
+		{
+			name:         "lines after the end are ignored",
+			duration:     10,
+			lines:        []string{"progress=end", "out_time_us=5000000", "progress=continue"},
+			wantProgress: []float64{100},
+			wantFinished: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details := newFFmpegProgressDetails(tt.duration)
+			var progress []float64
+			handler := ffmpegProgressHandler(details, func(published FFmpegProgressDetails) {
+				if published.Snapshot.Percent != published.Progress {
+					t.Errorf("snapshot percent = %v, want the progress %v", published.Snapshot.Percent, published.Progress)
+				}
+				progress = append(progress, published.Progress)
+			})
+			for _, line := range tt.lines {
+				handler(line)
+			}
+
+			if !reflect.DeepEqual(progress, tt.wantProgress) || details.Finished != tt.wantFinished {
+				t.Errorf("progress = %v, finished = %v, want %v, %v", progress, details.Finished, tt.wantProgress, tt.wantFinished)
+			}
+		})
+	}
+}
+
+func TestProgressFeed(t *testing.T) {
+	feed := NewProgressFeed()
+	var published []float64
+	feed.Subscribe(func(details FFmpegProgressDetails) { published = append(published, details.Progress) })
+	ch := feed.SubscribeChan(1)
+
+	feed.Publish(FFmpegProgressDetails{Progress: 10, Snapshot: ProgressSnapshot{Percent: 10}})
+	feed.Publish(FFmpegProgressDetails{Progress: 20, Snapshot: ProgressSnapshot{Percent: 20}}) // Dropped, the channel is full
+	feed.Close()
+	feed.Publish(FFmpegProgressDetails{Progress: 30})
+
+	var received []float64
+	for snapshot := range ch {
+		received = append(received, snapshot.Percent)
+	}
+	if !reflect.DeepEqual(published, []float64{10, 20}) || !reflect.DeepEqual(received, []float64{10}) {
+		t.Errorf("published = %v, received = %v, want [10 20] and [10]", published, received)
+	}
+
+	if _, ok := <-feed.SubscribeChan(1); ok {
+		t.Error("channel subscribed after Close is open")
+	}
+}
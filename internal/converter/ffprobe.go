@@ -2,16 +2,25 @@ package converter
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"pitanguinha.com/audio-converter/internal/media"
 	"pitanguinha.com/audio-converter/internal/utils"
 )
 
-// GetDurationFromFile retrieves the duration of a media file using ffprobe.
+// GetDurationFromFile retrieves the duration of a media file from its headers, or using ffprobe
+// if its format can't be read.
 func GetDurationFromFile(filePath string) (float64, error) {
+	// INFO: Reading the headers is faster than starting ffprobe, mostly on a cold Lambda.
+	if info, err := media.ReadAudioInfo(filePath); err == nil && info.Duration > 0 {
+		return info.Duration, nil
+	}
+
 	FFprobeBinPath := os.Getenv("FFPROBE_BIN_PATH")
 	command := []string{FFprobeBinPath, "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", filePath}
 
@@ -28,12 +37,28 @@ func GetDurationFromFile(filePath string) (float64, error) {
 		return 0, err
 	}
 
-	output = output[:len(output)-1] // Remove the trailing newline character
-
-	duration, err := strconv.ParseFloat(output, 64)
+	duration, err := strconv.ParseFloat(strings.TrimSpace(output), 64)
 	if err != nil {
 		return 0, fmt.Errorf("failed to parse duration: %w", err)
 	}
 
 	return duration, nil
 }
+
+// ProbeJSON returns the ffprobe JSON (format and streams) of a media file.
+func ProbeJSON(filePath string) (json.RawMessage, error) {
+	FFprobeBinPath := os.Getenv("FFPROBE_BIN_PATH")
+	command := []string{FFprobeBinPath, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", filePath}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	output, err := utils.ExecCommand(ctx, command...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("error probing %s: %w", filePath, err)
+	}
+	if !json.Valid(output) {
+		return nil, fmt.Errorf("invalid ffprobe output for %s", filePath)
+	}
+	return output, nil
+}
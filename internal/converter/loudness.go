@@ -0,0 +1,35 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+
+	"pitanguinha.com/audio-converter/internal/analysis"
+)
+
+const loudnessSampleRate = 48000 // Hz, the rate of the BS.1770 reference coefficients
+
+// MeasureLoudness measures the BS.1770 loudness (integrated, short-term max, range and true peak) of the input
+// (a file path or URL), decoding it with FFmpeg and metering the samples in Go.
+func MeasureLoudness(ctx context.Context, input string) (*analysis.Loudness, error) {
+	info, err := Probe(input)
+	if err != nil {
+		return nil, err
+	}
+	audio, ok := info.AudioStream()
+	if !ok || audio.Channels <= 0 {
+		return nil, fmt.Errorf("no audio stream in %s", input)
+	}
+
+	// INFO: The channels are kept as is, the weights of the meter depend on the layout.
+	meter, err := analysis.NewLoudnessMeter(loudnessSampleRate, audio.Channels)
+	if err != nil {
+		return nil, err
+	}
+	if err := DecodePCM(ctx, input, loudnessSampleRate, audio.Channels, meter.Write); err != nil {
+		return nil, err
+	}
+
+	loudness := meter.Loudness()
+	return &loudness, nil
+}
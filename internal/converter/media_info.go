@@ -0,0 +1,102 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MediaInfo is the description of a media file by ffprobe.
+type MediaInfo struct {
+	Formats  []string // Names of the container, e.g. ["mov", "mp4", "m4a", "3gp", "3g2", "mj2"]
+	Duration float64  // Seconds, 0 if it's not known
+	Size     int64
+	Streams  []StreamInfo
+}
+
+// StreamInfo is the description of a stream of a media file.
+type StreamInfo struct {
+	Type        string // audio, video, ...
+	Codec       string
+	SampleRate  int
+	Channels    int
+	Width       int
+	Height      int
+	AttachedPic bool // Cover art stored as a video stream
+}
+
+// ffprobeOutput is the part of the ffprobe JSON read into MediaInfo.
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType   string `json:"codec_type"`
+		CodecName   string `json:"codec_name"`
+		SampleRate  string `json:"sample_rate"`
+		Channels    int    `json:"channels"`
+		Width       int    `json:"width"`
+		Height      int    `json:"height"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+}
+
+// Probe describes the media file with ffprobe.
+// NOTE: There is no fallback to the headers of the file (see GetDurationFromFile), ffprobe fails on the corrupt
+// and truncated files which the validation and the verification of the output must reject.
+func Probe(filePath string) (*MediaInfo, error) {
+	data, err := ProbeJSON(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var output ffprobeOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("error parsing ffprobe output for %s: %w", filePath, err)
+	}
+
+	info := &MediaInfo{Formats: strings.Split(output.Format.FormatName, ",")}
+	info.Duration, _ = strconv.ParseFloat(output.Format.Duration, 64)
+	info.Size, _ = strconv.ParseInt(output.Format.Size, 10, 64)
+	for _, stream := range output.Streams {
+		sampleRate, _ := strconv.Atoi(stream.SampleRate)
+		info.Streams = append(info.Streams, StreamInfo{
+			Type:        stream.CodecType,
+			Codec:       stream.CodecName,
+			SampleRate:  sampleRate,
+			Channels:    stream.Channels,
+			Width:       stream.Width,
+			Height:      stream.Height,
+			AttachedPic: stream.Disposition.AttachedPic == 1,
+		})
+	}
+	return info, nil
+}
+
+// AudioStream returns the first audio stream, false if there is none.
+func (m *MediaInfo) AudioStream() (StreamInfo, bool) {
+	for _, stream := range m.Streams {
+		if stream.Type == "audio" {
+			return stream, true
+		}
+	}
+	return StreamInfo{}, false
+}
+
+// HasCover reports whether the file has a cover art stream.
+func (m *MediaInfo) HasCover() bool {
+	return slices.ContainsFunc(m.Streams, func(stream StreamInfo) bool {
+		return stream.Type == "video"
+	})
+}
+
+// HasFormat reports whether the container is one of the format names.
+func (m *MediaInfo) HasFormat(name string) bool {
+	return slices.Contains(m.Formats, name)
+}
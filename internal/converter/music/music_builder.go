@@ -1,15 +1,60 @@
 package music
 
-import "pitanguinha.com/audio-converter/internal/converter"
+import (
+	"fmt"
+	"strings"
+
+	"pitanguinha.com/audio-converter/internal/converter"
+	"pitanguinha.com/audio-converter/internal/lyrics"
+	"pitanguinha.com/audio-converter/internal/utils"
+)
 
 // BuildCommand constructs the FFmpeg command for processing music files.
-func BuildCommand(inputsPaths, metadataMap map[string]string) ([]string, error) {
+// If copyAudio is true, the audio stream is copied and only the metadata and the cover are replaced.
+func BuildCommand(inputsPaths, metadataMap map[string]string, copyAudio bool) ([]string, error) {
 	ffmpegCommand, err := converter.NewFFmpegCommand(inputsPaths, metadataMap, []string{"artist", "album", "genre"})
 	if err != nil {
 		return nil, err
 	}
 
+	if copyAudio {
+		ffmpegCommand.CopyAudio()
+	}
+
 	ffmpegCommand.AddMetadataFromMap([]string{"artist", "album", "genre"}, metadataMap)
 
+	lyricsText, err := readLyrics(inputsPaths)
+	if err != nil {
+		return nil, err
+	}
+	// INFO: The "lyrics" key is written as ©lyr on mp4 and USLT on id3v2 containers.
+	ffmpegCommand.AddMetadata("lyrics", lyricsText)
+
 	return ffmpegCommand.BuildCommand(), nil
 }
+
+// readLyrics returns the unsynced lyrics of the music, from the plain lyrics file or,
+// if there is none, from the synced lyrics file without its time tags.
+func readLyrics(inputsPaths map[string]string) (string, error) {
+	if path := inputsPaths["lyrics"]; path != "" {
+		data, err := utils.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("error reading lyrics file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	if path := inputsPaths["synced_lyrics"]; path != "" {
+		data, err := utils.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("error reading synced lyrics file: %w", err)
+		}
+		lines, err := lyrics.ParseLRC(data)
+		if err != nil {
+			return "", fmt.Errorf("error parsing synced lyrics file: %w", err)
+		}
+		return lyrics.PlainText(lines), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"pitanguinha.com/audio-converter/internal/analysis"
+)
+
+// AnalyzeMusic estimates the tempo (BPM) and the key of the input (a file path or URL), decoding it with FFmpeg
+// to mono and analyzing the samples in Go.
+func AnalyzeMusic(ctx context.Context, input string) (*analysis.MusicAnalysis, error) {
+	analyzer := analysis.NewMusicAnalyzer()
+	if err := DecodePCM(ctx, input, analysis.MusicSampleRate, 1, analyzer.Write); err != nil {
+		return nil, err
+	}
+
+	result := analyzer.Analysis()
+	return &result, nil
+}
+
+// MusicAnalysisTags returns the tempo and key tags that fit the output container: TBPM and TKEY for mp3,
+// tmpo (integer atom) and initialkey (freeform atom) for mp4 based containers, none for aac (ADTS) and BPM and
+// INITIALKEY (Vorbis comments) for the others.
+// The values which were not estimated are omitted.
+func MusicAnalysisTags(result *analysis.MusicAnalysis, audioFormat string) map[string]string {
+	bpmKey, keyKey := "BPM", "INITIALKEY"
+	switch {
+	case strings.EqualFold(audioFormat, "aac"):
+		return nil
+	case strings.EqualFold(audioFormat, "mp3"):
+		bpmKey, keyKey = "TBPM", "TKEY"
+	case isMP4Container(audioFormat):
+		bpmKey, keyKey = "tmpo", "initialkey"
+	}
+
+	tags := make(map[string]string)
+	if result.BPM > 0 {
+		// INFO: The ID3 TBPM frame and the mp4 tmpo atom are integers.
+		tags[bpmKey] = strconv.Itoa(int(result.BPM + 0.5))
+	}
+	if result.Key != "" {
+		tags[keyKey] = result.Key
+	}
+	return tags
+}
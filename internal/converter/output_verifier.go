@@ -0,0 +1,130 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+const defaultDurationTolerance = 1 // seconds
+
+// ErrCodeOutputMismatch is the code of an output which doesn't match the preset.
+const ErrCodeOutputMismatch ErrorCode = "OUTPUT_MISMATCH"
+
+// encoderCodecs maps the FFmpeg encoders (AUDIO_CODEC) to the codec names reported by ffprobe, when they differ.
+var encoderCodecs = map[string]string{
+	"libmp3lame": "mp3",
+	"libshine":   "mp3",
+	"libfdk_aac": "aac",
+	"aac_at":     "aac",
+	"libopus":    "opus",
+	"libvorbis":  "vorbis",
+}
+
+// formatNames maps the audio formats (AUDIO_FORMAT) to a format name reported by ffprobe for the container.
+var formatNames = map[string]string{
+	"m4a":  "mp4",
+	"mp4":  "mp4",
+	"m4b":  "mp4",
+	"mp3":  "mp3",
+	"aac":  "aac",
+	"ogg":  "ogg",
+	"oga":  "ogg",
+	"opus": "ogg",
+	"flac": "flac",
+	"wav":  "wav",
+}
+
+// OutputSpec is what a converted file is expected to be.
+type OutputSpec struct {
+	Codec      string  // Codec name as reported by ffprobe
+	Format     string  // Container format name as reported by ffprobe
+	SampleRate int     // 0 to accept any
+	Channels   int     // 0 to accept any
+	Duration   float64 // Source duration in seconds, 0 to skip the check
+	Tolerance  float64 // Accepted difference to the duration in seconds
+	Cover      bool
+}
+
+// OutputMismatchError lists the differences between a converted file and its OutputSpec.
+type OutputMismatchError struct {
+	Mismatches []string
+}
+
+func (e *OutputMismatchError) Error() string {
+	return "output doesn't match the preset: " + strings.Join(e.Mismatches, "; ")
+}
+
+func (e *OutputMismatchError) ErrorCode() ErrorCode {
+	return ErrCodeOutputMismatch
+}
+
+// ExpectedOutput returns the OutputSpec of the preset (AUDIO_CODEC, AUDIO_FORMAT, AUDIO_SAMPLE_RATE and AUDIO_CHANNELS)
+// for a source of the duration, with the tolerance OUTPUT_DURATION_TOLERANCE_SECONDS.
+func ExpectedOutput(duration float64, cover bool) OutputSpec {
+	codec := os.Getenv("AUDIO_CODEC")
+	if name, ok := encoderCodecs[codec]; ok {
+		codec = name
+	}
+
+	audioFormat := strings.ToLower(os.Getenv("AUDIO_FORMAT"))
+	format, ok := formatNames[audioFormat]
+	if !ok {
+		format = audioFormat
+	}
+
+	return OutputSpec{
+		Codec:      codec,
+		Format:     format,
+		SampleRate: utils.GetEnvInt("AUDIO_SAMPLE_RATE", 0),
+		Channels:   utils.GetEnvInt("AUDIO_CHANNELS", 0),
+		Duration:   duration,
+		Tolerance:  float64(utils.GetEnvInt("OUTPUT_DURATION_TOLERANCE_SECONDS", defaultDurationTolerance)),
+		Cover:      cover,
+	}
+}
+
+// VerifyOutput probes the converted file and checks it against the spec. The error wraps an *OutputMismatchError
+// if it doesn't match.
+// INFO: FFmpeg may exit with success after a corrupt frame, the duration check catches the truncated outputs.
+func VerifyOutput(filePath string, spec OutputSpec) error {
+	info, err := Probe(filePath)
+	if err != nil {
+		return fmt.Errorf("error probing output: %w", err)
+	}
+
+	var mismatches []string
+	if spec.Format != "" && !info.HasFormat(spec.Format) {
+		mismatches = append(mismatches, fmt.Sprintf("container is %s, expected %s", strings.Join(info.Formats, ","), spec.Format))
+	}
+
+	audio, ok := info.AudioStream()
+	if !ok {
+		mismatches = append(mismatches, "no audio stream")
+	} else {
+		if spec.Codec != "" && audio.Codec != spec.Codec {
+			mismatches = append(mismatches, fmt.Sprintf("codec is %s, expected %s", audio.Codec, spec.Codec))
+		}
+		if spec.SampleRate > 0 && audio.SampleRate != spec.SampleRate {
+			mismatches = append(mismatches, fmt.Sprintf("sample rate is %d, expected %d", audio.SampleRate, spec.SampleRate))
+		}
+		if spec.Channels > 0 && audio.Channels != spec.Channels {
+			mismatches = append(mismatches, fmt.Sprintf("channels are %d, expected %d", audio.Channels, spec.Channels))
+		}
+	}
+
+	if spec.Duration > 0 && math.Abs(info.Duration-spec.Duration) > spec.Tolerance {
+		mismatches = append(mismatches, fmt.Sprintf("duration is %.2fs, expected %.2fs", info.Duration, spec.Duration))
+	}
+	if spec.Cover && !info.HasCover() {
+		mismatches = append(mismatches, "no cover stream")
+	}
+
+	if len(mismatches) > 0 {
+		return &OutputMismatchError{Mismatches: mismatches}
+	}
+	return nil
+}
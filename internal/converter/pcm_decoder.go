@@ -0,0 +1,77 @@
+package converter
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+const pcmChunkFrames = 4096 // Frames passed to the consumer at a time
+
+// DecodePCM decodes the first audio stream of the input (a file path or URL) with FFmpeg to interleaved 32 bits
+// float samples, resampled and mixed to the sample rate and channels, and passes them to consume in chunks.
+// The samples are only valid during the call. If FFmpeg fails, the error wraps an *FFmpegError.
+func DecodePCM(ctx context.Context, input string, sampleRate, channels int, consume func(samples []float32)) error {
+	ffmpegBinPath := os.Getenv("FFMPEG_BIN_PATH")
+	command := []string{ffmpegBinPath, "-v", "error", "-nostdin", "-i", input, "-map", "0:a:0",
+		"-ac", strconv.Itoa(channels), "-ar", strconv.Itoa(sampleRate), "-f", "f32le", "pipe:1"}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout())
+	defer cancel()
+
+	cmd := utils.ExecCommand(ctx, command...)
+	stderr := newStderrTail()
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error getting stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting ffmpeg command: %w", err)
+	}
+
+	readErr := readPCM(bufio.NewReaderSize(stdout, 64*1024), pcmChunkFrames*channels, consume)
+	if readErr != nil {
+		cancel()
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("error decoding %s: %w", input, newFFmpegError(ctx, err, stderr.Lines()))
+	}
+	if readErr != nil {
+		return fmt.Errorf("error reading decoded samples: %w", readErr)
+	}
+	return nil
+}
+
+// readPCM reads little endian 32 bits float samples until EOF and passes them to consume in chunks of up to size.
+func readPCM(r io.Reader, size int, consume func(samples []float32)) error {
+	buffer := make([]byte, size*4)
+	samples := make([]float32, size)
+	for {
+		n, err := io.ReadFull(r, buffer)
+		n -= n % 4 // A truncated sample is dropped
+		for i := range n / 4 {
+			samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(buffer[i*4:]))
+		}
+		if n > 0 {
+			consume(samples[:n/4])
+		}
+
+		switch {
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
@@ -3,12 +3,17 @@ package podcast
 import "pitanguinha.com/audio-converter/internal/converter"
 
 // BuildCommand constructs the FFmpeg command for processing podcast files.
-func BuildCommand(inputsPaths, metadataMap map[string]string) ([]string, error) {
+// If copyAudio is true, the audio stream is copied and only the metadata and the cover are replaced.
+func BuildCommand(inputsPaths, metadataMap map[string]string, copyAudio bool) ([]string, error) {
 	ffmpegCommand, err := converter.NewFFmpegCommand(inputsPaths, metadataMap, []string{"presenter", "description"})
 	if err != nil {
 		return nil, err
 	}
 
+	if copyAudio {
+		ffmpegCommand.CopyAudio()
+	}
+
 	ffmpegCommand.AddMetadataFromMap([]string{"presenter", "description"}, metadataMap)
 
 	return ffmpegCommand.BuildCommand(), nil
@@ -0,0 +1,235 @@
+package converter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pitanguinha.com/audio-converter/internal/media"
+	"pitanguinha.com/audio-converter/internal/utils"
+)
+
+// ReplayGain holds the loudness measurement of a track and the gain values derived from it.
+type ReplayGain struct {
+	IntegratedLoudness float64 // LUFS
+	TruePeak           float64 // dBFS
+	TrackGain          float64 // dB, relative to the ReplayGain 2.0 reference level
+	TrackPeak          float64 // Linear, 1.0 is full scale
+}
+
+// TrackLoudness is the loudness and duration of a single track, used to compute album gain.
+type TrackLoudness struct {
+	IntegratedLoudness float64
+	TruePeak           float64
+	Duration           float64
+}
+
+// mp4FreeformKeys are the tags written as iTunes freeform atoms on mp4 based containers, the mp4 muxer of
+// FFmpeg only writes the standard ones.
+var mp4FreeformKeys = []string{"iTunNORM", "initialkey"}
+
+const (
+	replayGainReference = -18.0 // LUFS, ReplayGain 2.0 reference level
+	retaggedFileName    = "retagged_file"
+)
+
+// MeasureReplayGain measures the loudness and true peak of a media file with the ffmpeg ebur128 filter.
+func MeasureReplayGain(filePath string) (*ReplayGain, error) {
+	ffmpegBinPath := os.Getenv("FFMPEG_BIN_PATH")
+	command := []string{ffmpegBinPath, "-hide_banner", "-nostats", "-i", filePath, "-map", "0:a", "-filter:a", "ebur128=peak=true", "-f", "null", "-"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout())
+	defer cancel()
+
+	cmd := utils.ExecCommand(ctx, command...)
+	if cmd == nil {
+		return nil, fmt.Errorf("failed to create command for ffmpeg")
+	}
+
+	output, err := utils.GetCommandOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	loudness, peak, err := parseEbur128Summary(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return newReplayGain(loudness, peak), nil
+}
+
+// AlbumReplayGain computes the album gain of a set of tracks, weighting the loudness of each track by its duration.
+func AlbumReplayGain(tracks []TrackLoudness) (*ReplayGain, error) {
+	var energy, totalDuration float64
+	peak := math.Inf(-1)
+
+	for _, track := range tracks {
+		if track.Duration <= 0 {
+			continue
+		}
+		energy += track.Duration * math.Pow(10, track.IntegratedLoudness/10)
+		totalDuration += track.Duration
+		peak = math.Max(peak, track.TruePeak)
+	}
+
+	if totalDuration == 0 {
+		return nil, fmt.Errorf("no tracks with duration to compute album gain")
+	}
+
+	return newReplayGain(10*math.Log10(energy/totalDuration), peak), nil
+}
+
+// Tags returns the metadata tags that fit the output container: ReplayGain tags for
+// mp3, flac, ogg and opus, iTunes Sound Check (iTunNORM) for mp4 based containers and none for aac (ADTS),
+// which can't hold tags.
+func (r *ReplayGain) Tags(audioFormat string) map[string]string {
+	switch {
+	case strings.EqualFold(audioFormat, "aac"):
+		return nil
+	case isMP4Container(audioFormat):
+		return map[string]string{"iTunNORM": r.soundCheck()}
+	}
+	return map[string]string{
+		"REPLAYGAIN_TRACK_GAIN": fmt.Sprintf("%.2f dB", r.TrackGain),
+		"REPLAYGAIN_TRACK_PEAK": fmt.Sprintf("%.6f", r.TrackPeak),
+	}
+}
+
+// isMP4Container reports whether the audio format is written in a mp4 based container.
+func isMP4Container(audioFormat string) bool {
+	switch strings.ToLower(audioFormat) {
+	case "m4a", "mp4", "m4b":
+		return true
+	}
+	return false
+}
+
+// WriteTags rewrites the metadata tags of the media file in place, copying the streams without re-encoding.
+// On mp4 based containers, the freeform tags (see mp4FreeformKeys) are written as iTunes freeform atoms.
+func WriteTags(filePath, audioFormat string, tags map[string]string) error {
+	tags = maps.Clone(tags)
+	freeform := make(map[string]string)
+	if isMP4Container(audioFormat) {
+		for _, key := range mp4FreeformKeys {
+			if value, ok := tags[key]; ok {
+				freeform[key] = value
+				delete(tags, key)
+			}
+		}
+	}
+
+	if len(tags) > 0 {
+		// INFO: The remux drops the freeform atoms written before, they are written back with the new ones.
+		if isMP4Container(audioFormat) {
+			existing, err := media.ReadMP4FreeformTags(filePath)
+			if err != nil {
+				return fmt.Errorf("error reading tags of %s: %w", filePath, err)
+			}
+			maps.Copy(existing, freeform)
+			freeform = existing
+		}
+		if err := remuxTags(filePath, audioFormat, tags); err != nil {
+			return err
+		}
+	}
+
+	if len(freeform) > 0 {
+		return media.WriteMP4FreeformTags(filePath, freeform)
+	}
+	return nil
+}
+
+// remuxTags copies the media file with the metadata tags added by FFmpeg, then replaces it.
+func remuxTags(filePath, audioFormat string, tags map[string]string) error {
+	ffmpegBinPath := os.Getenv("FFMPEG_BIN_PATH")
+	outputPath := filepath.Join(filepath.Dir(filePath), retaggedFileName+filepath.Ext(filePath))
+
+	command := []string{ffmpegBinPath, "-y", "-nostats", "-i", filePath, "-map", "0", "-c", "copy", "-map_metadata", "0"}
+	for key, value := range tags {
+		command = append(command, "-metadata", fmt.Sprintf("%s=%s", key, value))
+	}
+	if isMP4Container(audioFormat) {
+		command = append(command, "-movflags", "+faststart")
+	}
+	command = append(command, outputPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout())
+	defer cancel()
+
+	cmd := utils.ExecCommand(ctx, command...)
+	if cmd == nil {
+		return fmt.Errorf("failed to create command for ffmpeg")
+	}
+
+	if _, err := utils.GetCommandOutput(cmd); err != nil {
+		return fmt.Errorf("error writing tags to %s: %w", filePath, err)
+	}
+
+	if err := os.Rename(outputPath, filePath); err != nil {
+		return fmt.Errorf("error replacing %s with the retagged file: %w", filePath, err)
+	}
+	return nil
+}
+
+// newReplayGain creates a ReplayGain from the integrated loudness (LUFS) and true peak (dBFS).
+func newReplayGain(loudness, truePeak float64) *ReplayGain {
+	return &ReplayGain{
+		IntegratedLoudness: loudness,
+		TruePeak:           truePeak,
+		TrackGain:          replayGainReference - loudness,
+		TrackPeak:          math.Pow(10, truePeak/20),
+	}
+}
+
+// soundCheck formats the gain as the iTunNORM value used by iTunes Sound Check.
+func (r *ReplayGain) soundCheck() string {
+	norm := func(base float64) uint32 {
+		return uint32(math.Min(65534, math.Round(base*math.Pow(10, -r.TrackGain/10))))
+	}
+	peak := uint32(math.Min(32768, math.Round(r.TrackPeak*32768)))
+
+	n1000, n2500 := norm(1000), norm(2500)
+	return fmt.Sprintf(" %08X %08X %08X %08X 00024CA8 00024CA8 %08X %08X 00024CA8 00024CA8",
+		n1000, n1000, n2500, n2500, peak, peak)
+}
+
+// parseEbur128Summary parses the integrated loudness and true peak from the summary printed by the ebur128 filter.
+func parseEbur128Summary(output string) (loudness, peak float64, err error) {
+	idx := strings.LastIndex(output, "Summary:")
+	if idx == -1 {
+		return 0, 0, fmt.Errorf("ebur128 summary not found in ffmpeg output")
+	}
+
+	var foundLoudness, foundPeak bool
+	scanner := bufio.NewScanner(strings.NewReader(output[idx:]))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "I:":
+			loudness, err = strconv.ParseFloat(fields[1], 64)
+			foundLoudness = err == nil
+		case "Peak:":
+			peak, err = strconv.ParseFloat(fields[1], 64)
+			foundPeak = err == nil
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse ebur128 summary line %q: %w", scanner.Text(), err)
+		}
+	}
+
+	if !foundLoudness || !foundPeak {
+		return 0, 0, fmt.Errorf("ebur128 summary is missing the integrated loudness or true peak")
+	}
+	return loudness, peak, nil
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned (wrapped) when a document doesn't exist.
+var ErrNotFound = errors.New("document not found")
+
+// ContentVersion is an entry of the versions of a document, one for each conversion.
+type ContentVersion struct {
+	Key       string    `bson:"key"`    // Encoded the same way as content_key
+	Checksum  string    `bson:"sha256"` // SHA-256 (hex) of the converted content
+	Preset    string    `bson:"preset"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// ReplayGain is the loudness of a track as stored in the documents, the album values are set by SaveAlbumGain.
+type ReplayGain struct {
+	IntegratedLoudness float64 `bson:"integrated_loudness"`
+	TruePeak           float64 `bson:"true_peak"`
+	TrackGain          float64 `bson:"track_gain"`
+	TrackPeak          float64 `bson:"track_peak"`
+}
+
+// Loudness is the BS.1770 loudness of the converted content, stored as loudness.
+type Loudness struct {
+	Integrated   float64 `bson:"integrated"`     // LUFS
+	ShortTermMax float64 `bson:"short_term_max"` // LUFS
+	Range        float64 `bson:"range"`          // LU
+	TruePeak     float64 `bson:"true_peak"`      // dBTP
+}
+
+// MusicAnalysis is the tempo and key estimated from a music, stored as bpm, bpm_confidence, key and key_confidence.
+type MusicAnalysis struct {
+	BPM           float64 // 0 if the music has no steady beat
+	BPMConfidence float64 // 0 to 1
+	Key           string  // ID3 TKEY notation, e.g. "C", "F#m"
+	KeyConfidence float64 // 0 to 1
+}
+
+// PresignedURLs holds the presigned GET URLs of the outputs of a document.
+type PresignedURLs struct {
+	Content      string    `bson:"content"`
+	SyncedLyrics string    `bson:"synced_lyrics,omitempty"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+}
+
+// ConversionProgress is the progress of a running conversion, stored as progress.
+type ConversionProgress struct {
+	Percent    float64   `bson:"percent"`     // 0 if the duration is not known
+	Speed      float64   `bson:"speed"`       // Encoding speed relative to real time
+	ETASeconds float64   `bson:"eta_seconds"` // 0 if the duration or the speed is not known
+	UpdatedAt  time.Time `bson:"updated_at"`
+}
+
+// ConversionFailure is the cause of a failed conversion, stored as failure.
+type ConversionFailure struct {
+	Code           string    `bson:"code"` // e.g. INVALID_DATA, see converter.ErrorCode
+	Message        string    `bson:"message"`
+	Stderr         []string  `bson:"stderr,omitempty"` // Last lines of the stderr of FFmpeg
+	DebugBundleKey string    `bson:"debug_bundle_key,omitempty"`
+	Retryable      bool      `bson:"retryable"` // False if the job would fail again with the same inputs
+	At             time.Time `bson:"at"`
+}
+
+// ConversionResult holds the fields of a document set by a successful conversion.
+type ConversionResult struct {
+	ContentKey     string
+	LyricsKey      string // Key of the synced lyrics sidecar, empty if the job has no synced lyrics, they are then cleared.
+	Duration       string // HH:MM:SS
+	ReplayGain     *ReplayGain
+	Loudness       *Loudness       // Nil if it was not measured
+	MusicAnalysis  *MusicAnalysis  // Nil if the content is not a music or it was not analyzed
+	SourceChecksum string          // SHA-256 (hex) of the source content
+	OutputChecksum string          // SHA-256 (hex) of the converted content
+	Version        *ContentVersion // Appended to the versions of the document, nil to keep them as is.
+	PresignedURLs  *PresignedURLs
+}
+
+// LastConversion holds the fields of a document about its last successful conversion.
+type LastConversion struct {
+	SourceChecksum string           `bson:"source_sha256"`
+	OutputChecksum string           `bson:"output_sha256"`
+	ReplayGain     *ReplayGain      `bson:"replay_gain"`
+	Versions       []ContentVersion `bson:"versions"` // Sorted from the oldest to the newest
+}
+
+// AlbumTrack holds the fields of a converted track needed to compute the album gain.
+type AlbumTrack struct {
+	Duration   string     `bson:"duration"` // HH:MM:SS
+	ReplayGain ReplayGain `bson:"replay_gain"`
+}
+
+// CachedConversion is an entry of the conversion cache: the output of a source converted with a preset.
+type CachedConversion struct {
+	ID             string      `bson:"_id"` // Source SHA-256 (hex) and preset
+	Bucket         string      `bson:"bucket"`
+	Key            string      `bson:"key"`           // Raw key of the output, not encoded
+	OutputChecksum string      `bson:"output_sha256"` // SHA-256 (hex) of the output
+	TagsChecksum   string      `bson:"tags_sha256"`   // SHA-256 (hex) of the metadata, cover and lyrics written to the output
+	Duration       float64     `bson:"duration"`
+	ReplayGain     *ReplayGain `bson:"replay_gain,omitempty"`
+	CreatedAt      time.Time   `bson:"created_at"`
+}
+
+// ContentRepository stores the conversion state of the content documents, implemented by the MongoDB, SQL and
+// in-memory backends. The documents are created by the application, the converter only updates them.
+// A conversion is started by a run, which sets PROCESSING and takes over any previous run unless it was started by a
+// newer S3 event (sequencer), and only that run
+// can make the following transitions: UPLOADING, SUCCESS (SaveConversion), FAILED (FailConversion) or CANCELLED
+// (CancelConversion, requested by an operator with the cancel_requested flag, which is cleared when a run starts so
+// a request left by a previous run can't cancel the next one).
+// The status transitions are conditional, see statusTransitions, and each one is appended to the status_history.
+// The progress is only saved while the run is PROCESSING.
+type ContentRepository interface {
+	StartConversion(collection, id, runID, sequencer string) error
+	TransitionStatus(collection, id, runID string, to ConversionStatus) error
+	SaveProgress(collection, id, runID string, progress ConversionProgress) error
+	SaveConversion(collection, id, runID string, result ConversionResult) error
+	FailConversion(collection, id, runID string, failure ConversionFailure) error
+	CancelConversion(collection, id, runID string) error
+	IsCancelRequested(collection, id string) (bool, error)
+	FindLastConversion(collection, id string) (LastConversion, error)
+	RemoveVersions(collection, id string, keys []string) error
+	FindAlbumTracks(collection, artist, album string) ([]AlbumTrack, error)
+	SaveAlbumGain(collection, artist, album string, gain, peak float64) error
+}
+
+// CacheRepository stores the conversion cache entries.
+type CacheRepository interface {
+	FindCachedConversion(id string) (CachedConversion, error)
+	SaveCachedConversion(cached CachedConversion) error
+	DeleteCachedConversion(id string) error
+}
+
+// Repository is the database of the converter, implemented by all the backends.
+type Repository interface {
+	ContentRepository
+	CacheRepository
+}
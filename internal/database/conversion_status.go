@@ -0,0 +1,101 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrTransitionRejected is returned (wrapped) when the document is not in a state from which the transition is
+// allowed, or its conversion was taken over by another run.
+var ErrTransitionRejected = errors.New("conversion status transition rejected")
+
+// ConversionStatus is the state of the conversion of a document, stored as conversion_status.
+type ConversionStatus string
+
+const (
+	StatusNone       ConversionStatus = "" // Documents created before the lifecycle states
+	StatusPending    ConversionStatus = "PENDING"
+	StatusQueued     ConversionStatus = "QUEUED"
+	StatusProcessing ConversionStatus = "PROCESSING"
+	StatusUploading  ConversionStatus = "UPLOADING"
+	StatusSuccess    ConversionStatus = "SUCCESS"
+	StatusFailed     ConversionStatus = "FAILED"
+	StatusCancelled  ConversionStatus = "CANCELLED"
+
+	statusLegacyError ConversionStatus = "ERROR" // Failure status before the lifecycle states
+)
+
+// sequencerLength is the length to which the S3 event sequencers are padded, so they compare as strings.
+const sequencerLength = 32
+
+// statusTransitions maps each state to the states it can go to.
+// INFO: A new conversion (PROCESSING) can start from any state, e.g. after a timeout or on a content update,
+// but not from an older S3 event than the last one, see canStartFrom. The transitions after it are also
+// filtered by the run which started it, so a run taken over can't finish.
+var statusTransitions = map[ConversionStatus][]ConversionStatus{
+	StatusNone:        {StatusPending, StatusQueued, StatusProcessing, StatusCancelled},
+	StatusPending:     {StatusQueued, StatusProcessing, StatusCancelled},
+	StatusQueued:      {StatusProcessing, StatusCancelled},
+	StatusProcessing:  {StatusProcessing, StatusUploading, StatusSuccess, StatusFailed, StatusCancelled},
+	StatusUploading:   {StatusProcessing, StatusSuccess, StatusFailed, StatusCancelled},
+	StatusSuccess:     {StatusQueued, StatusProcessing},
+	StatusFailed:      {StatusQueued, StatusProcessing},
+	StatusCancelled:   {StatusQueued, StatusProcessing},
+	statusLegacyError: {StatusQueued, StatusProcessing},
+}
+
+// StatusChange is an entry of the status_history of a document.
+type StatusChange struct {
+	Status ConversionStatus `bson:"status"`
+	RunID  string           `bson:"run_id,omitempty"`
+	At     time.Time        `bson:"at"`
+}
+
+// CanTransition reports whether a document can go from a state to another.
+func CanTransition(from, to ConversionStatus) bool {
+	return slices.Contains(statusTransitions[from], to)
+}
+
+// eventSequencer returns the S3 event sequencer left padded with zeros and upper cased, the S3 sequencers
+// of an object key are ordered by their hexadecimal value, but they can have different lengths.
+func eventSequencer(sequencer string) string {
+	sequencer = strings.ToUpper(strings.TrimSpace(sequencer))
+	if sequencer == "" || len(sequencer) >= sequencerLength {
+		return sequencer
+	}
+	return strings.Repeat("0", sequencerLength-len(sequencer)) + sequencer
+}
+
+// canStartFrom reports whether a conversion of the S3 event (sequencer) can start on a document whose last
+// conversion was started by the event stored (padded by eventSequencer) and is in the status.
+// INFO: Older events are rejected, so a delayed or redelivered event can't take over a newer conversion.
+// The same event can only start again a conversion which didn't succeed or wasn't cancelled, e.g. after a
+// timeout. A conversion without sequencer (not started by an S3 event) is not ordered.
+func canStartFrom(status ConversionStatus, stored, sequencer string) bool {
+	if !CanTransition(status, StatusProcessing) {
+		return false
+	}
+	if sequencer == "" || stored == "" || stored < sequencer {
+		return true
+	}
+	return stored == sequencer && !isFinalStart(status)
+}
+
+// isFinalStart reports whether the status ends the conversion of an event, it can't be started again by it.
+func isFinalStart(status ConversionStatus) bool {
+	return status == StatusSuccess || status == StatusCancelled
+}
+
+// statusesFrom returns the states from which a document can go to the state, sorted.
+func statusesFrom(to ConversionStatus) []ConversionStatus {
+	var from []ConversionStatus
+	for status := range statusTransitions {
+		if CanTransition(status, to) {
+			from = append(from, status)
+		}
+	}
+	slices.Sort(from)
+	return from
+}
@@ -0,0 +1,305 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryDocument is a content document kept by the MemoryRepository.
+type MemoryDocument struct {
+	Artist           string // Set by the application, used to find the tracks of an album
+	Album            string
+	ConversionStatus ConversionStatus
+	ConversionRunID  string
+	EventSequencer   string // S3 event sequencer of the last conversion, padded
+	StatusHistory    []StatusChange
+	ContentKey       string
+	LyricsKey        string
+	Duration         string
+	SourceChecksum   string
+	OutputChecksum   string
+	ReplayGain       *ReplayGain
+	Loudness         *Loudness
+	MusicAnalysis    *MusicAnalysis
+	AlbumGain        float64
+	AlbumPeak        float64
+	Versions         []ContentVersion
+	PresignedURLs    *PresignedURLs
+	Progress         *ConversionProgress
+	Failure          *ConversionFailure
+	CancelRequested  bool // Set by an operator to cancel the conversion
+}
+
+// MemoryRepository is a Repository kept in memory, used to run the pipeline in tests.
+type MemoryRepository struct {
+	mu        sync.RWMutex
+	documents map[string]map[string]*MemoryDocument
+	cache     map[string]CachedConversion
+}
+
+var _ Repository = (*MemoryRepository)(nil)
+
+// NewMemoryRepository creates a new empty MemoryRepository.
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		documents: make(map[string]map[string]*MemoryDocument),
+		cache:     make(map[string]CachedConversion),
+	}
+}
+
+// PutDocument adds or replaces a document, as the application does before uploading the job files.
+func (r *MemoryRepository) PutDocument(collection, id string, doc MemoryDocument) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.documents[collection] == nil {
+		r.documents[collection] = make(map[string]*MemoryDocument)
+	}
+	r.documents[collection][id] = &doc
+}
+
+// Document returns a copy of the document, false if it doesn't exist.
+func (r *MemoryRepository) Document(collection, id string) (MemoryDocument, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	doc, ok := r.documents[collection][id]
+	if !ok {
+		return MemoryDocument{}, false
+	}
+	copied := *doc
+	copied.Versions = slices.Clone(doc.Versions)
+	copied.StatusHistory = slices.Clone(doc.StatusHistory)
+	return copied, true
+}
+
+// StartConversion sets PROCESSING on the document with the run ID and the S3 event sequencer and clears its cancel
+// flag, taking over any previous run unless it was started by a newer event.
+func (r *MemoryRepository) StartConversion(collection, id, runID, sequencer string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc, ok := r.documents[collection][id]
+	if !ok {
+		return fmt.Errorf("no document found with ID %s: %w", id, ErrNotFound)
+	}
+
+	sequencer = eventSequencer(sequencer)
+	if !canStartFrom(doc.ConversionStatus, doc.EventSequencer, sequencer) {
+		return fmt.Errorf("document with ID %s can't go to %s on run %s: %w", id, StatusProcessing, runID, ErrTransitionRejected)
+	}
+
+	doc.ConversionStatus = StatusProcessing
+	doc.ConversionRunID = runID
+	doc.CancelRequested = false
+	if sequencer != "" {
+		doc.EventSequencer = sequencer
+	}
+	doc.StatusHistory = append(doc.StatusHistory, StatusChange{Status: StatusProcessing, RunID: runID, At: time.Now()})
+	return nil
+}
+
+// TransitionStatus sets the status on the document, if it's allowed and the conversion is of the run.
+func (r *MemoryRepository) TransitionStatus(collection, id, runID string, to ConversionStatus) error {
+	return r.transition(collection, id, runID, to, nil)
+}
+
+// SaveProgress sets the progress on the document, if the conversion of the run is PROCESSING.
+func (r *MemoryRepository) SaveProgress(collection, id, runID string, progress ConversionProgress) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc, ok := r.documents[collection][id]
+	if !ok {
+		return fmt.Errorf("no document found with ID %s: %w", id, ErrNotFound)
+	}
+	if doc.ConversionStatus != StatusProcessing || doc.ConversionRunID != runID {
+		return fmt.Errorf("document with ID %s is not processing on run %s: %w", id, runID, ErrTransitionRejected)
+	}
+	doc.Progress = &progress
+	return nil
+}
+
+// SaveConversion sets SUCCESS and the fields of the conversion on the document and appends its version,
+// if the conversion is of the run.
+func (r *MemoryRepository) SaveConversion(collection, id, runID string, result ConversionResult) error {
+	return r.transition(collection, id, runID, StatusSuccess, func(doc *MemoryDocument) {
+		doc.ContentKey = result.ContentKey
+		doc.Duration = result.Duration
+		doc.SourceChecksum = result.SourceChecksum
+		doc.OutputChecksum = result.OutputChecksum
+		doc.Failure = nil
+		doc.LyricsKey = result.LyricsKey // The synced lyrics of a previous conversion are cleared
+		if result.ReplayGain != nil {
+			replayGain := *result.ReplayGain
+			doc.ReplayGain = &replayGain
+		}
+		if result.Loudness != nil {
+			loudness := *result.Loudness
+			doc.Loudness = &loudness
+		}
+		if result.MusicAnalysis != nil {
+			analysis := *result.MusicAnalysis
+			doc.MusicAnalysis = &analysis
+		}
+		if result.PresignedURLs != nil {
+			doc.PresignedURLs = result.PresignedURLs
+		}
+		if result.Version != nil {
+			doc.Versions = append(doc.Versions, *result.Version)
+		}
+	})
+}
+
+// FindLastConversion returns the fields of the last conversion of the document.
+func (r *MemoryRepository) FindLastConversion(collection, id string) (LastConversion, error) {
+	doc, ok := r.Document(collection, id)
+	if !ok {
+		return LastConversion{}, fmt.Errorf("failed to find document with ID %s: %w", id, ErrNotFound)
+	}
+	return LastConversion{
+		SourceChecksum: doc.SourceChecksum,
+		OutputChecksum: doc.OutputChecksum,
+		ReplayGain:     doc.ReplayGain,
+		Versions:       doc.Versions,
+	}, nil
+}
+
+// RemoveVersions removes the versions with the given keys from the document.
+func (r *MemoryRepository) RemoveVersions(collection, id string, keys []string) error {
+	return r.update(collection, id, func(doc *MemoryDocument) {
+		doc.Versions = slices.DeleteFunc(doc.Versions, func(version ContentVersion) bool {
+			return slices.Contains(keys, version.Key)
+		})
+	})
+}
+
+// FindAlbumTracks returns the successfully converted tracks of the album with a measured loudness.
+func (r *MemoryRepository) FindAlbumTracks(collection, artist, album string) ([]AlbumTrack, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tracks []AlbumTrack
+	for _, doc := range r.documents[collection] {
+		if isAlbumTrack(doc, artist, album) {
+			tracks = append(tracks, AlbumTrack{Duration: doc.Duration, ReplayGain: *doc.ReplayGain})
+		}
+	}
+	return tracks, nil
+}
+
+// SaveAlbumGain sets the album gain on the tracks returned by FindAlbumTracks.
+func (r *MemoryRepository) SaveAlbumGain(collection, artist, album string, gain, peak float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, doc := range r.documents[collection] {
+		if isAlbumTrack(doc, artist, album) {
+			doc.AlbumGain, doc.AlbumPeak = gain, peak
+		}
+	}
+	return nil
+}
+
+// FindCachedConversion returns the cache entry with the ID.
+func (r *MemoryRepository) FindCachedConversion(id string) (CachedConversion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cached, ok := r.cache[id]
+	if !ok {
+		return cached, fmt.Errorf("failed to find cached conversion %s: %w", id, ErrNotFound)
+	}
+	return cached, nil
+}
+
+// SaveCachedConversion stores the cache entry, replacing the previous one with the same ID.
+func (r *MemoryRepository) SaveCachedConversion(cached CachedConversion) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cache[cached.ID] = cached
+	return nil
+}
+
+// DeleteCachedConversion removes the cache entry with the ID, removing a missing entry is not an error.
+func (r *MemoryRepository) DeleteCachedConversion(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.cache, id)
+	return nil
+}
+
+// update applies the change to the document, the error wraps ErrNotFound if it doesn't exist.
+func (r *MemoryRepository) update(collection, id string, change func(doc *MemoryDocument)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc, ok := r.documents[collection][id]
+	if !ok {
+		return fmt.Errorf("no document found with ID %s: %w", id, ErrNotFound)
+	}
+	change(doc)
+	return nil
+}
+
+// FailConversion sets FAILED and the failure on the document, if the conversion is of the run.
+func (r *MemoryRepository) FailConversion(collection, id, runID string, failure ConversionFailure) error {
+	return r.transition(collection, id, runID, StatusFailed, func(doc *MemoryDocument) {
+		doc.Failure = &failure
+	})
+}
+
+// CancelConversion sets CANCELLED on the document and clears its cancel flag, if the conversion is of the run.
+func (r *MemoryRepository) CancelConversion(collection, id, runID string) error {
+	return r.transition(collection, id, runID, StatusCancelled, func(doc *MemoryDocument) {
+		doc.CancelRequested = false
+	})
+}
+
+// IsCancelRequested reports whether the cancel flag is set on the document.
+func (r *MemoryRepository) IsCancelRequested(collection, id string) (bool, error) {
+	doc, ok := r.Document(collection, id)
+	if !ok {
+		return false, fmt.Errorf("failed to find document with ID %s: %w", id, ErrNotFound)
+	}
+	return doc.CancelRequested, nil
+}
+
+// RequestCancel sets the cancel flag on the document, as an operator does.
+func (r *MemoryRepository) RequestCancel(collection, id string) error {
+	return r.update(collection, id, func(doc *MemoryDocument) {
+		doc.CancelRequested = true
+	})
+}
+
+// transition sets the status on the document, applies the change (if not nil) and appends the status change to its
+// history, if the current status can go to it and the conversion is of the run.
+func (r *MemoryRepository) transition(collection, id, runID string, to ConversionStatus, change func(doc *MemoryDocument)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc, ok := r.documents[collection][id]
+	if !ok {
+		return fmt.Errorf("no document found with ID %s: %w", id, ErrNotFound)
+	}
+	if !CanTransition(doc.ConversionStatus, to) || doc.ConversionRunID != runID {
+		return fmt.Errorf("document with ID %s can't go to %s on run %s: %w", id, to, runID, ErrTransitionRejected)
+	}
+
+	doc.ConversionStatus = to
+	if change != nil {
+		change(doc)
+	}
+	doc.StatusHistory = append(doc.StatusHistory, StatusChange{Status: to, RunID: runID, At: time.Now()})
+	return nil
+}
+
+// isAlbumTrack reports whether the document is a successfully converted track of the album with a measured loudness.
+func isAlbumTrack(doc *MemoryDocument, artist, album string) bool {
+	return doc.Album == album && (artist == "" || doc.Artist == artist) &&
+		doc.ConversionStatus == StatusSuccess && doc.ReplayGain != nil
+}
@@ -0,0 +1,334 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MongoRepository is the MongoDB backend of Repository, each collection name is a MongoDB collection.
+type MongoRepository struct {
+	db              *mongo.Database
+	cacheCollection string
+}
+
+var _ Repository = (*MongoRepository)(nil)
+
+// NewMongoRepository creates a new MongoRepository with the shared MongoDB connection (MONGO_URI and MONGO_DB).
+// The conversion cache entries are stored in cacheCollection.
+func NewMongoRepository(cacheCollection string) (*MongoRepository, error) {
+	db, err := GetDatabase()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+	return &MongoRepository{db: db, cacheCollection: cacheCollection}, nil
+}
+
+// StartConversion sets PROCESSING on the document with the run ID and the S3 event sequencer and clears its
+// cancel_requested flag, taking over any previous run unless it was started by a newer event.
+func (r *MongoRepository) StartConversion(collection, id, runID, sequencer string) error {
+	return r.transition(collection, id, runID, true, eventSequencer(sequencer), StatusProcessing, map[string]any{"cancel_requested": false}, nil)
+}
+
+// TransitionStatus sets the status on the document, if it's allowed and the conversion is of the run.
+func (r *MongoRepository) TransitionStatus(collection, id, runID string, to ConversionStatus) error {
+	return r.transition(collection, id, runID, false, "", to, nil, nil)
+}
+
+// SaveProgress sets the progress on the document, if the conversion of the run is PROCESSING.
+func (r *MongoRepository) SaveProgress(collection, id, runID string, progress ConversionProgress) error {
+	objectID, err := parseObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": objectID, "conversion_run_id": runID, "conversion_status": StatusProcessing}
+	updateBson := bson.M{
+		"$set": bson.M{"progress": progress},
+	}
+
+	result, err := r.db.Collection(collection).UpdateOne(context.TODO(), filter, updateBson)
+	if err != nil {
+		return fmt.Errorf("failed to update progress of document with ID %s: %w", id, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("document with ID %s is not processing on run %s: %w", id, runID, ErrTransitionRejected)
+	}
+	return nil
+}
+
+// SaveConversion sets SUCCESS and the fields of the conversion on the document and appends its version,
+// if the conversion is of the run.
+func (r *MongoRepository) SaveConversion(collection, id, runID string, result ConversionResult) error {
+	fields := map[string]any{
+		"content_key":   result.ContentKey,
+		"duration":      result.Duration,
+		"source_sha256": result.SourceChecksum,
+		"output_sha256": result.OutputChecksum,
+		"failure":       nil,
+	}
+	// The synced lyrics of a previous conversion are cleared, their sidecar may be pruned with its version.
+	if result.LyricsKey != "" {
+		fields["synced_lyrics_key"] = result.LyricsKey
+		fields["has_synced_lyrics"] = true
+	} else {
+		fields["synced_lyrics_key"] = nil
+		fields["has_synced_lyrics"] = false
+	}
+	if result.ReplayGain != nil {
+		fields["replay_gain.integrated_loudness"] = result.ReplayGain.IntegratedLoudness
+		fields["replay_gain.true_peak"] = result.ReplayGain.TruePeak
+		fields["replay_gain.track_gain"] = result.ReplayGain.TrackGain
+		fields["replay_gain.track_peak"] = result.ReplayGain.TrackPeak
+	}
+	if result.Loudness != nil {
+		fields["loudness"] = result.Loudness
+	}
+	if analysis := result.MusicAnalysis; analysis != nil {
+		fields["bpm"] = analysis.BPM
+		fields["bpm_confidence"] = analysis.BPMConfidence
+		fields["key"] = analysis.Key
+		fields["key_confidence"] = analysis.KeyConfidence
+	}
+	if result.PresignedURLs != nil {
+		fields["presigned_urls"] = result.PresignedURLs
+	}
+
+	push := bson.M{}
+	if result.Version != nil {
+		push["versions"] = result.Version
+	}
+
+	return r.transition(collection, id, runID, false, "", StatusSuccess, fields, push)
+}
+
+// FailConversion sets FAILED and the failure on the document, if the conversion is of the run.
+func (r *MongoRepository) FailConversion(collection, id, runID string, failure ConversionFailure) error {
+	return r.transition(collection, id, runID, false, "", StatusFailed, map[string]any{"failure": failure}, nil)
+}
+
+// CancelConversion sets CANCELLED on the document and clears its cancel_requested flag, if the conversion is of the run.
+func (r *MongoRepository) CancelConversion(collection, id, runID string) error {
+	return r.transition(collection, id, runID, false, "", StatusCancelled, map[string]any{"cancel_requested": false}, nil)
+}
+
+// IsCancelRequested reports whether the cancel_requested flag is set on the document.
+func (r *MongoRepository) IsCancelRequested(collection, id string) (bool, error) {
+	objectID, err := parseObjectID(id)
+	if err != nil {
+		return false, err
+	}
+
+	var doc struct {
+		CancelRequested bool `bson:"cancel_requested"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"cancel_requested": 1})
+	err = r.db.Collection(collection).FindOne(context.TODO(), bson.M{"_id": objectID}, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to find document with ID %s: %w", id, err)
+	}
+	return doc.CancelRequested, nil
+}
+
+// transition sets the status and the fields on the document and appends the change to its status_history, if the
+// current status can go to it and the conversion is of the run or, if the run starts it, its S3 event (sequencer)
+// isn't older than the last one.
+func (r *MongoRepository) transition(collection, id, runID string, start bool, sequencer string, to ConversionStatus, fields map[string]any, push bson.M) error {
+	objectID, err := parseObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	// INFO: A null in $in also matches the documents without the field.
+	from := bson.A{}
+	for _, status := range statusesFrom(to) {
+		if status == StatusNone {
+			from = append(from, nil)
+			continue
+		}
+		from = append(from, status)
+	}
+	filter := bson.M{"_id": objectID, "conversion_status": bson.M{"$in": from}}
+	if !start {
+		filter["conversion_run_id"] = runID
+	}
+
+	set := map[string]any{"conversion_status": to}
+	if start {
+		set["conversion_run_id"] = runID
+	}
+	if start && sequencer != "" {
+		// INFO: Same conditions as canStartFrom, the status was already filtered by statusesFrom.
+		filter["$or"] = bson.A{
+			bson.M{"conversion_event_sequencer": bson.M{"$in": bson.A{nil, ""}}},
+			bson.M{"conversion_event_sequencer": bson.M{"$lt": sequencer}},
+			bson.M{"conversion_event_sequencer": sequencer, "conversion_status": bson.M{"$nin": bson.A{StatusSuccess, StatusCancelled}}},
+		}
+		set["conversion_event_sequencer"] = sequencer
+	}
+	for field, value := range fields {
+		set[field] = value
+	}
+	if push == nil {
+		push = bson.M{}
+	}
+	push["status_history"] = StatusChange{Status: to, RunID: runID, At: time.Now()}
+
+	updateBson := bson.M{
+		"$set":  set,
+		"$push": push,
+	}
+
+	result, err := r.db.Collection(collection).UpdateOne(context.TODO(), filter, updateBson)
+	if err != nil {
+		return fmt.Errorf("failed to update document with ID %s: %w", id, err)
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	count, err := r.db.Collection(collection).CountDocuments(context.TODO(), bson.M{"_id": objectID})
+	if err != nil {
+		return fmt.Errorf("failed to find document with ID %s: %w", id, err)
+	}
+	if count == 0 {
+		return fmt.Errorf("no document found with ID %s: %w", id, ErrNotFound)
+	}
+	return fmt.Errorf("document with ID %s can't go to %s on run %s: %w", id, to, runID, ErrTransitionRejected)
+}
+
+// FindLastConversion returns the fields of the last conversion of the document.
+func (r *MongoRepository) FindLastConversion(collection, id string) (LastConversion, error) {
+	var last LastConversion
+
+	objectID, err := parseObjectID(id)
+	if err != nil {
+		return last, err
+	}
+
+	err = r.db.Collection(collection).FindOne(context.TODO(), bson.M{"_id": objectID}).Decode(&last)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return last, fmt.Errorf("failed to find document with ID %s: %w", id, err)
+	}
+	return last, nil
+}
+
+// RemoveVersions removes the versions with the given keys from the document.
+func (r *MongoRepository) RemoveVersions(collection, id string, keys []string) error {
+	updateBson := bson.M{
+		"$pull": bson.M{"versions": bson.M{"key": bson.M{"$in": keys}}},
+	}
+	return r.updateByID(collection, id, updateBson)
+}
+
+// FindAlbumTracks returns the successfully converted tracks of the album with a measured loudness.
+func (r *MongoRepository) FindAlbumTracks(collection, artist, album string) ([]AlbumTrack, error) {
+	cursor, err := r.db.Collection(collection).Find(context.TODO(), albumFilter(artist, album))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tracks of album %s: %w", album, err)
+	}
+
+	var tracks []AlbumTrack
+	if err := cursor.All(context.TODO(), &tracks); err != nil {
+		return nil, fmt.Errorf("failed to decode tracks of album %s: %w", album, err)
+	}
+	return tracks, nil
+}
+
+// SaveAlbumGain sets the album gain on the tracks returned by FindAlbumTracks.
+func (r *MongoRepository) SaveAlbumGain(collection, artist, album string, gain, peak float64) error {
+	updateBson := bson.M{
+		"$set": map[string]any{
+			"replay_gain.album_gain": gain,
+			"replay_gain.album_peak": peak,
+		},
+	}
+
+	if _, err := r.db.Collection(collection).UpdateMany(context.TODO(), albumFilter(artist, album), updateBson); err != nil {
+		return fmt.Errorf("failed to update album gain of %s: %w", album, err)
+	}
+	return nil
+}
+
+// FindCachedConversion returns the cache entry with the ID.
+func (r *MongoRepository) FindCachedConversion(id string) (CachedConversion, error) {
+	var cached CachedConversion
+
+	err := r.db.Collection(r.cacheCollection).FindOne(context.TODO(), bson.M{"_id": id}).Decode(&cached)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return cached, fmt.Errorf("failed to find cached conversion %s: %w", id, err)
+	}
+	return cached, nil
+}
+
+// SaveCachedConversion stores the cache entry, replacing the previous one with the same ID.
+func (r *MongoRepository) SaveCachedConversion(cached CachedConversion) error {
+	filter := bson.M{"_id": cached.ID}
+	if _, err := r.db.Collection(r.cacheCollection).ReplaceOne(context.TODO(), filter, cached, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to store cached conversion %s: %w", cached.ID, err)
+	}
+	return nil
+}
+
+// DeleteCachedConversion removes the cache entry with the ID, removing a missing entry is not an error.
+func (r *MongoRepository) DeleteCachedConversion(id string) error {
+	if _, err := r.db.Collection(r.cacheCollection).DeleteOne(context.TODO(), bson.M{"_id": id}); err != nil {
+		return fmt.Errorf("failed to delete cached conversion %s: %w", id, err)
+	}
+	return nil
+}
+
+// updateByID applies the update to the document, the error wraps ErrNotFound if it doesn't exist.
+func (r *MongoRepository) updateByID(collection, id string, updateBson bson.M) error {
+	objectID, err := parseObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Collection(collection).UpdateByID(context.TODO(), objectID, updateBson)
+	if err != nil {
+		return fmt.Errorf("failed to update document with ID %s: %w", id, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no document found with ID %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// parseObjectID parses the hex ID of a document.
+func parseObjectID(id string) (bson.ObjectID, error) {
+	objectID, err := bson.ObjectIDFromHex(strings.TrimSpace(id))
+	if err != nil {
+		return objectID, fmt.Errorf("invalid ID format: %w", err)
+	}
+	return objectID, nil
+}
+
+// albumFilter matches the successfully converted tracks of the album with a measured loudness.
+func albumFilter(artist, album string) bson.M {
+	filter := bson.M{
+		"album":             album,
+		"conversion_status": "SUCCESS",
+		"replay_gain":       bson.M{"$exists": true},
+	}
+	if artist != "" {
+		filter["artist"] = artist
+	}
+	return filter
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testCollection = "music"
+
+// testBackend is a Repository under test with the operations done by the application on its documents.
+type testBackend struct {
+	name          string
+	repo          Repository
+	create        func(t *testing.T, id, artist, album string) // Creates a document without status
+	requestCancel func(t *testing.T, id string)
+	syncedLyrics  func(t *testing.T, id string) (key string, has bool) // Synced lyrics fields of the document
+}
+
+// testBackends returns the in-memory backend and the SQL one on a SQLite database with doc/sql_schema.sql.
+func testBackends(t *testing.T) []testBackend {
+	t.Helper()
+
+	memory := NewMemoryRepository()
+	memoryBackend := testBackend{
+		name: "memory",
+		repo: memory,
+		create: func(t *testing.T, id, artist, album string) {
+			memory.PutDocument(testCollection, id, MemoryDocument{Artist: artist, Album: album})
+		},
+		requestCancel: func(t *testing.T, id string) {
+			if err := memory.RequestCancel(testCollection, id); err != nil {
+				t.Fatal(err)
+			}
+		},
+		syncedLyrics: func(t *testing.T, id string) (string, bool) {
+			doc, _ := memory.Document(testCollection, id)
+			return doc.LyricsKey, doc.LyricsKey != ""
+		},
+	}
+
+	schema, err := os.ReadFile(filepath.Join("..", "..", "doc", "sql_schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := NewSQLRepository("sqlite", filepath.Join(t.TempDir(), "converter.db"), "conversion_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if _, err := sqlite.db.Exec(string(schema)); err != nil {
+		t.Fatalf("failed to apply schema: %v", err)
+	}
+	sqliteBackend := testBackend{
+		name: "sqlite",
+		repo: sqlite,
+		create: func(t *testing.T, id, artist, album string) {
+			if _, err := sqlite.db.Exec(`INSERT INTO music (id, artist, album) VALUES ($1, $2, $3)`, id, artist, album); err != nil {
+				t.Fatal(err)
+			}
+		},
+		requestCancel: func(t *testing.T, id string) {
+			if _, err := sqlite.db.Exec(`UPDATE music SET cancel_requested = TRUE WHERE id = $1`, id); err != nil {
+				t.Fatal(err)
+			}
+		},
+		syncedLyrics: func(t *testing.T, id string) (string, bool) {
+			var key sql.NullString
+			var has bool
+			err := sqlite.db.QueryRow(`SELECT synced_lyrics_key, has_synced_lyrics FROM music WHERE id = $1`, id).Scan(&key, &has)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return key.String, has
+		},
+	}
+
+	return []testBackend{memoryBackend, sqliteBackend}
+}
+
+// conversionResult returns the result of a conversion with all the optional fields and the version.
+func conversionResult(version ContentVersion) ConversionResult {
+	return ConversionResult{
+		ContentKey:     version.Key,
+		LyricsKey:      "doc/title.lrc",
+		Duration:       "00:03:30",
+		ReplayGain:     &ReplayGain{IntegratedLoudness: -14, TruePeak: -1, TrackGain: -4, TrackPeak: 0.89},
+		Loudness:       &Loudness{Integrated: -14, ShortTermMax: -10, Range: 6, TruePeak: -1},
+		MusicAnalysis:  &MusicAnalysis{BPM: 128, BPMConfidence: 0.8, Key: "Am", KeyConfidence: 0.6},
+		SourceChecksum: "source",
+		OutputChecksum: version.Checksum,
+		Version:        &version,
+		PresignedURLs:  &PresignedURLs{Content: "https://example.com/content", ExpiresAt: version.CreatedAt.Add(time.Hour)},
+	}
+}
+
+// TestContentRepositoryContract runs the lifecycle of a document on each backend, they must behave the same.
+func TestContentRepositoryContract(t *testing.T) {
+	createdAt := time.Date(2025, 6, 29, 22, 19, 58, 0, time.UTC)
+	first := ContentVersion{Key: "doc/versions/1/title.m4a", Checksum: "output1", Preset: "aac-m4a", CreatedAt: createdAt}
+	second := ContentVersion{Key: "doc/versions/2/title.m4a", Checksum: "output2", Preset: "aac-m4a", CreatedAt: createdAt.Add(time.Minute)}
+
+	for _, backend := range testBackends(t) {
+		t.Run(backend.name, func(t *testing.T) {
+			repo := backend.repo
+			backend.create(t, "doc", "Artist", "Album")
+
+			expect := func(step string, err, want error) {
+				t.Helper()
+				if (want == nil && err != nil) || !errors.Is(err, want) {
+					t.Fatalf("%s: error = %v, want %v", step, err, want)
+				}
+			}
+
+			// A document without status (NULL on SQL) can start.
+			expect("start without status", repo.StartConversion(testCollection, "doc", "run1", "0A"), nil)
+			progress := ConversionProgress{Percent: 50, Speed: 2, ETASeconds: 10, UpdatedAt: createdAt}
+			expect("progress of the run", repo.SaveProgress(testCollection, "doc", "run1", progress), nil)
+			expect("progress of another run", repo.SaveProgress(testCollection, "doc", "other", progress), ErrTransitionRejected)
+			expect("transition of another run", repo.TransitionStatus(testCollection, "doc", "other", StatusUploading), ErrTransitionRejected)
+			expect("uploading", repo.TransitionStatus(testCollection, "doc", "run1", StatusUploading), nil)
+			expect("save", repo.SaveConversion(testCollection, "doc", "run1", conversionResult(first)), nil)
+
+			last, err := repo.FindLastConversion(testCollection, "doc")
+			expect("find last conversion", err, nil)
+			if last.SourceChecksum != "source" || last.OutputChecksum != "output1" || last.ReplayGain == nil ||
+				last.ReplayGain.TrackGain != -4 || len(last.Versions) != 1 || last.Versions[0].Key != first.Key ||
+				!last.Versions[0].CreatedAt.Equal(createdAt) {
+				t.Fatalf("last conversion = %+v", last)
+			}
+
+			if key, has := backend.syncedLyrics(t, "doc"); key != "doc/title.lrc" || !has {
+				t.Fatalf("synced lyrics = %q, %v, want %q, true", key, has, "doc/title.lrc")
+			}
+
+			tracks, err := repo.FindAlbumTracks(testCollection, "Artist", "Album")
+			expect("find album tracks", err, nil)
+			if len(tracks) != 1 || tracks[0].Duration != "00:03:30" || tracks[0].ReplayGain.TruePeak != -1 {
+				t.Fatalf("album tracks = %+v", tracks)
+			}
+			expect("save album gain", repo.SaveAlbumGain(testCollection, "Artist", "Album", -5, 0.9), nil)
+			if tracks, _ := repo.FindAlbumTracks(testCollection, "Other", "Album"); len(tracks) != 0 {
+				t.Fatalf("album tracks of another artist = %+v", tracks)
+			}
+
+			// The S3 events are ordered by their sequencer, of different lengths.
+			expect("start by the same event", repo.StartConversion(testCollection, "doc", "run2", "0a"), ErrTransitionRejected)
+			expect("start by an older event", repo.StartConversion(testCollection, "doc", "run2", "9"), ErrTransitionRejected)
+			expect("start by a newer event", repo.StartConversion(testCollection, "doc", "run2", "0B"), nil)
+
+			// A cancellation requested before a run doesn't cancel it.
+			backend.requestCancel(t, "doc")
+			requested, err := repo.IsCancelRequested(testCollection, "doc")
+			if err != nil || !requested {
+				t.Fatalf("cancel requested = %v, %v, want true", requested, err)
+			}
+			expect("take over", repo.StartConversion(testCollection, "doc", "run3", "0C"), nil)
+			requested, err = repo.IsCancelRequested(testCollection, "doc")
+			if err != nil || requested {
+				t.Fatalf("cancel requested after the start = %v, %v, want false", requested, err)
+			}
+
+			failure := ConversionFailure{Code: "INVALID_DATA", Message: "failed", Stderr: []string{"a", "b"}, At: createdAt}
+			expect("fail of a run taken over", repo.FailConversion(testCollection, "doc", "run2", failure), ErrTransitionRejected)
+			expect("fail", repo.FailConversion(testCollection, "doc", "run3", failure), nil)
+
+			// A retry of the same event after a failure, or a start without event, can start.
+			expect("retry after a failure", repo.StartConversion(testCollection, "doc", "run4", "0C"), nil)
+			expect("cancel", repo.CancelConversion(testCollection, "doc", "run4"), nil)
+			expect("start without event", repo.StartConversion(testCollection, "doc", "run5", ""), nil)
+			// A conversion without synced lyrics clears the ones of the previous conversion.
+			withoutLyrics := conversionResult(second)
+			withoutLyrics.LyricsKey = ""
+			expect("save the second version", repo.SaveConversion(testCollection, "doc", "run5", withoutLyrics), nil)
+			if key, has := backend.syncedLyrics(t, "doc"); key != "" || has {
+				t.Fatalf("synced lyrics after a conversion without them = %q, %v, want empty", key, has)
+			}
+			expect("cancel after the success", repo.CancelConversion(testCollection, "doc", "run5"), ErrTransitionRejected)
+
+			expect("remove versions", repo.RemoveVersions(testCollection, "doc", []string{first.Key}), nil)
+			last, err = repo.FindLastConversion(testCollection, "doc")
+			expect("find last conversion", err, nil)
+			if last.OutputChecksum != "output2" || len(last.Versions) != 1 || last.Versions[0].Key != second.Key {
+				t.Fatalf("last conversion after the removal = %+v", last)
+			}
+
+			expect("start of a missing document", repo.StartConversion(testCollection, "missing", "run", ""), ErrNotFound)
+			_, err = repo.FindLastConversion(testCollection, "missing")
+			expect("find a missing document", err, ErrNotFound)
+		})
+	}
+}
+
+func TestCacheRepositoryContract(t *testing.T) {
+	createdAt := time.Date(2025, 6, 29, 22, 19, 58, 0, time.UTC)
+	cached := CachedConversion{
+		ID:             "source-aac-m4a",
+		Bucket:         "bucket",
+		Key:            "doc/title.m4a",
+		OutputChecksum: "output",
+		TagsChecksum:   "tags",
+		Duration:       210.5,
+		CreatedAt:      createdAt,
+	}
+
+	for _, backend := range testBackends(t) {
+		t.Run(backend.name, func(t *testing.T) {
+			repo := backend.repo
+
+			if _, err := repo.FindCachedConversion(cached.ID); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("find a missing entry: error = %v, want %v", err, ErrNotFound)
+			}
+
+			if err := repo.SaveCachedConversion(cached); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+			got, err := repo.FindCachedConversion(cached.ID)
+			if err != nil || got.Key != cached.Key || got.Duration != cached.Duration || got.ReplayGain != nil || !got.CreatedAt.Equal(createdAt) {
+				t.Fatalf("find = %+v, %v", got, err)
+			}
+
+			// Saving again replaces the entry.
+			replaced := cached
+			replaced.Key = "doc/other.m4a"
+			replaced.ReplayGain = &ReplayGain{IntegratedLoudness: -14, TruePeak: -1, TrackGain: -4, TrackPeak: 0.89}
+			if err := repo.SaveCachedConversion(replaced); err != nil {
+				t.Fatalf("save again: %v", err)
+			}
+			got, err = repo.FindCachedConversion(cached.ID)
+			if err != nil || got.Key != replaced.Key || got.ReplayGain == nil || *got.ReplayGain != *replaced.ReplayGain {
+				t.Fatalf("find the replaced entry = %+v, %v", got, err)
+			}
+
+			if err := repo.DeleteCachedConversion(cached.ID); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if err := repo.DeleteCachedConversion(cached.ID); err != nil {
+				t.Fatalf("delete a missing entry: %v", err)
+			}
+			if _, err := repo.FindCachedConversion(cached.ID); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("find a deleted entry: error = %v, want %v", err, ErrNotFound)
+			}
+		})
+	}
+}
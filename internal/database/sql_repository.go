@@ -0,0 +1,457 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // Registers the "pgx" driver
+	_ "modernc.org/sqlite"             // Registers the "sqlite" driver
+)
+
+// identifierRegex matches the collection names which can be used as table names.
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLRepository is the PostgreSQL and SQLite backend of Repository. Each collection name is a table with the
+// versions in the "<collection>_versions" table and the status history in the "<collection>_status_history" table,
+// see doc/sql_schema.sql.
+// INFO: The queries only use the syntax common to both databases, with the parameters in order ($1, $2, ...).
+type SQLRepository struct {
+	db         *sql.DB
+	cacheTable string
+}
+
+var _ Repository = (*SQLRepository)(nil)
+
+// NewSQLRepository opens the database with the driver ("pgx" for PostgreSQL or "sqlite") and the DSN.
+// The conversion cache entries are stored in cacheTable.
+func NewSQLRepository(driver, dsn, cacheTable string) (*SQLRepository, error) {
+	if cacheTable != "" && !identifierRegex.MatchString(cacheTable) {
+		return nil, fmt.Errorf("invalid cache table name: %q", cacheTable)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", driver, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping %s database: %w", driver, err)
+	}
+	return &SQLRepository{db: db, cacheTable: cacheTable}, nil
+}
+
+// Close closes the database.
+func (r *SQLRepository) Close() error {
+	return r.db.Close()
+}
+
+// StartConversion sets PROCESSING on the row of the document with the run ID and the S3 event sequencer and clears
+// its cancel_requested flag, taking over any previous run unless it was started by a newer event.
+func (r *SQLRepository) StartConversion(collection, id, runID, sequencer string) error {
+	return r.transition(collection, id, runID, true, eventSequencer(sequencer), StatusProcessing, []string{"cancel_requested"}, []any{false}, nil)
+}
+
+// TransitionStatus sets the status on the row of the document, if it's allowed and the conversion is of the run.
+func (r *SQLRepository) TransitionStatus(collection, id, runID string, to ConversionStatus) error {
+	return r.transition(collection, id, runID, false, "", to, nil, nil, nil)
+}
+
+// SaveProgress sets the progress on the row of the document, if the conversion of the run is PROCESSING.
+func (r *SQLRepository) SaveProgress(collection, id, runID string, progress ConversionProgress) error {
+	table, err := tableName(collection)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`UPDATE "%s" SET progress_percent = $1, progress_speed = $2, progress_eta_seconds = $3,
+		progress_updated_at = $4 WHERE id = $5 AND conversion_run_id = $6 AND conversion_status = $7`, table)
+	result, err := r.db.Exec(query, progress.Percent, progress.Speed, progress.ETASeconds, progress.UpdatedAt.UTC(),
+		id, runID, string(StatusProcessing))
+	if err != nil {
+		return fmt.Errorf("failed to update progress of document with ID %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("document with ID %s is not processing on run %s: %w", id, runID, ErrTransitionRejected)
+	}
+	return nil
+}
+
+// SaveConversion sets SUCCESS and the columns of the conversion on the row of the document and inserts its version,
+// if the conversion is of the run.
+func (r *SQLRepository) SaveConversion(collection, id, runID string, result ConversionResult) error {
+	columns := []string{"content_key", "duration", "source_sha256", "output_sha256",
+		"failure_code", "failure_message", "failure_stderr", "failure_debug_bundle_key", "failure_retryable", "failure_at"}
+	args := []any{result.ContentKey, result.Duration, result.SourceChecksum, result.OutputChecksum, nil, nil, nil, nil, nil, nil}
+	// The synced lyrics of a previous conversion are cleared, their sidecar may be pruned with its version.
+	columns = append(columns, "synced_lyrics_key", "has_synced_lyrics")
+	if result.LyricsKey != "" {
+		args = append(args, result.LyricsKey, true)
+	} else {
+		args = append(args, nil, false)
+	}
+	if gain := result.ReplayGain; gain != nil {
+		columns = append(columns, "replay_gain_integrated_loudness", "replay_gain_true_peak", "replay_gain_track_gain", "replay_gain_track_peak")
+		args = append(args, gain.IntegratedLoudness, gain.TruePeak, gain.TrackGain, gain.TrackPeak)
+	}
+	if loudness := result.Loudness; loudness != nil {
+		columns = append(columns, "loudness_integrated", "loudness_short_term_max", "loudness_range", "loudness_true_peak")
+		args = append(args, loudness.Integrated, loudness.ShortTermMax, loudness.Range, loudness.TruePeak)
+	}
+	if analysis := result.MusicAnalysis; analysis != nil {
+		columns = append(columns, "bpm", "bpm_confidence", "musical_key", "key_confidence")
+		args = append(args, analysis.BPM, analysis.BPMConfidence, analysis.Key, analysis.KeyConfidence)
+	}
+	if urls := result.PresignedURLs; urls != nil {
+		columns = append(columns, "presigned_content_url", "presigned_synced_lyrics_url", "presigned_urls_expire_at")
+		args = append(args, urls.Content, urls.SyncedLyrics, urls.ExpiresAt.UTC())
+	}
+
+	return r.transition(collection, id, runID, false, "", StatusSuccess, columns, args, result.Version)
+}
+
+// FailConversion sets FAILED and the failure on the row of the document, if the conversion is of the run.
+// The stderr lines are stored joined by newlines.
+func (r *SQLRepository) FailConversion(collection, id, runID string, failure ConversionFailure) error {
+	columns := []string{"failure_code", "failure_message", "failure_stderr", "failure_debug_bundle_key", "failure_retryable", "failure_at"}
+	args := []any{failure.Code, failure.Message, strings.Join(failure.Stderr, "\n"), failure.DebugBundleKey, failure.Retryable, failure.At.UTC()}
+	return r.transition(collection, id, runID, false, "", StatusFailed, columns, args, nil)
+}
+
+// CancelConversion sets CANCELLED on the row of the document and clears its cancel_requested flag, if the
+// conversion is of the run.
+func (r *SQLRepository) CancelConversion(collection, id, runID string) error {
+	return r.transition(collection, id, runID, false, "", StatusCancelled, []string{"cancel_requested"}, []any{false}, nil)
+}
+
+// IsCancelRequested reports whether the cancel_requested flag is set on the row of the document.
+func (r *SQLRepository) IsCancelRequested(collection, id string) (bool, error) {
+	table, err := tableName(collection)
+	if err != nil {
+		return false, err
+	}
+
+	var requested bool
+	err = r.db.QueryRow(fmt.Sprintf(`SELECT cancel_requested FROM "%s" WHERE id = $1`, table), id).Scan(&requested)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to find document with ID %s: %w", id, err)
+	}
+	return requested, nil
+}
+
+// transition sets the status and the columns on the row of the document, inserts the status change in the
+// "<collection>_status_history" table and the version (if not nil), if the current status can go to it and the
+// conversion is of the run or, if the run starts it, its S3 event (sequencer) isn't older than the last one.
+func (r *SQLRepository) transition(collection, id, runID string, start bool, sequencer string, to ConversionStatus, columns []string, args []any, version *ContentVersion) error {
+	table, err := tableName(collection)
+	if err != nil {
+		return err
+	}
+
+	columns = append([]string{"conversion_status"}, columns...)
+	args = append([]any{string(to)}, args...)
+	if start {
+		columns = append(columns, "conversion_run_id")
+		args = append(args, runID)
+	}
+	if start && sequencer != "" {
+		columns = append(columns, "conversion_event_sequencer")
+		args = append(args, sequencer)
+	}
+
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = fmt.Sprintf("%s = $%d", column, i+1)
+	}
+
+	args = append(args, id)
+	where := fmt.Sprintf("id = $%d", len(args))
+
+	// INFO: The documents created before the lifecycle states have no status (NULL or empty).
+	from := statusesFrom(to)
+	condition := fmt.Sprintf("conversion_status IN (%s)", placeholders(len(args)+1, len(from)))
+	for _, status := range from {
+		args = append(args, string(status))
+	}
+	if slices.Contains(from, StatusNone) {
+		condition += " OR conversion_status IS NULL"
+	}
+	where += " AND (" + condition + ")"
+
+	if !start {
+		args = append(args, runID)
+		where += fmt.Sprintf(" AND conversion_run_id = $%d", len(args))
+	}
+	if start && sequencer != "" {
+		// INFO: Same conditions as canStartFrom, the status was already filtered by statusesFrom.
+		n := len(args)
+		args = append(args, sequencer, sequencer, string(StatusSuccess), string(StatusCancelled))
+		where += fmt.Sprintf(` AND (conversion_event_sequencer IS NULL OR conversion_event_sequencer = '' OR
+			conversion_event_sequencer < $%d OR (conversion_event_sequencer = $%d AND conversion_status NOT IN ($%d, $%d)))`,
+			n+1, n+2, n+3, n+4)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after the commit
+
+	query := fmt.Sprintf(`UPDATE "%s" SET %s WHERE %s`, table, strings.Join(assignments, ", "), where)
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update document with ID %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		var exists int
+		err := tx.QueryRow(fmt.Sprintf(`SELECT 1 FROM "%s" WHERE id = $1`, table), id).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no document found with ID %s: %w", id, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find document with ID %s: %w", id, err)
+		}
+		return fmt.Errorf("document with ID %s can't go to %s on run %s: %w", id, to, runID, ErrTransitionRejected)
+	}
+
+	query = fmt.Sprintf(`INSERT INTO "%s_status_history" (document_id, status, run_id, at) VALUES ($1, $2, $3, $4)`, table)
+	if _, err := tx.Exec(query, id, string(to), runID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to insert status change of document with ID %s: %w", id, err)
+	}
+
+	if version != nil {
+		query := fmt.Sprintf(`INSERT INTO "%s_versions" (document_id, object_key, sha256, preset, created_at) VALUES ($1, $2, $3, $4, $5)`, table)
+		if _, err := tx.Exec(query, id, version.Key, version.Checksum, version.Preset, version.CreatedAt.UTC()); err != nil {
+			return fmt.Errorf("failed to insert version of document with ID %s: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit status %s of document with ID %s: %w", to, id, err)
+	}
+	return nil
+}
+
+// FindLastConversion returns the columns of the last conversion of the document and its versions.
+func (r *SQLRepository) FindLastConversion(collection, id string) (LastConversion, error) {
+	var last LastConversion
+
+	table, err := tableName(collection)
+	if err != nil {
+		return last, err
+	}
+
+	var source, output sql.NullString
+	var gain nullReplayGain
+	query := fmt.Sprintf(`SELECT source_sha256, output_sha256, replay_gain_integrated_loudness, replay_gain_true_peak,
+		replay_gain_track_gain, replay_gain_track_peak FROM "%s" WHERE id = $1`, table)
+	err = r.db.QueryRow(query, id).Scan(&source, &output, &gain.integratedLoudness, &gain.truePeak, &gain.trackGain, &gain.trackPeak)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return last, fmt.Errorf("failed to find document with ID %s: %w", id, err)
+	}
+	last.SourceChecksum, last.OutputChecksum, last.ReplayGain = source.String, output.String, gain.replayGain()
+
+	query = fmt.Sprintf(`SELECT object_key, sha256, preset, created_at FROM "%s_versions"
+		WHERE document_id = $1 ORDER BY created_at, object_key`, table)
+	rows, err := r.db.Query(query, id)
+	if err != nil {
+		return last, fmt.Errorf("failed to find versions of document with ID %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version ContentVersion
+		if err := rows.Scan(&version.Key, &version.Checksum, &version.Preset, &version.CreatedAt); err != nil {
+			return last, fmt.Errorf("failed to read version of document with ID %s: %w", id, err)
+		}
+		last.Versions = append(last.Versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return last, fmt.Errorf("failed to read versions of document with ID %s: %w", id, err)
+	}
+	return last, nil
+}
+
+// RemoveVersions removes the versions with the given keys from the document.
+func (r *SQLRepository) RemoveVersions(collection, id string, keys []string) error {
+	table, err := tableName(collection)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := []any{id}
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	query := fmt.Sprintf(`DELETE FROM "%s_versions" WHERE document_id = $1 AND object_key IN (%s)`, table, placeholders(2, len(keys)))
+	if _, err := r.db.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to remove versions of document with ID %s: %w", id, err)
+	}
+	return nil
+}
+
+// FindAlbumTracks returns the successfully converted tracks of the album with a measured loudness.
+func (r *SQLRepository) FindAlbumTracks(collection, artist, album string) ([]AlbumTrack, error) {
+	table, err := tableName(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := albumWhere(artist, album, 1)
+	query := fmt.Sprintf(`SELECT duration, replay_gain_integrated_loudness, replay_gain_true_peak, replay_gain_track_gain,
+		replay_gain_track_peak FROM "%s" WHERE %s`, table, where)
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tracks of album %s: %w", album, err)
+	}
+	defer rows.Close()
+
+	var tracks []AlbumTrack
+	for rows.Next() {
+		var track AlbumTrack
+		gain := &track.ReplayGain
+		if err := rows.Scan(&track.Duration, &gain.IntegratedLoudness, &gain.TruePeak, &gain.TrackGain, &gain.TrackPeak); err != nil {
+			return nil, fmt.Errorf("failed to read track of album %s: %w", album, err)
+		}
+		tracks = append(tracks, track)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tracks of album %s: %w", album, err)
+	}
+	return tracks, nil
+}
+
+// SaveAlbumGain sets the album gain on the tracks returned by FindAlbumTracks.
+func (r *SQLRepository) SaveAlbumGain(collection, artist, album string, gain, peak float64) error {
+	table, err := tableName(collection)
+	if err != nil {
+		return err
+	}
+
+	where, args := albumWhere(artist, album, 3)
+	query := fmt.Sprintf(`UPDATE "%s" SET replay_gain_album_gain = $1, replay_gain_album_peak = $2 WHERE %s`, table, where)
+	if _, err := r.db.Exec(query, append([]any{gain, peak}, args...)...); err != nil {
+		return fmt.Errorf("failed to update album gain of %s: %w", album, err)
+	}
+	return nil
+}
+
+// FindCachedConversion returns the cache entry with the ID.
+func (r *SQLRepository) FindCachedConversion(id string) (CachedConversion, error) {
+	var cached CachedConversion
+	var gain nullReplayGain
+
+	query := fmt.Sprintf(`SELECT id, bucket, object_key, output_sha256, tags_sha256, duration, replay_gain_integrated_loudness,
+		replay_gain_true_peak, replay_gain_track_gain, replay_gain_track_peak, created_at FROM "%s" WHERE id = $1`, r.cacheTable)
+	err := r.db.QueryRow(query, id).Scan(&cached.ID, &cached.Bucket, &cached.Key, &cached.OutputChecksum, &cached.TagsChecksum,
+		&cached.Duration, &gain.integratedLoudness, &gain.truePeak, &gain.trackGain, &gain.trackPeak, &cached.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return cached, fmt.Errorf("failed to find cached conversion %s: %w", id, err)
+	}
+	cached.ReplayGain = gain.replayGain()
+	return cached, nil
+}
+
+// SaveCachedConversion stores the cache entry, replacing the previous one with the same ID.
+func (r *SQLRepository) SaveCachedConversion(cached CachedConversion) error {
+	var gain nullReplayGain
+	if cached.ReplayGain != nil {
+		gain = newNullReplayGain(*cached.ReplayGain)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO "%s" (id, bucket, object_key, output_sha256, tags_sha256, duration,
+		replay_gain_integrated_loudness, replay_gain_true_peak, replay_gain_track_gain, replay_gain_track_peak, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO UPDATE SET bucket = excluded.bucket, object_key = excluded.object_key,
+		output_sha256 = excluded.output_sha256, tags_sha256 = excluded.tags_sha256, duration = excluded.duration,
+		replay_gain_integrated_loudness = excluded.replay_gain_integrated_loudness,
+		replay_gain_true_peak = excluded.replay_gain_true_peak, replay_gain_track_gain = excluded.replay_gain_track_gain,
+		replay_gain_track_peak = excluded.replay_gain_track_peak, created_at = excluded.created_at`, r.cacheTable)
+	_, err := r.db.Exec(query, cached.ID, cached.Bucket, cached.Key, cached.OutputChecksum, cached.TagsChecksum, cached.Duration,
+		gain.integratedLoudness, gain.truePeak, gain.trackGain, gain.trackPeak, cached.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to store cached conversion %s: %w", cached.ID, err)
+	}
+	return nil
+}
+
+// DeleteCachedConversion removes the cache entry with the ID, removing a missing entry is not an error.
+func (r *SQLRepository) DeleteCachedConversion(id string) error {
+	query := fmt.Sprintf(`DELETE FROM "%s" WHERE id = $1`, r.cacheTable)
+	if _, err := r.db.Exec(query, id); err != nil {
+		return fmt.Errorf("failed to delete cached conversion %s: %w", id, err)
+	}
+	return nil
+}
+
+// tableName validates the collection name, which is used as table name.
+func tableName(collection string) (string, error) {
+	if !identifierRegex.MatchString(collection) {
+		return "", fmt.Errorf("invalid collection name: %q", collection)
+	}
+	return collection, nil
+}
+
+// placeholders returns n comma separated placeholders, starting at $start.
+func placeholders(start, n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = fmt.Sprintf("$%d", start+i)
+	}
+	return strings.Join(list, ", ")
+}
+
+// albumWhere returns the condition matching the successfully converted tracks of the album with a measured loudness,
+// and its parameters (album and artist, if not empty) numbered from $first.
+func albumWhere(artist, album string, first int) (string, []any) {
+	where := fmt.Sprintf("album = $%d AND conversion_status = 'SUCCESS' AND replay_gain_integrated_loudness IS NOT NULL", first)
+	args := []any{album}
+	if artist != "" {
+		where += fmt.Sprintf(" AND artist = $%d", first+1)
+		args = append(args, artist)
+	}
+	return where, args
+}
+
+// nullReplayGain is a ReplayGain read from nullable columns.
+type nullReplayGain struct {
+	integratedLoudness, truePeak, trackGain, trackPeak sql.NullFloat64
+}
+
+func newNullReplayGain(gain ReplayGain) nullReplayGain {
+	return nullReplayGain{
+		integratedLoudness: sql.NullFloat64{Float64: gain.IntegratedLoudness, Valid: true},
+		truePeak:           sql.NullFloat64{Float64: gain.TruePeak, Valid: true},
+		trackGain:          sql.NullFloat64{Float64: gain.TrackGain, Valid: true},
+		trackPeak:          sql.NullFloat64{Float64: gain.TrackPeak, Valid: true},
+	}
+}
+
+// replayGain returns the ReplayGain, nil if the loudness was not measured.
+func (g nullReplayGain) replayGain() *ReplayGain {
+	if !g.integratedLoudness.Valid {
+		return nil
+	}
+	return &ReplayGain{
+		IntegratedLoudness: g.integratedLoudness.Float64,
+		TruePeak:           g.truePeak.Float64,
+		TrackGain:          g.trackGain.Float64,
+		TrackPeak:          g.trackPeak.Float64,
+	}
+}
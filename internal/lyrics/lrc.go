@@ -0,0 +1,105 @@
+package lyrics
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LRCLine represents a single timed line of a synced lyrics file.
+type LRCLine struct {
+	Time float64
+	Text string
+}
+
+var (
+	timeTagRegex = regexp.MustCompile(`^\[(\d{1,3}):(\d{2})(?:[.:](\d{1,3}))?\]`)
+	idTagRegex   = regexp.MustCompile(`^\[[a-zA-Z#]+:.*\]$`)
+)
+
+// ParseLRC parses the content of a .lrc file and returns its timed lines sorted by time.
+// ID tags (e.g. [ar:Artist]) are accepted and ignored, any other line is an error.
+func ParseLRC(data []byte) ([]LRCLine, error) {
+	var lines []LRCLine
+
+	content := strings.TrimPrefix(string(data), "\uFEFF") // Remove the UTF-8 BOM if present
+	for i, raw := range strings.Split(content, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+
+		if !timeTagRegex.MatchString(line) {
+			if idTagRegex.MatchString(line) {
+				continue
+			}
+			return nil, fmt.Errorf("invalid lrc line %d: %q", i+1, line)
+		}
+
+		// INFO: A line can have multiple time tags, e.g. [00:12.00][01:15.30]Chorus
+		var times []float64
+		for {
+			match := timeTagRegex.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			seconds, err := parseTimeTag(match[1], match[2], match[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid lrc line %d: %w", i+1, err)
+			}
+			times = append(times, seconds)
+			line = line[len(match[0]):]
+		}
+
+		for _, t := range times {
+			lines = append(lines, LRCLine{Time: t, Text: strings.TrimSpace(line)})
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil, errors.New("lrc file has no timed lines")
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time < lines[j].Time })
+	return lines, nil
+}
+
+// ValidateLRC checks if the data is a valid synced lyrics file.
+func ValidateLRC(data []byte) error {
+	_, err := ParseLRC(data)
+	return err
+}
+
+// PlainText returns the lyrics text of the timed lines without the time tags.
+func PlainText(lines []LRCLine) string {
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+	return strings.TrimSpace(strings.Join(texts, "\n"))
+}
+
+// parseTimeTag converts the minutes, seconds and fraction parts of a time tag to seconds.
+func parseTimeTag(min, sec, frac string) (float64, error) {
+	var m, s int
+	if _, err := fmt.Sscanf(min+" "+sec, "%d %d", &m, &s); err != nil {
+		return 0, fmt.Errorf("invalid time tag %s:%s: %w", min, sec, err)
+	}
+	if s >= 60 {
+		return 0, fmt.Errorf("invalid seconds in time tag: %s", sec)
+	}
+
+	seconds := float64(m*60 + s)
+	if frac != "" {
+		var f int
+		fmt.Sscanf(frac, "%d", &f)
+		div := 1.0
+		for range frac {
+			div *= 10
+		}
+		seconds += float64(f) / div
+	}
+	return seconds, nil
+}
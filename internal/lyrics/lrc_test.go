@@ -0,0 +1,95 @@
+package lyrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLRC(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []LRCLine
+	}{
+		{
+			name: "id tags and BOM",
+			data: "\uFEFF[ar:Artist]\n[ti:Title]\n[length: 03:20]\n[#:comment]\n[00:12.00]First line\n[00:17.20]Second line\n",
+			want: []LRCLine{{12, "First line"}, {17.2, "Second line"}},
+		},
+		{
+			name: "time tag formats",
+			data: "[01:02]Minutes and seconds\n[01:03.5]Tenths\n[01:04:25]Colon hundredths\n[100:00.001]Milliseconds",
+			want: []LRCLine{{62, "Minutes and seconds"}, {63.5, "Tenths"}, {64.25, "Colon hundredths"}, {6000.001, "Milliseconds"}},
+		},
+		{
+			name: "out of order lines are sorted",
+			data: "[00:30.00]Third\n[00:10.00]First\n[00:20.00]Second",
+			want: []LRCLine{{10, "First"}, {20, "Second"}, {30, "Third"}},
+		},
+		{
+			name: "multiple time tags",
+			data: "[00:12.00][01:15.30]Chorus\n[00:30.00]Verse",
+			want: []LRCLine{{12, "Chorus"}, {30, "Verse"}, {75.3, "Chorus"}},
+		},
+		{
+			name: "same time keeps the file order",
+			data: "[00:10.00]B\n[00:10.00]A",
+			want: []LRCLine{{10, "B"}, {10, "A"}},
+		},
+		{
+			name: "CRLF, blank lines and an instrumental break",
+			data: "[00:01.00] Padded \r\n\r\n   \r\n[00:05.00]\r\n",
+			want: []LRCLine{{1, "Padded"}, {5, ""}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLRC([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseLRC() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseLRC() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Text != tt.want[i].Text || got[i].Time-tt.want[i].Time > 1e-9 || tt.want[i].Time-got[i].Time > 1e-9 {
+					t.Errorf("line %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseLRCErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"id tags only", "[ar:Artist]\n[ti:Title]"},
+		{"line without time tag", "[00:01.00]Line\nNo tag"},
+		{"one digit seconds", "[00:1.00]Line"},
+		{"seconds out of range", "[00:60.00]Line"},
+		{"fraction too long", "[00:01.0000]Line"},
+		{"unclosed tag", "[00:01.00Line"},
+		{"negative time", "[-00:01.00]Line"},
+		{"time tag after the text", "Line[00:01.00]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if lines, err := ParseLRC([]byte(tt.data)); err == nil {
+				t.Errorf("ParseLRC() = %v, want an error", lines)
+			}
+			if err := ValidateLRC([]byte(tt.data)); err == nil {
+				t.Error("ValidateLRC() = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	lines := []LRCLine{{1, "First"}, {2, ""}, {3, "Second"}, {4, ""}}
+	if got, want := PlainText(lines), "First\n\nSecond"; !reflect.DeepEqual(got, want) {
+		t.Errorf("PlainText() = %q, want %q", got, want)
+	}
+}
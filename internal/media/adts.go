@@ -0,0 +1,60 @@
+package media
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+const adtsSamplesPerFrame = 1024
+
+// Sample rates by the sampling frequency index of the ADTS header.
+var adtsSampleRates = [13]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// readADTS reads the first header of an ADTS (raw AAC) stream and counts its frames, as it has no duration header.
+func readADTS(r *io.SectionReader) (*AudioInfo, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	header := make([]byte, 7)
+	info := &AudioInfo{Codec: "aac"}
+	var frames int64
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+		if header[0] != 0xFF || header[1]&0xF6 != 0xF0 {
+			break
+		}
+
+		// INFO: Sampling frequency index (4 bits), channel configuration (3 bits), frame length (13 bits).
+		size := int(header[3]&0x03)<<11 | int(header[4])<<3 | int(header[5]>>5)
+		if frames == 0 {
+			rateIndex := int(header[2] >> 2 & 0x0F)
+			if rateIndex >= len(adtsSampleRates) {
+				return nil, errors.New("adts with invalid sample rate")
+			}
+			info.SampleRate = adtsSampleRates[rateIndex]
+			info.Channels = int(header[2]&0x01)<<2 | int(header[3]>>6)
+			if info.Channels == 7 {
+				info.Channels = 8 // 7.1
+			}
+		}
+		if size < len(header) {
+			break
+		}
+
+		// INFO: Each frame holds 1 + (header[6] & 3) raw data blocks of 1024 samples.
+		frames += int64(header[6]&0x03) + 1
+		if _, err := reader.Discard(size - len(header)); err != nil {
+			break
+		}
+	}
+
+	if frames == 0 {
+		return nil, errors.New("no adts frame found")
+	}
+	info.Duration = float64(frames*adtsSamplesPerFrame) / float64(info.SampleRate)
+	return info, nil
+}
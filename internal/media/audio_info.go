@@ -0,0 +1,108 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrUnsupported is returned (wrapped) when the format of a file can't be read by ReadAudioInfo.
+var ErrUnsupported = errors.New("unsupported media format")
+
+// AudioInfo is the description of the audio of a file read from its headers.
+type AudioInfo struct {
+	Format     Format
+	Codec      string  // Named as by ffprobe, e.g. "mp3", "aac", "pcm_s16le"
+	Duration   float64 // Seconds
+	SampleRate int
+	Channels   int
+}
+
+// ReadAudioInfo reads the duration, sample rate and channels of a WAV, FLAC, MP3, ADTS (AAC), Ogg (Opus or Vorbis)
+// or MP4 file from its headers, without decoding it. The error wraps ErrUnsupported for the other formats.
+func ReadAudioInfo(filePath string) (*AudioInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filePath, err)
+	}
+
+	info, err := readAudioInfo(file, stat.Size())
+	if err != nil {
+		return nil, fmt.Errorf("error reading headers of %s: %w", filePath, err)
+	}
+	return info, nil
+}
+
+// readAudioInfo detects the format of the reader after its ID3v2 tag (if any) and reads its headers.
+func readAudioInfo(r io.ReaderAt, size int64) (*AudioInfo, error) {
+	start, err := id3v2Size(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, HeaderSize)
+	n, err := r.ReadAt(header, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var info *AudioInfo
+	format := DetectFormat(header[:n])
+	section := io.NewSectionReader(r, start, size-start)
+	switch format {
+	case FormatWAV:
+		info, err = readWAV(section)
+	case FormatFLAC:
+		info, err = readFLAC(section)
+	case FormatMP3:
+		info, err = readMP3(section)
+	case FormatAAC:
+		info, err = readADTS(section)
+	case FormatOgg:
+		info, err = readOgg(section)
+	case FormatMP4:
+		info, err = readMP4(section)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupported, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info.Format = format
+	return info, nil
+}
+
+// id3v2Size returns the size of the ID3v2 tag at the start of the reader, 0 if there is none.
+func id3v2Size(r io.ReaderAt) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return id3v2TagSize(header), nil
+}
+
+// id3v2TagSize returns the size of the ID3v2 tag from its 10 bytes header, 0 if the header is not an ID3v2 one.
+func id3v2TagSize(header []byte) int64 {
+	if len(header) < 10 || string(header[:3]) != "ID3" {
+		return 0
+	}
+
+	// INFO: The size is a syncsafe integer (7 bits per byte), without the header and the footer.
+	size := int64(header[6]&0x7F)<<21 | int64(header[7]&0x7F)<<14 | int64(header[8]&0x7F)<<7 | int64(header[9]&0x7F)
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10 // Footer
+	}
+	return size
+}
@@ -0,0 +1,248 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// wavFixture returns a WAVE file with the fmt chunk, a LIST chunk of odd size (padded) and the data chunk.
+func wavFixture(format []byte, dataSize int) []byte {
+	le32 := func(v int) []byte { return binary.LittleEndian.AppendUint32(nil, uint32(v)) }
+	chunk := func(id string, body []byte) []byte {
+		data := append([]byte(id), le32(len(body))...)
+		data = append(data, body...)
+		if len(body)%2 == 1 {
+			data = append(data, 0)
+		}
+		return data
+	}
+
+	body := bytes.Join([][]byte{[]byte("WAVE"), chunk("fmt ", format), chunk("LIST", []byte("INFOa")), chunk("data", make([]byte, dataSize))}, nil)
+	return bytes.Join([][]byte{[]byte("RIFF"), le32(len(body)), body}, nil)
+}
+
+// wavFormat returns a fmt chunk body, with the extensible part if subFormat isn't 0.
+func wavFormat(tag uint16, channels, sampleRate, bitsPerSample int, subFormat uint16) []byte {
+	blockAlign := channels * bitsPerSample / 8
+	format := binary.LittleEndian.AppendUint16(nil, tag)
+	format = binary.LittleEndian.AppendUint16(format, uint16(channels))
+	format = binary.LittleEndian.AppendUint32(format, uint32(sampleRate))
+	format = binary.LittleEndian.AppendUint32(format, uint32(sampleRate*blockAlign))
+	format = binary.LittleEndian.AppendUint16(format, uint16(blockAlign))
+	format = binary.LittleEndian.AppendUint16(format, uint16(bitsPerSample))
+	if subFormat != 0 {
+		format = binary.LittleEndian.AppendUint16(format, 22)                               // Extension size
+		format = append(format, 0, 0, 0, 0, 0, 0)                                           // Valid bits and channel mask
+		format = binary.LittleEndian.AppendUint16(format, subFormat)                        // First bytes of the GUID
+		format = append(format, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xAA, 0, 0x38, 0x9B, 0x71) // Rest of the GUID
+	}
+	return format
+}
+
+// flacFixture returns a native FLAC file with only the STREAMINFO block.
+func flacFixture(sampleRate, channels, bitsPerSample int, totalSamples uint64) []byte {
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint16(streamInfo[0:2], 4096) // Min and max block size
+	binary.BigEndian.PutUint16(streamInfo[2:4], 4096)
+	bits := uint64(sampleRate)<<44 | uint64(channels-1)<<41 | uint64(bitsPerSample-1)<<36 | totalSamples
+	binary.BigEndian.PutUint64(streamInfo[10:18], bits)
+	return bytes.Join([][]byte{[]byte("fLaC"), {0x80, 0, 0, 34}, streamInfo}, nil)
+}
+
+// mp3Frames returns count MPEG 1 layer III frames of 128 kbps at 44.1 kHz (417 bytes), stereo or mono. The
+// first frame holds the header (e.g. Xing or VBRI) at the offset, if not nil.
+func mp3Frames(count int, mono bool, header []byte, offset int) []byte {
+	frameHeader := []byte{0xFF, 0xFB, 0x90, 0x00}
+	if mono {
+		frameHeader[3] = 0xC0
+	}
+
+	var data []byte
+	for i := range count {
+		frame := make([]byte, 417)
+		copy(frame, frameHeader)
+		if i == 0 && header != nil {
+			copy(frame[offset:], header)
+		}
+		data = append(data, frame...)
+	}
+	return data
+}
+
+// xingHeader returns a Xing or Info header with the frame count.
+func xingHeader(id string, frames uint32) []byte {
+	return bytes.Join([][]byte{[]byte(id), {0, 0, 0, 0x01}, binary.BigEndian.AppendUint32(nil, frames)}, nil)
+}
+
+// vbriHeader returns a VBRI header with the frame count.
+func vbriHeader(frames uint32) []byte {
+	header := append([]byte("VBRI"), make([]byte, 14)...)
+	binary.BigEndian.PutUint32(header[14:18], frames)
+	return header
+}
+
+// id3v2Tag returns an ID3v2.4 tag with a body of the size.
+func id3v2Tag(size int) []byte {
+	header := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	return append(header, make([]byte, size)...)
+}
+
+// adtsFrames returns count ADTS frames of AAC LC at 44.1 kHz stereo, each with one raw data block.
+func adtsFrames(count int) []byte {
+	const size = 27
+	frame := make([]byte, size)
+	copy(frame, []byte{0xFF, 0xF1, 0x50, 0x80 | size>>11&0x03, size >> 3 & 0xFF, size&0x07<<5 | 0x1F, 0xFC})
+	return bytes.Repeat(frame, count)
+}
+
+// oggPage returns an Ogg page of the logical stream with a single packet.
+func oggPage(serial uint32, granule int64, packet []byte) []byte {
+	header := make([]byte, oggPageHeaderSize)
+	copy(header, oggCapture)
+	binary.LittleEndian.PutUint64(header[6:14], uint64(granule))
+	binary.LittleEndian.PutUint32(header[14:18], serial)
+	header[26] = 1
+	return bytes.Join([][]byte{header, {byte(len(packet))}, packet}, nil)
+}
+
+// opusHead returns the identification header of an Opus stream.
+func opusHead(channels int, preSkip uint16) []byte {
+	head := append([]byte("OpusHead"), 1, byte(channels))
+	head = binary.LittleEndian.AppendUint16(head, preSkip)
+	head = binary.LittleEndian.AppendUint32(head, 44100) // Input sample rate, not the decoding one
+	return append(head, 0, 0, 0)
+}
+
+// vorbisHeader returns the identification header of a Vorbis stream.
+func vorbisHeader(channels, sampleRate int) []byte {
+	header := append([]byte("\x01vorbis"), 0, 0, 0, 0, byte(channels))
+	header = binary.LittleEndian.AppendUint32(header, uint32(sampleRate))
+	return append(header, make([]byte, 14)...)
+}
+
+// mp4MoovAtEnd returns the mp4 fixture with the moov box moved after the media data.
+func mp4MoovAtEnd(t *testing.T) []byte {
+	t.Helper()
+	data := mp4Fixture(t, nil)
+	boxes, err := parseRawBoxes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := map[string][]byte{}
+	for _, box := range boxes {
+		parts[box.kind] = data[box.start:box.end]
+	}
+	return bytes.Join([][]byte{parts["ftyp"], parts["mdat"], parts["moov"]}, nil)
+}
+
+func TestReadAudioInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want AudioInfo
+	}{
+		{
+			name: "wav pcm",
+			data: wavFixture(wavFormat(wavFormatPCM, 2, 44100, 16, 0), 44100*4),
+			want: AudioInfo{Format: FormatWAV, Codec: "pcm_s16le", Duration: 1, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "wav extensible float",
+			data: wavFixture(wavFormat(wavFormatExtensible, 1, 48000, 32, wavFormatFloat), 48000*4/2),
+			want: AudioInfo{Format: FormatWAV, Codec: "pcm_f32le", Duration: 0.5, SampleRate: 48000, Channels: 1},
+		},
+		{
+			name: "flac",
+			data: flacFixture(48000, 2, 16, 96000),
+			want: AudioInfo{Format: FormatFLAC, Codec: "flac", Duration: 2, SampleRate: 48000, Channels: 2},
+		},
+		{
+			name: "mp3 xing",
+			data: mp3Frames(3, false, xingHeader("Xing", 100), 4+32),
+			want: AudioInfo{Format: FormatMP3, Codec: "mp3", Duration: 100 * 1152 / 44100.0, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "mp3 info mono",
+			data: mp3Frames(3, true, xingHeader("Info", 50), 4+17),
+			want: AudioInfo{Format: FormatMP3, Codec: "mp3", Duration: 50 * 1152 / 44100.0, SampleRate: 44100, Channels: 1},
+		},
+		{
+			name: "mp3 vbri",
+			data: mp3Frames(3, false, vbriHeader(200), 4+32),
+			want: AudioInfo{Format: FormatMP3, Codec: "mp3", Duration: 200 * 1152 / 44100.0, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "mp3 frame scan after id3v2 and before id3v1",
+			data: bytes.Join([][]byte{id3v2Tag(100), mp3Frames(10, false, nil, 0), append([]byte("TAG"), make([]byte, 125)...)}, nil),
+			want: AudioInfo{Format: FormatMP3, Codec: "mp3", Duration: 10 * 1152 / 44100.0, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "adts",
+			data: adtsFrames(3),
+			want: AudioInfo{Format: FormatAAC, Codec: "aac", Duration: 3 * 1024 / 44100.0, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "ogg opus",
+			data: bytes.Join([][]byte{oggPage(1, 0, opusHead(2, 312)), oggPage(1, 48000*2+312, []byte("audio")), oggPage(2, 48000*10, []byte("other stream"))}, nil),
+			want: AudioInfo{Format: FormatOgg, Codec: "opus", Duration: 2, SampleRate: 48000, Channels: 2},
+		},
+		{
+			name: "ogg vorbis",
+			data: bytes.Join([][]byte{oggPage(7, 0, vorbisHeader(1, 44100)), oggPage(7, 44100*3, []byte("audio")), oggPage(7, -1, []byte("continued"))}, nil),
+			want: AudioInfo{Format: FormatOgg, Codec: "vorbis", Duration: 3, SampleRate: 44100, Channels: 1},
+		},
+		{
+			name: "mp4 faststart",
+			data: mp4Fixture(t, nil),
+			want: AudioInfo{Format: FormatMP4, Codec: "aac", Duration: 4, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "mp4 moov at the end",
+			data: mp4MoovAtEnd(t),
+			want: AudioInfo{Format: FormatMP4, Codec: "aac", Duration: 4, SampleRate: 44100, Channels: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAudioInfo(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("readAudioInfo() error = %v", err)
+			}
+			if got.Format != tt.want.Format || got.Codec != tt.want.Codec || got.SampleRate != tt.want.SampleRate ||
+				got.Channels != tt.want.Channels || math.Abs(got.Duration-tt.want.Duration) > 1e-9 {
+				t.Errorf("readAudioInfo() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadAudioInfoErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		unsupported bool
+	}{
+		{"aiff", append([]byte("FORM\x00\x00\x00\x04AIFF"), make([]byte, 16)...), true},
+		{"unknown", []byte("not an audio file"), true},
+		{"wav without data chunk", wavFixture(wavFormat(wavFormatPCM, 2, 44100, 16, 0), 0)[:12+8+16+8+6], false},
+		{"flac without streaminfo", append([]byte("fLaC\x84\x00\x00\x22"), make([]byte, 34)...), false},
+		{"mp3 sync word without a next frame", append([]byte{0xFF, 0xFB, 0x90, 0x00}, bytes.Repeat([]byte("x"), 500)...), false},
+		{"ogg neither opus nor vorbis", oggPage(1, 0, []byte("\x7fFLAC\x01\x00\x00\x01fLaC\x00\x00\x00\x22")), false},
+		{"mp4 without moov", append([]byte("\x00\x00\x00\x0cftypM4A "), []byte("\x00\x00\x00\x08free")...), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readAudioInfo(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err == nil {
+				t.Fatal("readAudioInfo() error = nil, want an error")
+			}
+			if errors.Is(err, ErrUnsupported) != tt.unsupported {
+				t.Errorf("readAudioInfo() error = %v, unsupported %v", err, tt.unsupported)
+			}
+		})
+	}
+}
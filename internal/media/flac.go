@@ -0,0 +1,38 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const flacStreamInfo = 0 // Type of the STREAMINFO metadata block, always the first one
+
+// readFLAC reads the STREAMINFO block of a native FLAC file.
+func readFLAC(r *io.SectionReader) (*AudioInfo, error) {
+	// "fLaC", the block header (last flag, type and 24 bits length) and the 34 bytes of STREAMINFO.
+	block := make([]byte, 4+4+34)
+	if _, err := r.ReadAt(block, 0); err != nil {
+		return nil, err
+	}
+	if block[4]&0x7F != flacStreamInfo {
+		return nil, errors.New("flac without STREAMINFO")
+	}
+
+	// INFO: After the block and frame sizes: sample rate (20 bits), channels - 1 (3 bits),
+	// bits per sample - 1 (5 bits) and total samples (36 bits).
+	bits := binary.BigEndian.Uint64(block[18:26])
+	sampleRate := int(bits >> 44)
+	channels := int(bits>>41&0x07) + 1
+	totalSamples := bits & 0xFFFFFFFFF
+
+	if sampleRate == 0 {
+		return nil, errors.New("flac with invalid sample rate")
+	}
+	return &AudioInfo{
+		Codec:      "flac",
+		Duration:   float64(totalSamples) / float64(sampleRate),
+		SampleRate: sampleRate,
+		Channels:   channels,
+	}, nil
+}
@@ -0,0 +1,147 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// HeaderSize is the number of bytes read from the start of a file to detect its format.
+const HeaderSize = 64
+
+// Format is the format of a file, detected from its magic bytes.
+type Format string
+
+const (
+	FormatUnknown Format = ""
+	FormatMP3     Format = "mp3"
+	FormatAAC     Format = "aac" // ADTS
+	FormatMP4     Format = "mp4" // Also m4a, m4b and mov
+	FormatFLAC    Format = "flac"
+	FormatWAV     Format = "wav"
+	FormatAIFF    Format = "aiff"
+	FormatOgg     Format = "ogg"  // Vorbis, Opus or FLAC in Ogg
+	FormatWebM    Format = "webm" // Also mkv (Matroska)
+	FormatJPEG    Format = "jpeg"
+	FormatPNG     Format = "png"
+	FormatGIF     Format = "gif"
+	FormatWebP    Format = "webp"
+)
+
+// IsImage reports whether the format is an image format.
+func (f Format) IsImage() bool {
+	switch f {
+	case FormatJPEG, FormatPNG, FormatGIF, FormatWebP:
+		return true
+	}
+	return false
+}
+
+// DetectFormat returns the format of a file from its first bytes (see HeaderSize), FormatUnknown if none matches.
+// INFO: MP3 files without an ID3 tag and ADTS files are only recognized by their frame sync, which is checked last.
+func DetectFormat(header []byte) Format {
+	switch {
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return FormatMP3
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return FormatFLAC
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return FormatOgg
+	case isRIFF(header, "WAVE"):
+		return FormatWAV
+	case isRIFF(header, "WEBP"):
+		return FormatWebP
+	case len(header) >= 12 && bytes.Equal(header[:4], []byte("FORM")) &&
+		(bytes.Equal(header[8:12], []byte("AIFF")) || bytes.Equal(header[8:12], []byte("AIFC"))):
+		return FormatAIFF
+	case len(header) >= 8 && bytes.Equal(header[4:8], []byte("ftyp")):
+		return FormatMP4
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return FormatWebM
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return FormatGIF
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xF6 == 0xF0:
+		return FormatAAC // Sync word 0xFFF and layer 0
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 && header[1]&0x06 != 0:
+		return FormatMP3 // Frame sync 0xFFE and a layer set
+	}
+	return FormatUnknown
+}
+
+// DetectFileFormat reads the first bytes of the file and returns its format, see DetectReaderFormat.
+func DetectFileFormat(filePath string) (Format, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return FormatUnknown, fmt.Errorf("error opening %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	return DetectReaderFormat(file)
+}
+
+// DetectReaderFormat reads the first bytes of the reader and returns its format, detected after the ID3v2 tag
+// if there is one, like ReadAudioInfo.
+// INFO: The ID3v2 tag is also written in front of ADTS and FLAC files. A tag followed by an unknown format is an
+// mp3, its first frame may be after some padding.
+func DetectReaderFormat(r io.Reader) (Format, error) {
+	header := make([]byte, HeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FormatUnknown, fmt.Errorf("error reading header: %w", err)
+	}
+
+	tagSize := id3v2TagSize(header[:n])
+	if tagSize == 0 {
+		return DetectFormat(header[:n]), nil
+	}
+
+	rest := io.MultiReader(bytes.NewReader(header[:n]), r)
+	if _, err := io.CopyN(io.Discard, rest, tagSize); err != nil && err != io.EOF {
+		return FormatUnknown, fmt.Errorf("error reading ID3v2 tag: %w", err)
+	}
+	n, err = io.ReadFull(rest, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FormatUnknown, fmt.Errorf("error reading header: %w", err)
+	}
+	if format := DetectFormat(header[:n]); format != FormatUnknown {
+		return format, nil
+	}
+	return FormatMP3, nil
+}
+
+// isRIFF reports whether the header is a RIFF container of the form type, e.g. WAVE.
+func isRIFF(header []byte, formType string) bool {
+	return len(header) >= 12 && bytes.Equal(header[:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte(formType))
+}
+
+// webpSize returns the dimensions of a WebP image from its header, for the lossy (VP8), lossless (VP8L) and
+// extended (VP8X) formats.
+func webpSize(header []byte) (int, int, error) {
+	if len(header) < 30 {
+		return 0, 0, fmt.Errorf("webp header too short")
+	}
+
+	switch string(header[12:16]) {
+	case "VP8 ":
+		// Frame header after the 3 bytes frame tag and the 3 bytes start code, 14 bits each.
+		width := int(binary.LittleEndian.Uint16(header[26:28]) & 0x3FFF)
+		height := int(binary.LittleEndian.Uint16(header[28:30]) & 0x3FFF)
+		return width, height, nil
+	case "VP8L":
+		// Signature byte 0x2F followed by the width - 1 and height - 1 in 14 bits each.
+		bits := binary.LittleEndian.Uint32(header[21:25])
+		return int(bits&0x3FFF) + 1, int(bits>>14&0x3FFF) + 1, nil
+	case "VP8X":
+		// Canvas width - 1 and height - 1 in 24 bits each.
+		width := int(header[24]) | int(header[25])<<8 | int(header[26])<<16
+		height := int(header[27]) | int(header[28])<<8 | int(header[29])<<16
+		return width + 1, height + 1, nil
+	}
+	return 0, 0, fmt.Errorf("unknown webp chunk %q", header[12:16])
+}
@@ -0,0 +1,68 @@
+package media
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   Format
+	}{
+		{"mp3 with id3v2", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), FormatMP3},
+		{"mp3 frame sync", []byte{0xFF, 0xFB, 0x90, 0x00}, FormatMP3},
+		{"mp2 frame sync", []byte{0xFF, 0xFD, 0x90, 0x00}, FormatMP3},
+		{"adts", []byte{0xFF, 0xF1, 0x50, 0x80}, FormatAAC},
+		{"mp4", []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00"), FormatMP4},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), FormatFLAC},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), FormatWAV},
+		{"aiff", []byte("FORM\x00\x00\x00\x04AIFF"), FormatAIFF},
+		{"aifc", []byte("FORM\x00\x00\x00\x04AIFC"), FormatAIFF},
+		{"ogg", []byte("OggS\x00\x02"), FormatOgg},
+		{"webm", []byte{0x1A, 0x45, 0xDF, 0xA3, 0x01}, FormatWebM},
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0}, FormatJPEG},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), FormatPNG},
+		{"gif87a", []byte("GIF87a\x01\x00"), FormatGIF},
+		{"gif89a", []byte("GIF89a\x01\x00"), FormatGIF},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), FormatWebP},
+		{"riff of another type", []byte("RIFF\x24\x00\x00\x00AVI LIST"), FormatUnknown},
+		{"truncated riff", []byte("RIFF\x24\x00"), FormatUnknown},
+		{"sync word without layer", []byte{0xFF, 0xE0, 0x00, 0x00}, FormatUnknown},
+		{"text", []byte("hello world"), FormatUnknown},
+		{"empty", nil, FormatUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.header); got != tt.want {
+				t.Errorf("DetectFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectReaderFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Format
+	}{
+		// The header is shorter than HeaderSize, which is not an error.
+		{"short flac", []byte("fLaC"), FormatFLAC},
+		{"empty", nil, FormatUnknown},
+		{"mp3 after id3v2", append(id3v2Tag(100), mp3Frames(2, false, nil, 0)...), FormatMP3},
+		{"adts after id3v2", append(id3v2Tag(100), adtsFrames(2)...), FormatAAC},
+		{"flac after a tag larger than the header", append(id3v2Tag(4096), flacFixture(44100, 2, 16, 44100)...), FormatFLAC},
+		{"padding after id3v2", append(id3v2Tag(100), make([]byte, 32)...), FormatMP3},
+		{"truncated id3v2", id3v2Tag(100)[:50], FormatMP3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectReaderFormat(bytes.NewReader(tt.data))
+			if err != nil || got != tt.want {
+				t.Errorf("DetectReaderFormat() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"  // Registers the GIF decoder
+	_ "image/jpeg" // Registers the JPEG decoder
+	_ "image/png"  // Registers the PNG decoder
+	"io"
+	"os"
+)
+
+// ImageInfo is the format and the dimensions of an image.
+type ImageInfo struct {
+	Format Format
+	Width  int
+	Height int
+}
+
+// ReadImageInfo reads the format and the dimensions of the image file, the error is returned if it's not an image
+// or its header can't be decoded.
+func ReadImageInfo(filePath string) (ImageInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("error opening %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	header := make([]byte, HeaderSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ImageInfo{}, fmt.Errorf("error reading %s: %w", filePath, err)
+	}
+	header = header[:n]
+
+	info := ImageInfo{Format: DetectFormat(header)}
+	if !info.Format.IsImage() {
+		return info, fmt.Errorf("%s is not an image", filePath)
+	}
+
+	// INFO: WebP has no decoder in the standard library, its dimensions are in the header.
+	if info.Format == FormatWebP {
+		info.Width, info.Height, err = webpSize(header)
+		return info, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return info, fmt.Errorf("error reading %s: %w", filePath, err)
+	}
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return info, fmt.Errorf("error decoding image %s: %w", filePath, err)
+	}
+	info.Width, info.Height = config.Width, config.Height
+	return info, nil
+}
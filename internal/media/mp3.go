@@ -0,0 +1,194 @@
+package media
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const mp3SyncScanLimit = 64 * 1024 // Bytes searched for the first frame after the tags
+
+var (
+	// Bitrates in kbps by [MPEG 1 or not][layer - 1][index].
+	mp3Bitrates = [2][3][16]int{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	// Sample rates of MPEG 1, the ones of MPEG 2 are halved and of MPEG 2.5 quartered.
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// mp3Frame is a parsed MPEG audio frame header.
+type mp3Frame struct {
+	mpeg1      bool
+	layer      int
+	sampleRate int
+	channels   int
+	size       int // Bytes of the whole frame
+	samples    int // Samples per channel in the frame
+}
+
+// parseMP3Frame parses the 4 bytes frame header, returning false if they are not a valid one.
+func parseMP3Frame(header []byte) (mp3Frame, bool) {
+	if len(header) < 4 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+
+	version := header[1] >> 3 & 0x03 // 0: MPEG 2.5, 2: MPEG 2, 3: MPEG 1
+	layer := 4 - int(header[1]>>1&0x03)
+	bitrateIndex := header[2] >> 4
+	rateIndex := header[2] >> 2 & 0x03
+	if version == 1 || layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return mp3Frame{}, false
+	}
+
+	frame := mp3Frame{mpeg1: version == 3, layer: layer, channels: 2}
+	frame.sampleRate = mp3SampleRates[rateIndex]
+	switch version {
+	case 2:
+		frame.sampleRate /= 2
+	case 0:
+		frame.sampleRate /= 4
+	}
+	if header[3]>>6 == 3 {
+		frame.channels = 1
+	}
+
+	table := 0
+	if !frame.mpeg1 {
+		table = 1
+	}
+	bitrate := mp3Bitrates[table][layer-1][bitrateIndex] * 1000
+	padding := int(header[2] >> 1 & 0x01)
+
+	switch {
+	case layer == 1:
+		frame.samples = 384
+		frame.size = (12*bitrate/frame.sampleRate + padding) * 4
+	case layer == 3 && !frame.mpeg1:
+		frame.samples = 576
+		frame.size = 72*bitrate/frame.sampleRate + padding
+	default:
+		frame.samples = 1152
+		frame.size = 144*bitrate/frame.sampleRate + padding
+	}
+	return frame, true
+}
+
+// readMP3 reads the first frame of a MPEG audio stream and its Xing, Info or VBRI header,
+// counting the frames of the stream if it has none.
+func readMP3(r *io.SectionReader) (*AudioInfo, error) {
+	buffer := make([]byte, mp3SyncScanLimit)
+	n, err := r.ReadAt(buffer, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	buffer = buffer[:n]
+
+	// INFO: A single sync word may be part of the data, so the frame after the first one must be valid too.
+	offset := -1
+	var frame mp3Frame
+	for i := 0; i+4 <= len(buffer); i++ {
+		candidate, ok := parseMP3Frame(buffer[i:])
+		if !ok {
+			continue
+		}
+		next := i + candidate.size
+		if next+4 <= len(buffer) {
+			if following, ok := parseMP3Frame(buffer[next:]); !ok || following.sampleRate != candidate.sampleRate {
+				continue
+			}
+		}
+		offset, frame = i, candidate
+		break
+	}
+	if offset < 0 {
+		return nil, errors.New("no mpeg audio frame found")
+	}
+
+	info := &AudioInfo{Codec: mp3Codec(frame.layer), SampleRate: frame.sampleRate, Channels: frame.channels}
+
+	frames, ok := mp3HeaderFrames(buffer[offset:], frame)
+	if !ok {
+		frames, err = countMP3Frames(io.NewSectionReader(r, int64(offset), r.Size()-int64(offset)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	info.Duration = float64(frames) * float64(frame.samples) / float64(frame.sampleRate)
+	return info, nil
+}
+
+// mp3HeaderFrames returns the frame count of the Xing, Info or VBRI header in the first frame.
+func mp3HeaderFrames(data []byte, frame mp3Frame) (int64, bool) {
+	// INFO: The Xing (VBR) or Info (CBR) header comes after the side information, which size depends
+	// on the version and the channels.
+	sideInfo := 32
+	switch {
+	case frame.mpeg1 && frame.channels == 1:
+		sideInfo = 17
+	case !frame.mpeg1 && frame.channels == 2:
+		sideInfo = 17
+	case !frame.mpeg1:
+		sideInfo = 9
+	}
+
+	xing := 4 + sideInfo
+	if len(data) >= xing+12 {
+		id := string(data[xing : xing+4])
+		flags := binary.BigEndian.Uint32(data[xing+4 : xing+8])
+		if (id == "Xing" || id == "Info") && flags&0x01 != 0 {
+			return int64(binary.BigEndian.Uint32(data[xing+8 : xing+12])), true
+		}
+	}
+
+	// INFO: The VBRI header (Fraunhofer encoder) is always 32 bytes after the frame header.
+	const vbri = 4 + 32
+	if len(data) >= vbri+18 && string(data[vbri:vbri+4]) == "VBRI" {
+		return int64(binary.BigEndian.Uint32(data[vbri+14 : vbri+18])), true
+	}
+	return 0, false
+}
+
+// countMP3Frames counts the frames of the stream until the end or the first invalid header (e.g. an ID3v1 tag).
+func countMP3Frames(r io.Reader) (int64, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	header := make([]byte, 4)
+	var frames int64
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return frames, nil
+			}
+			return 0, err
+		}
+		frame, ok := parseMP3Frame(header)
+		if !ok {
+			return frames, nil
+		}
+		frames++
+		if _, err := reader.Discard(frame.size - 4); err != nil {
+			return frames, nil // Truncated last frame
+		}
+	}
+}
+
+// mp3Codec returns the ffprobe name of the codec of the layer.
+func mp3Codec(layer int) string {
+	switch layer {
+	case 1:
+		return "mp1"
+	case 2:
+		return "mp2"
+	}
+	return "mp3"
+}
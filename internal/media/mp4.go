@@ -0,0 +1,201 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Codecs of the sample entries of MP4 audio tracks, named as by ffprobe.
+var mp4Codecs = map[string]string{
+	"mp4a": "aac",
+	"alac": "alac",
+	"fLaC": "flac",
+	"Opus": "opus",
+	".mp3": "mp3",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+}
+
+// mp4Box is the position of a box (atom) of an ISO BMFF file.
+type mp4Box struct {
+	kind   string
+	start  int64 // Start of the box header
+	offset int64 // Start of the box content, after the header
+	size   int64 // Size of the content
+}
+
+// mp4Track is what is read of a trak box.
+type mp4Track struct {
+	audio      bool
+	timescale  uint32
+	duration   uint64
+	codec      string
+	sampleRate int
+	channels   int
+}
+
+// readMP4 reads the mvhd box and the first audio track (mdhd and stsd boxes) of the moov box, which
+// may be at the start or at the end of the file.
+func readMP4(r *io.SectionReader) (*AudioInfo, error) {
+	moov, err := findMP4Box(r, 0, r.Size(), "moov")
+	if err != nil {
+		return nil, err
+	}
+
+	boxes, err := mp4Children(r, moov.offset, moov.size)
+	if err != nil {
+		return nil, err
+	}
+
+	var movieTimescale uint32
+	var movieDuration uint64
+	for _, box := range boxes {
+		switch box.kind {
+		case "mvhd":
+			if movieTimescale, movieDuration, err = readMP4Header(r, box); err != nil {
+				return nil, err
+			}
+		case "trak":
+			track, err := readMP4Track(r, box)
+			if err != nil {
+				return nil, err
+			}
+			if !track.audio {
+				continue
+			}
+
+			info := &AudioInfo{Codec: track.codec, SampleRate: track.sampleRate, Channels: track.channels}
+			switch {
+			case track.timescale != 0:
+				info.Duration = float64(track.duration) / float64(track.timescale)
+			case movieTimescale != 0:
+				info.Duration = float64(movieDuration) / float64(movieTimescale)
+			}
+			return info, nil
+		}
+	}
+	return nil, errors.New("mp4 without audio track")
+}
+
+// readMP4Track reads the handler, the media header and the first sample entry of a trak box.
+func readMP4Track(r *io.SectionReader, trak mp4Box) (mp4Track, error) {
+	var track mp4Track
+
+	mdia, err := findMP4Box(r, trak.offset, trak.size, "mdia")
+	if err != nil {
+		return track, err
+	}
+	boxes, err := mp4Children(r, mdia.offset, mdia.size)
+	if err != nil {
+		return track, err
+	}
+
+	var minf *mp4Box
+	for _, box := range boxes {
+		switch box.kind {
+		case "hdlr":
+			// INFO: Version and flags (4 bytes), pre defined (4 bytes) and the handler type.
+			handler := make([]byte, 4)
+			if _, err := r.ReadAt(handler, box.offset+8); err != nil {
+				return track, err
+			}
+			track.audio = string(handler) == "soun"
+		case "mdhd":
+			if track.timescale, track.duration, err = readMP4Header(r, box); err != nil {
+				return track, err
+			}
+		case "minf":
+			minf = &box
+		}
+	}
+	if !track.audio || minf == nil {
+		return track, nil
+	}
+
+	stbl, err := findMP4Box(r, minf.offset, minf.size, "stbl")
+	if err != nil {
+		return track, err
+	}
+	stsd, err := findMP4Box(r, stbl.offset, stbl.size, "stsd")
+	if err != nil {
+		return track, err
+	}
+
+	// INFO: Version and flags (4 bytes), entry count (4 bytes) and the first entry: size (4 bytes), format (4 bytes),
+	// reserved (6 bytes), data reference index (2 bytes), version (2 bytes), revision (2 bytes), vendor (4 bytes),
+	// channels (2 bytes), sample size (2 bytes), compression id (2 bytes), packet size (2 bytes) and the
+	// sample rate (16.16 fixed point).
+	entry := make([]byte, 8+36)
+	if _, err := r.ReadAt(entry, stsd.offset); err != nil {
+		return track, err
+	}
+	format := string(entry[12:16])
+	track.codec = mp4Codecs[format]
+	if track.codec == "" {
+		track.codec = format
+	}
+	track.channels = int(binary.BigEndian.Uint16(entry[32:34]))
+	track.sampleRate = int(binary.BigEndian.Uint32(entry[40:44]) >> 16)
+	return track, nil
+}
+
+// readMP4Header reads the timescale and the duration of a mvhd or mdhd box.
+func readMP4Header(r *io.SectionReader, box mp4Box) (uint32, uint64, error) {
+	header := make([]byte, 32)
+	if _, err := r.ReadAt(header[:min(box.size, 32)], box.offset); err != nil {
+		return 0, 0, err
+	}
+
+	// INFO: Version 1 has 64 bits creation, modification and duration fields, version 0 has 32 bits ones.
+	if header[0] == 1 {
+		return binary.BigEndian.Uint32(header[20:24]), binary.BigEndian.Uint64(header[24:32]), nil
+	}
+	return binary.BigEndian.Uint32(header[12:16]), uint64(binary.BigEndian.Uint32(header[16:20])), nil
+}
+
+// findMP4Box returns the first box of the kind in the range.
+func findMP4Box(r *io.SectionReader, offset, size int64, kind string) (mp4Box, error) {
+	boxes, err := mp4Children(r, offset, size)
+	if err != nil {
+		return mp4Box{}, err
+	}
+	for _, box := range boxes {
+		if box.kind == kind {
+			return box, nil
+		}
+	}
+	return mp4Box{}, errors.New("mp4 without " + kind + " box")
+}
+
+// mp4Children lists the boxes in the range.
+func mp4Children(r *io.SectionReader, offset, size int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	end := offset + size
+	header := make([]byte, 16)
+	for offset+8 <= end {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch boxSize {
+		case 0: // Up to the end
+			boxSize = end - offset
+		case 1: // 64 bits size after the type
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if boxSize < headerSize {
+			return nil, errors.New("invalid mp4 box size")
+		}
+		boxSize = min(boxSize, end-offset) // Truncated file
+
+		boxes = append(boxes, mp4Box{kind: string(header[4:8]), start: offset, offset: offset + headerSize, size: boxSize - headerSize})
+		offset += boxSize
+	}
+	return boxes, nil
+}
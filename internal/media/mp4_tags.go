@@ -0,0 +1,346 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// iTunesMean is the mean (namespace) of the iTunes freeform atoms, e.g. iTunNORM.
+const iTunesMean = "com.apple.iTunes"
+
+// ilstPath is the path of the iTunes metadata list from the moov box.
+var ilstPath = []string{"udta", "meta", "ilst"}
+
+// rawBox is the position of a box in a byte slice.
+type rawBox struct {
+	kind  string
+	start int // Start of the box header
+	body  int // Start of the box content
+	end   int
+}
+
+// ReadMP4FreeformTags returns the iTunes freeform tags (---- atoms with the com.apple.iTunes mean) of a MP4 file.
+func ReadMP4FreeformTags(filePath string) (map[string]string, error) {
+	file, _, content, err := readMoov(filePath)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	tags := make(map[string]string)
+	ilst, ok, err := findBoxPath(content, ilstPath)
+	if err != nil || !ok {
+		return tags, err
+	}
+	boxes, err := parseRawBoxes(ilst)
+	if err != nil {
+		return nil, err
+	}
+	for _, box := range boxes {
+		if box.kind != "----" {
+			continue
+		}
+		if mean, name, value, ok := parseFreeform(ilst[box.body:box.end]); ok && mean == iTunesMean {
+			tags[name] = value
+		}
+	}
+	return tags, nil
+}
+
+// WriteMP4FreeformTags sets iTunes freeform tags on a MP4 file in place, replacing the ones with the same names.
+// INFO: The mp4 muxer of FFmpeg only writes the standard atoms, the freeform ones (e.g. iTunNORM) would need
+// use_metadata_tags, which writes all the tags as mdta keys instead of the ilst atoms read by the players.
+// The chunk offsets are shifted when the moov box is before the media data (faststart).
+func WriteMP4FreeformTags(filePath string, tags map[string]string) error {
+	file, moov, content, err := readMoov(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	edited, err := editBoxPath(content, ilstPath, func(ilst []byte) ([]byte, error) {
+		return setFreeformTags(ilst, tags)
+	})
+	if err != nil {
+		return fmt.Errorf("error editing tags of %s: %w", filePath, err)
+	}
+
+	moovEnd := moov.offset + moov.size
+	if delta := int64(len(edited) - len(content)); delta != 0 {
+		if err := shiftChunkOffsets(edited, moovEnd, delta); err != nil {
+			return fmt.Errorf("error editing tags of %s: %w", filePath, err)
+		}
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	tempPath := filePath + ".tags"
+	temp, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", tempPath, err)
+	}
+	defer os.Remove(tempPath) // No-op once renamed
+
+	_, err = io.Copy(temp, io.NewSectionReader(file, 0, moov.start))
+	if err == nil {
+		_, err = temp.Write(makeBox("moov", edited))
+	}
+	if err == nil {
+		_, err = io.Copy(temp, io.NewSectionReader(file, moovEnd, stat.Size()-moovEnd))
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", tempPath, err)
+	}
+
+	if err := os.Rename(tempPath, filePath); err != nil {
+		return fmt.Errorf("error replacing %s with the retagged file: %w", filePath, err)
+	}
+	return nil
+}
+
+// readMoov opens the MP4 file and reads the content of its moov box.
+func readMoov(filePath string) (*os.File, mp4Box, []byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, mp4Box{}, nil, fmt.Errorf("error opening %s: %w", filePath, err)
+	}
+	stat, err := file.Stat()
+	if err == nil {
+		var moov mp4Box
+		moov, err = findMP4Box(io.NewSectionReader(file, 0, stat.Size()), 0, stat.Size(), "moov")
+		if err == nil {
+			content := make([]byte, moov.size)
+			if _, err = file.ReadAt(content, moov.offset); err == nil {
+				return file, moov, content, nil
+			}
+		}
+	}
+	file.Close()
+	return nil, mp4Box{}, nil, fmt.Errorf("error reading %s: %w", filePath, err)
+}
+
+// setFreeformTags returns the ilst content with the freeform atoms of the tags, replacing the ones with the same names.
+func setFreeformTags(ilst []byte, tags map[string]string) ([]byte, error) {
+	boxes, err := parseRawBoxes(ilst)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []byte
+	for _, box := range boxes {
+		if box.kind == "----" {
+			if mean, name, _, ok := parseFreeform(ilst[box.body:box.end]); ok && mean == iTunesMean {
+				if _, replaced := tags[name]; replaced {
+					continue
+				}
+			}
+		}
+		result = append(result, ilst[box.start:box.end]...)
+	}
+
+	for name, value := range tags {
+		// INFO: mean and name are full boxes (version and flags), data has the type (1 is UTF-8) and the locale.
+		result = append(result, makeBox("----",
+			makeBox("mean", []byte{0, 0, 0, 0}, []byte(iTunesMean)),
+			makeBox("name", []byte{0, 0, 0, 0}, []byte(name)),
+			makeBox("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte(value)),
+		)...)
+	}
+	return result, nil
+}
+
+// parseFreeform returns the mean, name and value of the content of a ---- atom.
+func parseFreeform(content []byte) (mean, name, value string, ok bool) {
+	boxes, err := parseRawBoxes(content)
+	if err != nil {
+		return "", "", "", false
+	}
+	for _, box := range boxes {
+		body := content[box.body:box.end]
+		switch {
+		case box.kind == "mean" && len(body) >= 4:
+			mean = string(body[4:])
+		case box.kind == "name" && len(body) >= 4:
+			name = string(body[4:])
+		case box.kind == "data" && len(body) >= 8:
+			value = string(body[8:])
+		}
+	}
+	return mean, name, value, mean != "" && name != ""
+}
+
+// shiftChunkOffsets adds delta to the chunk offsets (stco and co64 boxes) of the tracks of the moov content which
+// point at or after the offset.
+func shiftChunkOffsets(moov []byte, from, delta int64) error {
+	traks, err := parseRawBoxes(moov)
+	if err != nil {
+		return err
+	}
+	for _, trak := range traks {
+		if trak.kind != "trak" {
+			continue
+		}
+		stbl, ok, err := findBoxPath(moov[trak.body:trak.end], []string{"mdia", "minf", "stbl"})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		boxes, err := parseRawBoxes(stbl)
+		if err != nil {
+			return err
+		}
+		for _, box := range boxes {
+			if box.kind != "stco" && box.kind != "co64" {
+				continue
+			}
+			// INFO: Version and flags (4 bytes), entry count (4 bytes) and the offsets (4 bytes, 8 on co64).
+			body := stbl[box.body:box.end]
+			if len(body) < 8 {
+				return errors.New("invalid mp4 chunk offset box")
+			}
+			size := 4
+			if box.kind == "co64" {
+				size = 8
+			}
+			count := int(binary.BigEndian.Uint32(body[4:8]))
+			if len(body) < 8+count*size {
+				return errors.New("invalid mp4 chunk offset box")
+			}
+			for i := range count {
+				entry := body[8+i*size:]
+				if size == 8 {
+					if offset := int64(binary.BigEndian.Uint64(entry)); offset >= from {
+						binary.BigEndian.PutUint64(entry, uint64(offset+delta))
+					}
+					continue
+				}
+				if offset := int64(binary.BigEndian.Uint32(entry)); offset >= from {
+					if offset+delta > math.MaxUint32 {
+						return errors.New("mp4 chunk offset overflows stco")
+					}
+					binary.BigEndian.PutUint32(entry, uint32(offset+delta))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// boxPrefix returns the size of the fields before the children of a box, the version and flags of the meta full box.
+func boxPrefix(kind string) int {
+	if kind == "meta" {
+		return 4
+	}
+	return 0
+}
+
+// findBoxPath returns the children of the box at the path, sharing the memory of the content.
+func findBoxPath(content []byte, path []string) ([]byte, bool, error) {
+	for _, kind := range path {
+		boxes, err := parseRawBoxes(content)
+		if err != nil {
+			return nil, false, err
+		}
+		found := false
+		for _, box := range boxes {
+			if box.kind == kind && box.body+boxPrefix(kind) <= box.end {
+				content, found = content[box.body+boxPrefix(kind):box.end], true
+				break
+			}
+		}
+		if !found {
+			return nil, false, nil
+		}
+	}
+	return content, true, nil
+}
+
+// editBoxPath returns the content with the children of the box at the path replaced by the result of edit,
+// creating the missing boxes.
+func editBoxPath(content []byte, path []string, edit func(children []byte) ([]byte, error)) ([]byte, error) {
+	if len(path) == 0 {
+		return edit(content)
+	}
+
+	boxes, err := parseRawBoxes(content)
+	if err != nil {
+		return nil, err
+	}
+	kind := path[0]
+	prefix := make([]byte, boxPrefix(kind))
+	for _, box := range boxes {
+		if box.kind != kind || box.body+len(prefix) > box.end {
+			continue
+		}
+		children, err := editBoxPath(content[box.body+len(prefix):box.end], path[1:], edit)
+		if err != nil {
+			return nil, err
+		}
+		edited := append([]byte{}, content[:box.start]...)
+		edited = append(edited, makeBox(kind, content[box.body:box.body+len(prefix)], children)...)
+		return append(edited, content[box.end:]...), nil
+	}
+
+	// INFO: The meta box of the iTunes tags has a handler of the mdir type.
+	var children []byte
+	if kind == "meta" {
+		children = makeBox("hdlr", make([]byte, 8), []byte("mdirappl"), make([]byte, 9))
+	}
+	children, err = editBoxPath(children, path[1:], edit)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, content...), makeBox(kind, prefix, children)...), nil
+}
+
+// parseRawBoxes lists the boxes of the content.
+func parseRawBoxes(content []byte) ([]rawBox, error) {
+	var boxes []rawBox
+	for offset := 0; offset+8 <= len(content); {
+		size := int64(binary.BigEndian.Uint32(content[offset:]))
+		header := 8
+		switch size {
+		case 0: // Up to the end
+			size = int64(len(content) - offset)
+		case 1: // 64 bits size after the type
+			if offset+16 > len(content) {
+				return nil, errors.New("invalid mp4 box size")
+			}
+			size = int64(binary.BigEndian.Uint64(content[offset+8:]))
+			header = 16
+		}
+		if size < int64(header) || size > int64(len(content)-offset) {
+			return nil, errors.New("invalid mp4 box size")
+		}
+
+		end := offset + int(size)
+		boxes = append(boxes, rawBox{kind: string(content[offset+4 : offset+8]), start: offset, body: offset + header, end: end})
+		offset = end
+	}
+	return boxes, nil
+}
+
+// makeBox returns a box of the kind with the content parts.
+func makeBox(kind string, parts ...[]byte) []byte {
+	size := 8
+	for _, part := range parts {
+		size += len(part)
+	}
+	box := binary.BigEndian.AppendUint32(make([]byte, 0, size), uint32(size))
+	box = append(box, kind...)
+	for _, part := range parts {
+		box = append(box, part...)
+	}
+	return box
+}
@@ -0,0 +1,116 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mp4Fixture returns a m4a file with an audio track of 4 seconds at 44.1 kHz stereo, its moov box before the
+// media data (faststart) and a chunk offset pointing at the start of the media data.
+func mp4Fixture(t *testing.T, ilst []byte) []byte {
+	t.Helper()
+	be32 := func(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+	mvhd := makeBox("mvhd", make([]byte, 4), be32(0), be32(0), be32(1000), be32(4000), make([]byte, 80))
+	mdhd := makeBox("mdhd", make([]byte, 4), be32(0), be32(0), be32(44100), be32(44100*4), make([]byte, 4))
+	hdlr := makeBox("hdlr", make([]byte, 8), []byte("soun"), make([]byte, 12))
+	entry := bytes.Join([][]byte{be32(36), []byte("mp4a"), make([]byte, 6), {0, 1}, make([]byte, 8), {0, 2}, {0, 16}, make([]byte, 4), be32(44100 << 16)}, nil)
+	stsd := makeBox("stsd", make([]byte, 4), be32(1), entry)
+	stco := makeBox("stco", make([]byte, 4), be32(1), be32(0)) // Set below
+	trak := makeBox("trak", makeBox("mdia", mdhd, hdlr, makeBox("minf", makeBox("stbl", stsd, stco))))
+	var udta []byte
+	if ilst != nil {
+		meta := makeBox("meta", make([]byte, 4), makeBox("hdlr", make([]byte, 8), []byte("mdirappl"), make([]byte, 9)), makeBox("ilst", ilst))
+		udta = makeBox("udta", meta)
+	}
+
+	ftyp := makeBox("ftyp", []byte("M4A "), be32(0))
+	moov := makeBox("moov", mvhd, trak, udta)
+	data := bytes.Join([][]byte{ftyp, moov, makeBox("mdat", []byte("audio data"))}, nil)
+
+	// The chunk offset is the last field of the stco box, which is the last box of the trak.
+	mdat := len(ftyp) + len(moov) + 8
+	stcoEnd := len(ftyp) + 8 + len(mvhd) + len(trak)
+	binary.BigEndian.PutUint32(data[stcoEnd-4:], uint32(mdat))
+	return data
+}
+
+// chunkData returns the 10 bytes at the chunk offset of the first track.
+func chunkData(t *testing.T, data []byte) string {
+	t.Helper()
+	moov, ok, err := findBoxPath(data, []string{"moov"})
+	if err != nil || !ok {
+		t.Fatalf("moov not found: %v", err)
+	}
+	stbl, ok, err := findBoxPath(moov, []string{"trak", "mdia", "minf", "stbl"})
+	if err != nil || !ok {
+		t.Fatalf("stbl not found: %v", err)
+	}
+	stco, ok, err := findBoxPath(stbl, []string{"stco"})
+	if err != nil || !ok {
+		t.Fatalf("stco not found: %v", err)
+	}
+	offset := int(binary.BigEndian.Uint32(stco[8:]))
+	if offset+10 > len(data) {
+		t.Fatalf("chunk offset %d is out of the file", offset)
+	}
+	return string(data[offset : offset+10])
+}
+
+func TestWriteMP4FreeformTags(t *testing.T) {
+	title := makeBox("\xa9nam", makeBox("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("Title")))
+	oldNorm := makeBox("----",
+		makeBox("mean", make([]byte, 4), []byte(iTunesMean)),
+		makeBox("name", make([]byte, 4), []byte("iTunNORM")),
+		makeBox("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("old")),
+	)
+
+	tests := []struct {
+		name string
+		ilst []byte
+	}{
+		{"without udta", nil},
+		{"with standard tags", title},
+		{"replacing a freeform tag", append(append([]byte{}, title...), oldNorm...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "track.m4a")
+			if err := os.WriteFile(path, mp4Fixture(t, tt.ilst), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			tags := map[string]string{"iTunNORM": " 00000100 00000100", "initialkey": "F#m"}
+			if err := WriteMP4FreeformTags(path, tags); err != nil {
+				t.Fatalf("WriteMP4FreeformTags() error = %v", err)
+			}
+
+			got, err := ReadMP4FreeformTags(path)
+			if err != nil {
+				t.Fatalf("ReadMP4FreeformTags() error = %v", err)
+			}
+			if len(got) != len(tags) || got["iTunNORM"] != tags["iTunNORM"] || got["initialkey"] != tags["initialkey"] {
+				t.Errorf("tags = %v, want %v", got, tags)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chunk := chunkData(t, data); chunk != "audio data" {
+				t.Errorf("chunk offset points at %q, want the media data", chunk)
+			}
+			if tt.ilst != nil && !bytes.Contains(data, title) {
+				t.Error("standard tags were not kept")
+			}
+
+			info, err := ReadAudioInfo(path)
+			if err != nil || info.Duration != 4 || info.Channels != 2 {
+				t.Errorf("ReadAudioInfo() = %+v, %v", info, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	oggPageHeaderSize = 27
+	oggTailSize       = 64 * 1024 // Bytes searched for the last page, which is at most 65307 bytes
+	opusSampleRate    = 48000     // Opus always decodes at 48 kHz, whatever the input rate in the header
+)
+
+var oggCapture = []byte("OggS")
+
+// readOgg reads the identification header of the first logical stream of an Ogg file (Opus or Vorbis)
+// and the granule position of its last page.
+func readOgg(r *io.SectionReader) (*AudioInfo, error) {
+	page := make([]byte, oggPageHeaderSize+255)
+	n, err := r.ReadAt(page, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	page = page[:n]
+	if len(page) < oggPageHeaderSize || !bytes.HasPrefix(page, oggCapture) {
+		return nil, errors.New("invalid ogg page")
+	}
+	serial := binary.LittleEndian.Uint32(page[14:18])
+	segments := int(page[26])
+
+	// INFO: The first page has only the identification header, right after the segment table.
+	packet := make([]byte, 19)
+	if _, err := r.ReadAt(packet, int64(oggPageHeaderSize+segments)); err != nil {
+		return nil, err
+	}
+
+	info := &AudioInfo{}
+	var preSkip int64
+	switch {
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		info.Codec = "opus"
+		info.Channels = int(packet[9])
+		info.SampleRate = opusSampleRate
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		info.Codec = "vorbis"
+		info.Channels = int(packet[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+	default:
+		return nil, errors.New("ogg stream is neither opus nor vorbis")
+	}
+	if info.SampleRate == 0 {
+		return nil, errors.New("ogg with invalid sample rate")
+	}
+
+	granule, err := lastOggGranule(r, serial)
+	if err != nil {
+		return nil, err
+	}
+	info.Duration = float64(max(granule-preSkip, 0)) / float64(info.SampleRate)
+	return info, nil
+}
+
+// lastOggGranule returns the granule position of the last page of the logical stream.
+func lastOggGranule(r *io.SectionReader, serial uint32) (int64, error) {
+	start := max(r.Size()-oggTailSize, 0)
+	tail := make([]byte, r.Size()-start)
+	if _, err := r.ReadAt(tail, start); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	for end := len(tail); end > 0; {
+		i := bytes.LastIndex(tail[:end], oggCapture)
+		if i < 0 {
+			break
+		}
+		end = i
+		if len(tail)-i < oggPageHeaderSize || binary.LittleEndian.Uint32(tail[i+14:i+18]) != serial {
+			continue
+		}
+		// INFO: -1 means that no packet finishes on the page.
+		if granule := int64(binary.LittleEndian.Uint64(tail[i+6 : i+14])); granule >= 0 {
+			return granule, nil
+		}
+	}
+	return 0, errors.New("no ogg page with a granule position found")
+}
@@ -0,0 +1,75 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatFloat      = 0x0003
+	wavFormatExtensible = 0xFFFE
+)
+
+// readWAV reads the fmt and data chunks of a RIFF WAVE file.
+func readWAV(r *io.SectionReader) (*AudioInfo, error) {
+	var info AudioInfo
+	var byteRate uint32
+	var dataSize int64 = -1
+
+	offset := int64(12) // RIFF header
+	chunk := make([]byte, 8)
+	for dataSize < 0 || byteRate == 0 {
+		if _, err := r.ReadAt(chunk, offset); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		id, size := string(chunk[:4]), int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			format := make([]byte, min(size, 40))
+			if _, err := r.ReadAt(format, offset+8); err != nil {
+				return nil, fmt.Errorf("error reading wav fmt chunk: %w", err)
+			}
+			if len(format) < 16 {
+				return nil, errors.New("wav fmt chunk too short")
+			}
+			tag := binary.LittleEndian.Uint16(format[0:2])
+			if tag == wavFormatExtensible && len(format) >= 26 {
+				tag = binary.LittleEndian.Uint16(format[24:26]) // First bytes of the sub format GUID
+			}
+			info.Channels = int(binary.LittleEndian.Uint16(format[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(format[4:8]))
+			byteRate = binary.LittleEndian.Uint32(format[8:12])
+			info.Codec = wavCodec(tag, int(binary.LittleEndian.Uint16(format[14:16])))
+		case "data":
+			dataSize = min(size, r.Size()-offset-8) // The size may be wrong on a truncated or streamed file
+		}
+
+		offset += 8 + size + size%2 // Chunks are padded to an even size
+	}
+
+	if byteRate == 0 || dataSize < 0 {
+		return nil, errors.New("wav without fmt or data chunk")
+	}
+	info.Duration = float64(dataSize) / float64(byteRate)
+	return &info, nil
+}
+
+// wavCodec returns the ffprobe name of the codec of a WAVE format tag.
+func wavCodec(tag uint16, bitsPerSample int) string {
+	switch {
+	case tag == wavFormatPCM && bitsPerSample == 8:
+		return "pcm_u8"
+	case tag == wavFormatPCM:
+		return fmt.Sprintf("pcm_s%dle", bitsPerSample)
+	case tag == wavFormatFloat:
+		return fmt.Sprintf("pcm_f%dle", bitsPerSample)
+	}
+	return fmt.Sprintf("wav_0x%04x", tag)
+}
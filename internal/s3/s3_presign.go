@@ -0,0 +1,35 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// PresignGetObject returns a presigned URL to download the object, valid for the given duration.
+func (s *S3Service) PresignGetObject(bucket, key string, expires time.Duration) (string, error) {
+	req, err := s3.NewPresignClient(s.Client).PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign GET of S3 bucket %s with key %s: %w", bucket, key, err)
+	}
+	return req.URL, nil
+}
+
+// PresignPutObject returns a presigned URL to upload the object, valid for the given duration.
+// INFO: The URL is signed without a content type, so the client can send any.
+func (s *S3Service) PresignPutObject(bucket, key string, expires time.Duration) (string, error) {
+	req, err := s3.NewPresignClient(s.Client).PresignPutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign PUT to S3 bucket %s with key %s: %w", bucket, key, err)
+	}
+	return req.URL, nil
+}
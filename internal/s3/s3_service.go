@@ -2,22 +2,53 @@ package s3
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"net/url"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"pitanguinha.com/audio-converter/internal/storage"
+	"pitanguinha.com/audio-converter/internal/utils"
 )
 
-// S3Service provides methods to interact with an S3-compatible storage service.
+// S3Service provides methods to interact with an S3-compatible storage service, it's the S3 backend of storage.ObjectStore.
 type S3Service struct {
-	Client *s3.Client
+	Client             *s3.Client
+	PartSize           int64 // Size of each part of multipart uploads and ranged downloads
+	Concurrency        int   // Number of parts transferred at the same time
+	MultipartThreshold int64 // Objects larger than this size are transferred in parts
 }
 
+var (
+	_ storage.ObjectStore       = (*S3Service)(nil)
+	_ storage.MultipartUploader = (*S3Service)(nil)
+	_ storage.Downloader        = (*S3Service)(nil)
+	_ storage.Presigner         = (*S3Service)(nil)
+)
+
+const (
+	defaultPartSizeMB           = 16
+	defaultConcurrency          = 4
+	defaultMultipartThresholdMB = 100
+	minPartSize                 = 5 * 1024 * 1024 // S3 requires at least 5 MiB for all parts but the last one
+)
+
 // NewService creates a new S3Service instance with the provided S3 client.
+// The transfer settings are read from the S3_PART_SIZE_MB, S3_CONCURRENCY and S3_MULTIPART_THRESHOLD_MB environment variables.
 func NewService(cfg aws.Config) *S3Service {
+	partSize := int64(utils.GetEnvInt("S3_PART_SIZE_MB", defaultPartSizeMB)) * 1024 * 1024
+	concurrency := utils.GetEnvInt("S3_CONCURRENCY", defaultConcurrency)
+
 	return &S3Service{
-		Client: s3.NewFromConfig(cfg),
+		Client:             s3.NewFromConfig(cfg),
+		PartSize:           max(partSize, minPartSize),
+		Concurrency:        max(concurrency, 1),
+		MultipartThreshold: int64(utils.GetEnvInt("S3_MULTIPART_THRESHOLD_MB", defaultMultipartThresholdMB)) * 1024 * 1024,
 	}
 }
 
@@ -36,21 +67,47 @@ func (s *S3Service) GetObject(bucket, key string) (io.ReadCloser, error) {
 	return resp.Body, nil
 }
 
-func (s *S3Service) ListObjectsForNotPrefix(bucket, notPrefix string) ([]string, error) {
-	req := &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
-		Prefix: aws.String(notPrefix),
-	}
-
-	resp, err := s.Client.ListObjectsV2(context.Background(), req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list objects in S3 bucket %s with prefix %s: %w", bucket, notPrefix, err)
+// ListObjects returns an iterator over all objects in the specified S3 bucket that match the given prefix.
+// The pages are requested lazily, following the continuation tokens until the listing is complete.
+// The iteration stops after yielding an error.
+func (s *S3Service) ListObjects(bucket, prefix string) iter.Seq2[storage.ObjectInfo, error] {
+	return func(yield func(storage.ObjectInfo, error) bool) {
+		paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		})
+
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(context.Background())
+			if err != nil {
+				yield(storage.ObjectInfo{}, fmt.Errorf("failed to list objects in S3 bucket %s with prefix %s: %w", bucket, prefix, err))
+				return
+			}
+
+			for _, obj := range page.Contents {
+				info := storage.ObjectInfo{
+					Key:          aws.ToString(obj.Key),
+					Size:         aws.ToInt64(obj.Size),
+					ETag:         aws.ToString(obj.ETag),
+					LastModified: aws.ToTime(obj.LastModified),
+				}
+				if !yield(info, nil) {
+					return
+				}
+			}
+		}
 	}
+}
 
+// ListObjectsForNotPrefix lists all objects in the specified S3 bucket that match the given prefix, except the prefix itself.
+func (s *S3Service) ListObjectsForNotPrefix(bucket, notPrefix string) ([]string, error) {
 	var keys []string
-	for _, obj := range resp.Contents {
-		if *obj.Key != notPrefix {
-			keys = append(keys, *obj.Key)
+	for obj, err := range s.ListObjects(bucket, notPrefix) {
+		if err != nil {
+			return nil, err
+		}
+		if obj.Key != notPrefix {
+			keys = append(keys, obj.Key)
 		}
 	}
 
@@ -59,31 +116,35 @@ func (s *S3Service) ListObjectsForNotPrefix(bucket, notPrefix string) ([]string,
 
 // ListObjectsForPrefix lists all objects in the specified S3 bucket that match the given prefix.
 func (s *S3Service) ListObjectsForPrefix(bucket, prefix string) ([]string, error) {
-	req := &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
-		Prefix: aws.String(prefix),
-	}
-
-	resp, err := s.Client.ListObjectsV2(context.Background(), req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list objects in S3 bucket %s with prefix %s: %w", bucket, prefix, err)
-	}
-
 	var keys []string
-	for _, obj := range resp.Contents {
-		keys = append(keys, *obj.Key)
+	for obj, err := range s.ListObjects(bucket, prefix) {
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, obj.Key)
 	}
 
 	return keys, nil
 }
 
 // PutObject uploads a new object to the specified S3 bucket.
-func (s *S3Service) PutObject(bucket, key, contentType string, body io.Reader) error {
+// If the options have a SHA-256 checksum, S3 verifies the content against it and rejects the object on mismatch.
+func (s *S3Service) PutObject(bucket, key string, body io.Reader, opts storage.PutOptions) error {
 	req := &s3.PutObjectInput{
-		Bucket:      aws.String(bucket),
-		Key:         aws.String(key),
-		ContentType: aws.String(contentType),
-		Body:        body,
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		ContentType:          aws.String(opts.ContentType),
+		CacheControl:         optionalString(opts.CacheControl),
+		ContentDisposition:   optionalString(opts.ContentDisposition),
+		ServerSideEncryption: types.ServerSideEncryption(opts.ServerSideEncryption),
+		SSEKMSKeyId:          optionalString(opts.KMSKeyID),
+		StorageClass:         types.StorageClass(opts.StorageClass),
+		Metadata:             opts.Metadata,
+		Tagging:              encodeTags(opts.Tags),
+		Body:                 body,
+	}
+	if opts.ChecksumSHA256 != nil {
+		req.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(opts.ChecksumSHA256))
 	}
 
 	_, err := s.Client.PutObject(context.Background(), req)
@@ -100,3 +161,85 @@ func (s *S3Service) DeleteObject(bucket, key string) error {
 	_, err := s.Client.DeleteObject(context.Background(), req)
 	return err
 }
+
+// CopyObject copies an object to another key of the same S3 bucket, server-side. The attributes of the copy are
+// replaced by the options and its SHA-256 is computed by S3. Objects larger than 5 GiB can't be copied this way.
+// INFO: The checksum of the options isn't sent, a copy can't be verified against it by S3.
+func (s *S3Service) CopyObject(bucket, srcKey, dstKey string, opts storage.PutOptions) error {
+	req := &s3.CopyObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(dstKey),
+		CopySource:           aws.String(bucket + "/" + (&url.URL{Path: srcKey}).EscapedPath()),
+		MetadataDirective:    types.MetadataDirectiveReplace,
+		TaggingDirective:     types.TaggingDirectiveReplace,
+		ContentType:          aws.String(opts.ContentType),
+		CacheControl:         optionalString(opts.CacheControl),
+		ContentDisposition:   optionalString(opts.ContentDisposition),
+		ServerSideEncryption: types.ServerSideEncryption(opts.ServerSideEncryption),
+		SSEKMSKeyId:          optionalString(opts.KMSKeyID),
+		StorageClass:         types.StorageClass(opts.StorageClass),
+		Metadata:             opts.Metadata,
+		Tagging:              encodeTags(opts.Tags),
+		ChecksumAlgorithm:    types.ChecksumAlgorithmSha256,
+	}
+
+	if _, err := s.Client.CopyObject(context.Background(), req); err != nil {
+		return fmt.Errorf("failed to copy object in S3 bucket %s from %s to %s: %w", bucket, srcKey, dstKey, err)
+	}
+	return nil
+}
+
+// HeadObject retrieves the attributes of an object, the error wraps storage.ErrNotFound if it doesn't exist.
+func (s *S3Service) HeadObject(bucket, key string) (storage.ObjectInfo, error) {
+	req := &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	}
+
+	resp, err := s.Client.HeadObject(context.Background(), req)
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			err = storage.ErrNotFound
+		}
+		return storage.ObjectInfo{}, fmt.Errorf("failed to head object from S3 bucket %s with key %s: %w", bucket, key, err)
+	}
+
+	return storage.ObjectInfo{
+		Key:                  key,
+		Size:                 aws.ToInt64(resp.ContentLength),
+		ETag:                 aws.ToString(resp.ETag),
+		ContentType:          aws.ToString(resp.ContentType),
+		ChecksumSHA256:       aws.ToString(resp.ChecksumSHA256),
+		ServerSideEncryption: string(resp.ServerSideEncryption),
+		Metadata:             resp.Metadata,
+		LastModified:         aws.ToTime(resp.LastModified),
+	}, nil
+}
+
+// UseMultipart reports whether a body of the given size is uploaded with a multipart upload.
+func (s *S3Service) UseMultipart(size int64) bool {
+	return size > s.MultipartThreshold
+}
+
+// optionalString returns nil for empty strings, so the attribute is not sent to S3.
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
+
+// encodeTags encodes the tags as the URL query string expected by the Tagging attribute, nil if there are no tags.
+func encodeTags(tags map[string]string) *string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	query := url.Values{}
+	for key, value := range tags {
+		query.Set(key, value)
+	}
+	return aws.String(query.Encode())
+}
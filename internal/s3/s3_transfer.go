@@ -0,0 +1,288 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"pitanguinha.com/audio-converter/internal/storage"
+)
+
+const maxParts = 10000 // S3 limit of parts in a multipart upload
+
+// transferErr keeps the first error of concurrent part transfers and cancels the others.
+type transferErr struct {
+	mu     sync.Mutex
+	err    error
+	cancel context.CancelFunc
+}
+
+func (t *transferErr) set(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = err
+		t.cancel()
+	}
+}
+
+func (t *transferErr) get() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// PutObjectStream uploads a body of unknown length to the specified S3 bucket using a multipart upload.
+// Up to Concurrency parts of PartSize are uploaded at the same time, each one with its SHA-256 checksum.
+// The upload is aborted if reading the body or uploading any part fails, or if the options have a SHA-256
+// checksum which doesn't match the body (S3 only has composite checksums for multipart SHA-256).
+func (s *S3Service) PutObjectStream(bucket, key string, body io.Reader, opts storage.PutOptions) error {
+	ctx := context.Background()
+
+	created, err := s.Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		ContentType:          aws.String(opts.ContentType),
+		CacheControl:         optionalString(opts.CacheControl),
+		ContentDisposition:   optionalString(opts.ContentDisposition),
+		ServerSideEncryption: types.ServerSideEncryption(opts.ServerSideEncryption),
+		SSEKMSKeyId:          optionalString(opts.KMSKeyID),
+		StorageClass:         types.StorageClass(opts.StorageClass),
+		Metadata:             opts.Metadata,
+		Tagging:              encodeTags(opts.Tags),
+		ChecksumAlgorithm:    types.ChecksumAlgorithmSha256,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload to S3 bucket %s with key %s: %w", bucket, key, err)
+	}
+
+	checksum := storage.NewChecksumWriter()
+	parts, err := s.uploadParts(ctx, bucket, key, created.UploadId, io.TeeReader(body, checksum))
+	if err != nil {
+		return s.abortMultipartUpload(bucket, key, created.UploadId, err)
+	}
+
+	if err := checksum.Sum().VerifySHA256(opts.ChecksumSHA256); err != nil {
+		return s.abortMultipartUpload(bucket, key, created.UploadId, err)
+	}
+
+	_, err = s.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return s.abortMultipartUpload(bucket, key, created.UploadId, err)
+	}
+
+	return nil
+}
+
+// uploadParts reads the body in parts of PartSize and uploads them concurrently.
+// Returns the completed parts sorted by part number.
+func (s *S3Service) uploadParts(ctx context.Context, bucket, key string, uploadID *string, body io.Reader) ([]types.CompletedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		parts []types.CompletedPart
+	)
+	errs := &transferErr{cancel: cancel}
+	sem := make(chan struct{}, s.Concurrency) // INFO: Also limits the memory used by the parts buffers
+
+	for partNumber := int32(1); ; partNumber++ {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+
+		if partNumber > maxParts {
+			<-sem
+			errs.set(fmt.Errorf("body exceeds %d parts of %d bytes", maxParts, s.PartSize))
+			break
+		}
+
+		buf := make([]byte, s.PartSize)
+		n, readErr := io.ReadFull(body, buf)
+		if readErr != nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+			<-sem
+			errs.set(fmt.Errorf("failed to read part %d: %w", partNumber, readErr))
+			break
+		}
+
+		// INFO: An empty body still needs one (empty) part to complete the upload.
+		if n == 0 && partNumber > 1 {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(partNumber int32, data []byte) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			part, err := s.uploadPart(ctx, bucket, key, uploadID, partNumber, data)
+			if err != nil {
+				errs.set(err)
+				return
+			}
+
+			mu.Lock()
+			parts = append(parts, part)
+			mu.Unlock()
+		}(partNumber, buf[:n])
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	wg.Wait()
+	if err := errs.get(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return *parts[i].PartNumber < *parts[j].PartNumber })
+	return parts, nil
+}
+
+// uploadPart uploads a single part of a multipart upload with its SHA-256 checksum, which is verified by S3.
+func (s *S3Service) uploadPart(ctx context.Context, bucket, key string, uploadID *string, partNumber int32, data []byte) (types.CompletedPart, error) {
+	sum := sha256.Sum256(data)
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+
+	resp, err := s.Client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:         aws.String(bucket),
+		Key:            aws.String(key),
+		UploadId:       uploadID,
+		PartNumber:     aws.Int32(partNumber),
+		ChecksumSHA256: aws.String(checksum),
+		Body:           bytes.NewReader(data),
+	})
+	if err != nil {
+		return types.CompletedPart{}, fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+	}
+
+	return types.CompletedPart{
+		ETag:           resp.ETag,
+		PartNumber:     aws.Int32(partNumber),
+		ChecksumSHA256: aws.String(checksum),
+	}, nil
+}
+
+// abortMultipartUpload aborts a multipart upload, so the uploaded parts are not stored, and returns the cause.
+func (s *S3Service) abortMultipartUpload(bucket, key string, uploadID *string, cause error) error {
+	_, err := s.Client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to abort multipart upload to S3 bucket %s with key %s: %w (cause: %w)", bucket, key, err, cause)
+	}
+	return fmt.Errorf("multipart upload to S3 bucket %s with key %s aborted: %w", bucket, key, cause)
+}
+
+// DownloadObject writes an object of the specified S3 bucket to w. Objects larger than MultipartThreshold are
+// downloaded with up to Concurrency ranged GETs of PartSize at the same time, all pinned to the same ETag.
+// Returns the size of the object.
+func (s *S3Service) DownloadObject(bucket, key string, w io.WriterAt) (int64, error) {
+	ctx := context.Background()
+
+	head, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to head object from S3 bucket %s with key %s: %w", bucket, key, err)
+	}
+
+	size := aws.ToInt64(head.ContentLength)
+	if size <= s.MultipartThreshold {
+		body, err := s.GetObject(bucket, key)
+		if err != nil {
+			return 0, err
+		}
+		defer body.Close()
+
+		n, err := io.Copy(io.NewOffsetWriter(w, 0), body)
+		if err != nil {
+			return n, fmt.Errorf("failed to download object from S3 bucket %s with key %s: %w", bucket, key, err)
+		}
+		return n, nil
+	}
+
+	if err := s.downloadRanges(ctx, bucket, key, head.ETag, size, w); err != nil {
+		return 0, fmt.Errorf("failed to download object from S3 bucket %s with key %s: %w", bucket, key, err)
+	}
+	return size, nil
+}
+
+// downloadRanges downloads the object in ranges of PartSize concurrently, writing each one at its offset.
+func (s *S3Service) downloadRanges(ctx context.Context, bucket, key string, etag *string, size int64, w io.WriterAt) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := &transferErr{cancel: cancel}
+	sem := make(chan struct{}, s.Concurrency)
+
+	for offset := int64(0); offset < size; offset += s.PartSize {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+
+		end := min(offset+s.PartSize, size) - 1
+
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := s.downloadRange(ctx, bucket, key, etag, start, end, w); err != nil {
+				errs.set(err)
+			}
+		}(offset, end)
+	}
+
+	wg.Wait()
+	return errs.get()
+}
+
+// downloadRange downloads the bytes from start to end (inclusive) of the object and writes them at start.
+func (s *S3Service) downloadRange(ctx context.Context, bucket, key string, etag *string, start, end int64, w io.WriterAt) error {
+	resp, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+		IfMatch: etag, // Fails if the object changes during the download
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get range %d-%d: %w", start, end, err)
+	}
+	defer resp.Body.Close()
+
+	n, err := io.Copy(io.NewOffsetWriter(w, start), resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to write range %d-%d: %w", start, end, err)
+	}
+	if n != end-start+1 {
+		return fmt.Errorf("range %d-%d is incomplete: got %d bytes", start, end, n)
+	}
+	return nil
+}
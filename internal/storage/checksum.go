@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned (wrapped) when the checksum of the transferred content doesn't match the expected one.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Checksum holds the digests of an object computed while it's transferred.
+type Checksum struct {
+	SHA256 []byte
+	MD5    []byte
+}
+
+// SHA256Hex returns the SHA-256 digest as a hex string, the format stored in the database.
+func (c Checksum) SHA256Hex() string {
+	return hex.EncodeToString(c.SHA256)
+}
+
+// SHA256Base64 returns the SHA-256 digest as a base64 string, the format used by S3.
+func (c Checksum) SHA256Base64() string {
+	return base64.StdEncoding.EncodeToString(c.SHA256)
+}
+
+// Verify compares the checksum with the one stored for the object: its full object SHA-256 checksum if it has one,
+// otherwise its ETag if it's the MD5 of the content (single part upload without KMS encryption).
+// Returns nil if there's nothing to compare with.
+func (c Checksum) Verify(info ObjectInfo) error {
+	if info.ChecksumSHA256 != "" && !strings.Contains(info.ChecksumSHA256, "-") {
+		if info.ChecksumSHA256 != c.SHA256Base64() {
+			return fmt.Errorf("%w: object %s has SHA-256 %s, got %s", ErrChecksumMismatch, info.Key, info.ChecksumSHA256, c.SHA256Base64())
+		}
+		return nil
+	}
+
+	etag := strings.Trim(info.ETag, `"`)
+	if len(etag) == md5.Size*2 && !strings.Contains(info.ServerSideEncryption, "kms") {
+		if etag != hex.EncodeToString(c.MD5) {
+			return fmt.Errorf("%w: object %s has ETag %s, got MD5 %s", ErrChecksumMismatch, info.Key, etag, hex.EncodeToString(c.MD5))
+		}
+	}
+	return nil
+}
+
+// VerifySHA256 compares the SHA-256 digest with the expected one, if there is one.
+func (c Checksum) VerifySHA256(expected []byte) error {
+	if expected != nil && !bytes.Equal(c.SHA256, expected) {
+		return fmt.Errorf("%w: expected SHA-256 %s, got %s", ErrChecksumMismatch, hex.EncodeToString(expected), c.SHA256Hex())
+	}
+	return nil
+}
+
+// ChecksumWriter computes the checksum of the content written to it.
+type ChecksumWriter struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+// NewChecksumWriter creates a new ChecksumWriter.
+func NewChecksumWriter() *ChecksumWriter {
+	return &ChecksumWriter{sha256: sha256.New(), md5: md5.New()}
+}
+
+// Write adds the content to the digests, it never fails.
+func (w *ChecksumWriter) Write(p []byte) (int, error) {
+	w.sha256.Write(p)
+	w.md5.Write(p)
+	return len(p), nil
+}
+
+// Sum returns the checksum of the content written so far.
+func (w *ChecksumWriter) Sum() Checksum {
+	return Checksum{SHA256: w.sha256.Sum(nil), MD5: w.md5.Sum(nil)}
+}
+
+// FileChecksum computes the checksum of the file content and rewinds it to the start.
+func FileChecksum(file *os.File) (Checksum, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return Checksum{}, fmt.Errorf("failed to rewind file %s: %w", file.Name(), err)
+	}
+
+	w := NewChecksumWriter()
+	if _, err := io.Copy(w, file); err != nil {
+		return Checksum{}, fmt.Errorf("failed to read file %s: %w", file.Name(), err)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return Checksum{}, fmt.Errorf("failed to rewind file %s: %w", file.Name(), err)
+	}
+	return w.Sum(), nil
+}
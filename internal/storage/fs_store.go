@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	tempFilePrefix    = ".tmp-"
+	sidecarFilePrefix = ".attributes-" // Sidecar file of the attributes of an object, next to it
+)
+
+// objectSidecar is the content of the sidecar of an object: its checksum, content type and metadata, valid while the
+// size and modification time of the file are the same.
+type objectSidecar struct {
+	Size        int64             `json:"size"`
+	ModTime     int64             `json:"mod_time"` // Unix nanoseconds
+	MD5         string            `json:"md5"`
+	SHA256      string            `json:"sha256"`
+	ContentType string            `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"` // Lowercase keys
+}
+
+// FileSystemStore is an ObjectStore on the local filesystem, each bucket is a directory under Root.
+type FileSystemStore struct {
+	Root string
+}
+
+var _ ObjectStore = (*FileSystemStore)(nil)
+
+// NewFileSystemStore creates a new FileSystemStore with the provided root directory.
+func NewFileSystemStore(root string) *FileSystemStore {
+	return &FileSystemStore{Root: root}
+}
+
+// GetObject opens the file of the object.
+func (f *FileSystemStore) GetObject(bucket, key string) (io.ReadCloser, error) {
+	filePath, err := f.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, f.wrapErr("get", bucket, key, err)
+	}
+	return file, nil
+}
+
+// PutObject writes the body to the file of the object, replacing it atomically, and its sidecar with the content
+// type and metadata of the options.
+func (f *FileSystemStore) PutObject(bucket, key string, body io.Reader, opts PutOptions) error {
+	filePath, err := f.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return f.wrapErr("put", bucket, key, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), tempFilePrefix+"*")
+	if err != nil {
+		return f.wrapErr("put", bucket, key, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename
+
+	w := NewChecksumWriter()
+	if _, err := io.Copy(io.MultiWriter(tmp, w), body); err != nil {
+		tmp.Close()
+		return f.wrapErr("put", bucket, key, err)
+	}
+	if err := w.Sum().VerifySHA256(opts.ChecksumSHA256); err != nil {
+		tmp.Close()
+		return f.wrapErr("put", bucket, key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return f.wrapErr("put", bucket, key, err)
+	}
+
+	// INFO: The sidecar is written before the rename, which keeps the modification time of the file. The metadata
+	// is only stored there, so the object isn't replaced if it can't be written.
+	stat, err := os.Stat(tmp.Name())
+	if err != nil {
+		return f.wrapErr("put", bucket, key, err)
+	}
+	if err := writeSidecar(filePath, stat, w.Sum(), opts.ContentType, lowerKeys(opts.Metadata)); err != nil {
+		return f.wrapErr("put", bucket, key, err)
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		os.Remove(sidecarPath(filePath))
+		return f.wrapErr("put", bucket, key, err)
+	}
+	return nil
+}
+
+// ListObjects returns an iterator over all objects of the bucket that match the given prefix, sorted by key.
+func (f *FileSystemStore) ListObjects(bucket, prefix string) iter.Seq2[ObjectInfo, error] {
+	return func(yield func(ObjectInfo, error) bool) {
+		bucketDir := filepath.Join(f.Root, bucket)
+
+		var objects []ObjectInfo
+		err := filepath.WalkDir(bucketDir, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || strings.HasPrefix(d.Name(), tempFilePrefix) || strings.HasPrefix(d.Name(), sidecarFilePrefix) {
+				return nil
+			}
+
+			rel, err := filepath.Rel(bucketDir, filePath)
+			if err != nil {
+				return err
+			}
+			key := filepath.ToSlash(rel)
+			if !strings.HasPrefix(key, prefix) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			objects = append(objects, fileObjectInfo(key, info))
+			return nil
+		})
+		if err != nil {
+			yield(ObjectInfo{}, fmt.Errorf("failed to list objects in bucket %s with prefix %s: %w", bucket, prefix, err))
+			return
+		}
+
+		sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+		for _, obj := range objects {
+			if !yield(obj, nil) {
+				return
+			}
+		}
+	}
+}
+
+// DeleteObject removes the file of the object, deleting a missing object is not an error (same as S3).
+func (f *FileSystemStore) DeleteObject(bucket, key string) error {
+	filePath, err := f.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return f.wrapErr("delete", bucket, key, err)
+	}
+	os.Remove(sidecarPath(filePath)) // A leftover sidecar is ignored, it doesn't match the next file
+	return nil
+}
+
+// CopyObject copies the object to another key of the same bucket, verified against the checksum of the options,
+// with the content type and metadata of the options.
+func (f *FileSystemStore) CopyObject(bucket, srcKey, dstKey string, opts PutOptions) error {
+	src, err := f.GetObject(bucket, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return f.PutObject(bucket, dstKey, src, opts)
+}
+
+// HeadObject returns the attributes of the object, the ETag is the MD5 of its content (same as a S3 single PUT)
+// and the SHA-256 checksum is the one of its content.
+// INFO: The attributes are read from the sidecar written by PutObject. When it's missing or the file was changed
+// after it, e.g. written by another process, the checksums are computed from the content (and the sidecar written
+// again), the object has no metadata and its content type is guessed from the key extension.
+func (f *FileSystemStore) HeadObject(bucket, key string) (ObjectInfo, error) {
+	filePath, err := f.objectPath(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return ObjectInfo{}, f.wrapErr("head", bucket, key, err)
+	}
+
+	sidecar, checksum, ok := readSidecar(filePath, stat)
+	if !ok {
+		checksum, stat, err = computeChecksum(filePath)
+		if err != nil {
+			return ObjectInfo{}, f.wrapErr("head", bucket, key, err)
+		}
+		sidecar = objectSidecar{}
+		writeSidecar(filePath, stat, checksum, "", nil) // A cache of the checksums, a failure is ignored
+	}
+
+	info := fileObjectInfo(key, stat)
+	info.ETag = `"` + hex.EncodeToString(checksum.MD5) + `"`
+	info.ChecksumSHA256 = checksum.SHA256Base64()
+	info.ContentType = sidecar.ContentType
+	if info.ContentType == "" {
+		info.ContentType = mime.TypeByExtension(path.Ext(key))
+	}
+	info.Metadata = sidecar.Metadata
+	return info, nil
+}
+
+// computeChecksum reads the file and returns its checksum with the attributes of the file when it was read.
+func computeChecksum(filePath string) (Checksum, fs.FileInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return Checksum{}, nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return Checksum{}, nil, err
+	}
+
+	w := NewChecksumWriter()
+	if _, err := io.Copy(w, file); err != nil {
+		return Checksum{}, nil, err
+	}
+	return w.Sum(), stat, nil
+}
+
+// sidecarPath returns the path of the sidecar of the file of an object.
+func sidecarPath(filePath string) string {
+	return filepath.Join(filepath.Dir(filePath), sidecarFilePrefix+filepath.Base(filePath)+".json")
+}
+
+// readSidecar returns the sidecar of the file and its checksum, false if it's missing, invalid or older than the
+// file (size or modification time changed).
+func readSidecar(filePath string, stat fs.FileInfo) (objectSidecar, Checksum, bool) {
+	data, err := os.ReadFile(sidecarPath(filePath))
+	if err != nil {
+		return objectSidecar{}, Checksum{}, false
+	}
+
+	var sidecar objectSidecar
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return objectSidecar{}, Checksum{}, false
+	}
+	if sidecar.Size != stat.Size() || sidecar.ModTime != stat.ModTime().UnixNano() {
+		return objectSidecar{}, Checksum{}, false
+	}
+
+	md5Sum, err := hex.DecodeString(sidecar.MD5)
+	if err != nil || len(md5Sum) != 16 {
+		return objectSidecar{}, Checksum{}, false
+	}
+	sha256Sum, err := hex.DecodeString(sidecar.SHA256)
+	if err != nil || len(sha256Sum) != 32 {
+		return objectSidecar{}, Checksum{}, false
+	}
+	return sidecar, Checksum{SHA256: sha256Sum, MD5: md5Sum}, true
+}
+
+// writeSidecar writes the sidecar of the file with the size and modification time of the file when the checksum
+// was computed.
+func writeSidecar(filePath string, stat fs.FileInfo, checksum Checksum, contentType string, metadata map[string]string) error {
+	data, err := json.Marshal(objectSidecar{
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime().UnixNano(),
+		MD5:         hex.EncodeToString(checksum.MD5),
+		SHA256:      checksum.SHA256Hex(),
+		ContentType: contentType,
+		Metadata:    metadata,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sidecarPath(filePath), data, 0o644)
+}
+
+// objectPath returns the file path of the object, rejecting keys that escape the bucket directory.
+func (f *FileSystemStore) objectPath(bucket, key string) (string, error) {
+	if bucket == "" || !filepath.IsLocal(bucket) || strings.ContainsAny(bucket, `/\`) {
+		return "", fmt.Errorf("invalid bucket name: %q", bucket)
+	}
+
+	rel := filepath.FromSlash(key)
+	if key == "" || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("invalid object key: %q", key)
+	}
+
+	return filepath.Join(f.Root, bucket, rel), nil
+}
+
+// wrapErr adds the operation and object to the error, mapping missing files to ErrNotFound.
+func (f *FileSystemStore) wrapErr(op, bucket, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to %s object %s from bucket %s: %w", op, key, bucket, ErrNotFound)
+	}
+	return fmt.Errorf("failed to %s object %s from bucket %s: %w", op, key, bucket, err)
+}
+
+// fileObjectInfo creates the ObjectInfo of a file, without ETag and content type.
+func fileObjectInfo(key string, info fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+	}
+}
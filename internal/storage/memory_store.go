@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryObject is an object stored by the MemoryStore.
+type memoryObject struct {
+	data         []byte
+	contentType  string
+	metadata     map[string]string
+	lastModified time.Time
+}
+
+// MemoryStore is an ObjectStore kept in memory, used to run the pipeline in tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string]memoryObject
+}
+
+var _ ObjectStore = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]map[string]memoryObject)}
+}
+
+// GetObject returns a reader over a copy of the object content.
+func (m *MemoryStore) GetObject(bucket, key string) (io.ReadCloser, error) {
+	obj, err := m.get(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(bytes.Clone(obj.data))), nil
+}
+
+// PutObject stores the body as the object content.
+func (m *MemoryStore) PutObject(bucket, key string, body io.Reader, opts PutOptions) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("failed to read body of object %s: %w", key, err)
+	}
+
+	sum := sha256.Sum256(data)
+	if err := (Checksum{SHA256: sum[:]}).VerifySHA256(opts.ChecksumSHA256); err != nil {
+		return fmt.Errorf("failed to put object %s: %w", key, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.buckets[bucket] == nil {
+		m.buckets[bucket] = make(map[string]memoryObject)
+	}
+	m.buckets[bucket][key] = memoryObject{data: data, contentType: opts.ContentType, metadata: lowerKeys(opts.Metadata), lastModified: time.Now()}
+	return nil
+}
+
+// ListObjects returns an iterator over all objects of the bucket that match the given prefix, sorted by key.
+func (m *MemoryStore) ListObjects(bucket, prefix string) iter.Seq2[ObjectInfo, error] {
+	return func(yield func(ObjectInfo, error) bool) {
+		m.mu.RLock()
+		var objects []ObjectInfo
+		for key, obj := range m.buckets[bucket] {
+			if strings.HasPrefix(key, prefix) {
+				info := memoryObjectInfo(key, obj)
+				info.ContentType, info.ChecksumSHA256, info.Metadata = "", "", nil
+				objects = append(objects, info)
+			}
+		}
+		m.mu.RUnlock()
+
+		sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+		for _, obj := range objects {
+			if !yield(obj, nil) {
+				return
+			}
+		}
+	}
+}
+
+// DeleteObject removes the object, deleting a missing object is not an error (same as S3).
+func (m *MemoryStore) DeleteObject(bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.buckets[bucket], key)
+	return nil
+}
+
+// CopyObject copies the object to another key of the same bucket, with the content type and metadata of the options.
+func (m *MemoryStore) CopyObject(bucket, srcKey, dstKey string, opts PutOptions) error {
+	obj, err := m.get(bucket, srcKey)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(obj.data)
+	if err := (Checksum{SHA256: sum[:]}).VerifySHA256(opts.ChecksumSHA256); err != nil {
+		return fmt.Errorf("failed to copy object %s to %s: %w", srcKey, dstKey, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj.contentType, obj.metadata, obj.lastModified = opts.ContentType, lowerKeys(opts.Metadata), time.Now()
+	m.buckets[bucket][dstKey] = obj
+	return nil
+}
+
+// HeadObject returns the attributes of the object.
+func (m *MemoryStore) HeadObject(bucket, key string) (ObjectInfo, error) {
+	obj, err := m.get(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return memoryObjectInfo(key, obj), nil
+}
+
+// get returns the object, or ErrNotFound if it doesn't exist.
+func (m *MemoryStore) get(bucket, key string) (memoryObject, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.buckets[bucket][key]
+	if !ok {
+		return memoryObject{}, fmt.Errorf("failed to get object %s from bucket %s: %w", key, bucket, ErrNotFound)
+	}
+	return obj, nil
+}
+
+// memoryObjectInfo creates the ObjectInfo of a stored object, the ETag is the MD5 of its content.
+func memoryObjectInfo(key string, obj memoryObject) ObjectInfo {
+	w := NewChecksumWriter()
+	w.Write(obj.data)
+	checksum := w.Sum()
+
+	return ObjectInfo{
+		Key:            key,
+		Size:           int64(len(obj.data)),
+		ETag:           `"` + hex.EncodeToString(checksum.MD5) + `"`,
+		ContentType:    obj.contentType,
+		ChecksumSHA256: checksum.SHA256Base64(),
+		Metadata:       maps.Clone(obj.metadata), // The caller can't change the stored object
+		LastModified:   obj.lastModified,
+	}
+}
+
+// lowerKeys returns a copy of the metadata with lowercase keys, as S3 returns them.
+func lowerKeys(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+
+	lowered := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		lowered[strings.ToLower(key)] = value
+	}
+	return lowered
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"time"
+)
+
+// ErrNotFound is returned (wrapped) when an object doesn't exist in the store.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo holds the key and attributes of an object.
+type ObjectInfo struct {
+	Key                  string
+	Size                 int64
+	ETag                 string
+	ContentType          string            // Empty on listings
+	ChecksumSHA256       string            // Base64, empty on listings or if the object has none
+	ServerSideEncryption string            // Empty on listings
+	Metadata             map[string]string // Custom metadata with lowercase keys, nil on listings
+	LastModified         time.Time
+}
+
+// PutOptions holds the attributes of an object written with PutObject.
+// INFO: The filesystem and in-memory backends only keep ContentType and Metadata, and verify ChecksumSHA256.
+type PutOptions struct {
+	ContentType          string
+	ChecksumSHA256       []byte // If set, the store verifies the content against it and rejects the object on mismatch
+	CacheControl         string
+	ContentDisposition   string
+	ServerSideEncryption string // "AES256" (SSE-S3), "aws:kms" or "aws:kms:dsse" (SSE-KMS)
+	KMSKeyID             string // Only used with SSE-KMS, the default AWS managed key is used if empty
+	StorageClass         string
+	Metadata             map[string]string // Stored as x-amz-meta-* headers
+	Tags                 map[string]string
+}
+
+// ObjectStore is a bucket/key object storage, implemented by S3 and by the filesystem and in-memory backends.
+type ObjectStore interface {
+	GetObject(bucket, key string) (io.ReadCloser, error)
+	PutObject(bucket, key string, body io.Reader, opts PutOptions) error
+	ListObjects(bucket, prefix string) iter.Seq2[ObjectInfo, error]
+	DeleteObject(bucket, key string) error
+	CopyObject(bucket, srcKey, dstKey string, opts PutOptions) error
+	HeadObject(bucket, key string) (ObjectInfo, error)
+}
+
+// MultipartUploader is implemented by stores which upload large or unknown length bodies in parts.
+type MultipartUploader interface {
+	PutObjectStream(bucket, key string, body io.Reader, opts PutOptions) error
+	UseMultipart(size int64) bool
+}
+
+// Downloader is implemented by stores with an optimized download to a file, e.g. parallel ranges.
+type Downloader interface {
+	DownloadObject(bucket, key string, w io.WriterAt) (int64, error)
+}
+
+// Presigner is implemented by stores which can create presigned URLs, so clients access objects without credentials.
+type Presigner interface {
+	PresignGetObject(bucket, key string, expires time.Duration) (string, error)
+	PresignPutObject(bucket, key string, expires time.Duration) (string, error)
+}
+
+// ListKeys returns the keys of all objects in the bucket that match the given prefix.
+func ListKeys(store ObjectStore, bucket, prefix string) ([]string, error) {
+	var keys []string
+	for obj, err := range store.ListObjects(bucket, prefix) {
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+// PutStream uploads a body of unknown length, in parts if the store supports it.
+func PutStream(store ObjectStore, bucket, key string, body io.Reader, opts PutOptions) error {
+	if uploader, ok := store.(MultipartUploader); ok {
+		return uploader.PutObjectStream(bucket, key, body, opts)
+	}
+	return store.PutObject(bucket, key, body, opts)
+}
+
+// PutFile uploads a file with its SHA-256 checksum, so the store verifies it, in parts if the store supports it
+// and the file is large enough. Returns the checksum of the file.
+func PutFile(store ObjectStore, bucket, key string, file *os.File, opts PutOptions) (Checksum, error) {
+	checksum, err := FileChecksum(file)
+	if err != nil {
+		return Checksum{}, err
+	}
+	opts.ChecksumSHA256 = checksum.SHA256
+
+	stat, err := file.Stat()
+	if err != nil {
+		return checksum, fmt.Errorf("failed to stat file %s: %w", file.Name(), err)
+	}
+
+	if uploader, ok := store.(MultipartUploader); ok && uploader.UseMultipart(stat.Size()) {
+		return checksum, uploader.PutObjectStream(bucket, key, file, opts)
+	}
+	return checksum, store.PutObject(bucket, key, file, opts)
+}
+
+// DownloadFile downloads an object to the file, using the optimized download of the store if it has one.
+// The checksum of the content is computed and verified against the one stored for the object.
+func DownloadFile(store ObjectStore, bucket, key string, file *os.File) (Checksum, error) {
+	info, err := store.HeadObject(bucket, key)
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	var checksum Checksum
+	if downloader, ok := store.(Downloader); ok {
+		if _, err := downloader.DownloadObject(bucket, key, file); err != nil {
+			return Checksum{}, err
+		}
+		// INFO: Ranges are written out of order, so the checksum is computed from the file.
+		if checksum, err = FileChecksum(file); err != nil {
+			return Checksum{}, err
+		}
+	} else {
+		body, err := store.GetObject(bucket, key)
+		if err != nil {
+			return Checksum{}, err
+		}
+		defer body.Close()
+
+		w := NewChecksumWriter()
+		if _, err := io.Copy(io.MultiWriter(file, w), body); err != nil {
+			return Checksum{}, fmt.Errorf("failed to download object %s from bucket %s: %w", key, bucket, err)
+		}
+		checksum = w.Sum()
+	}
+
+	if err := checksum.Verify(info); err != nil {
+		return checksum, fmt.Errorf("failed to verify object %s from bucket %s: %w", key, bucket, err)
+	}
+	return checksum, nil
+}
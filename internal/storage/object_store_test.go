@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testBucket = "bucket"
+
+// testStores returns the backends under test, each created empty.
+func testStores() map[string]func(t *testing.T) ObjectStore {
+	return map[string]func(t *testing.T) ObjectStore{
+		"memory":     func(t *testing.T) ObjectStore { return NewMemoryStore() },
+		"filesystem": func(t *testing.T) ObjectStore { return NewFileSystemStore(t.TempDir()) },
+	}
+}
+
+func putString(t *testing.T, store ObjectStore, key, content string, opts PutOptions) {
+	t.Helper()
+	if err := store.PutObject(testBucket, key, strings.NewReader(content), opts); err != nil {
+		t.Fatalf("PutObject(%s): %v", key, err)
+	}
+}
+
+func getString(t *testing.T, store ObjectStore, key string) string {
+	t.Helper()
+	body, err := store.GetObject(testBucket, key)
+	if err != nil {
+		t.Fatalf("GetObject(%s): %v", key, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestObjectStoreContract runs the same operations on each backend, they must behave as S3 does.
+func TestObjectStoreContract(t *testing.T) {
+	sha := sha256.Sum256([]byte("content"))
+	md5Sum := md5.Sum([]byte("content"))
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store ObjectStore)
+	}{
+		{"put, get and head", func(t *testing.T, store ObjectStore) {
+			putString(t, store, "doc/title.m4a", "content", PutOptions{
+				ContentType:    "audio/m4a",
+				ChecksumSHA256: sha[:],
+				Metadata:       map[string]string{"Document-Id": "doc"},
+			})
+
+			if got := getString(t, store, "doc/title.m4a"); got != "content" {
+				t.Errorf("content = %q, want %q", got, "content")
+			}
+			info, err := store.HeadObject(testBucket, "doc/title.m4a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Key != "doc/title.m4a" || info.Size != 7 || info.ContentType != "audio/m4a" ||
+				info.ETag != `"`+hex.EncodeToString(md5Sum[:])+`"` || info.ChecksumSHA256 != base64.StdEncoding.EncodeToString(sha[:]) {
+				t.Errorf("HeadObject() = %+v", info)
+			}
+			if info.Metadata["document-id"] != "doc" {
+				t.Errorf("metadata = %v, want lowercase keys", info.Metadata)
+			}
+		}},
+		{"put replaces the object and its attributes", func(t *testing.T, store ObjectStore) {
+			putString(t, store, "key", "old", PutOptions{Metadata: map[string]string{"owner": "a"}})
+			putString(t, store, "key", "new", PutOptions{})
+
+			info, err := store.HeadObject(testBucket, "key")
+			if err != nil || info.Size != 3 || info.Metadata["owner"] != "" || getString(t, store, "key") != "new" {
+				t.Errorf("HeadObject() = %+v, %v", info, err)
+			}
+		}},
+		{"put with a wrong checksum", func(t *testing.T, store ObjectStore) {
+			putString(t, store, "key", "old", PutOptions{})
+			other := sha256.Sum256([]byte("other"))
+
+			err := store.PutObject(testBucket, "key", strings.NewReader("content"), PutOptions{ChecksumSHA256: other[:]})
+			if !errors.Is(err, ErrChecksumMismatch) {
+				t.Errorf("PutObject() error = %v, want %v", err, ErrChecksumMismatch)
+			}
+			if got := getString(t, store, "key"); got != "old" {
+				t.Errorf("content after a rejected put = %q, want %q", got, "old")
+			}
+		}},
+		{"missing object", func(t *testing.T, store ObjectStore) {
+			if _, err := store.GetObject(testBucket, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetObject() error = %v, want %v", err, ErrNotFound)
+			}
+			if _, err := store.HeadObject(testBucket, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("HeadObject() error = %v, want %v", err, ErrNotFound)
+			}
+			if err := store.CopyObject(testBucket, "missing", "copy", PutOptions{}); !errors.Is(err, ErrNotFound) {
+				t.Errorf("CopyObject() error = %v, want %v", err, ErrNotFound)
+			}
+			if err := store.DeleteObject(testBucket, "missing"); err != nil {
+				t.Errorf("DeleteObject() error = %v, want nil", err)
+			}
+		}},
+		{"list by prefix sorted by key", func(t *testing.T, store ObjectStore) {
+			for _, key := range []string{"doc/b", "doc/versions/2/a", "doc/a", "other/a", "doc/versions/1/a"} {
+				putString(t, store, key, key, PutOptions{Metadata: map[string]string{"k": "v"}})
+			}
+
+			keys, err := ListKeys(store, testBucket, "doc/")
+			want := []string{"doc/a", "doc/b", "doc/versions/1/a", "doc/versions/2/a"}
+			if err != nil || !slices.Equal(keys, want) {
+				t.Errorf("ListKeys() = %v, %v, want %v", keys, err, want)
+			}
+			for obj, err := range store.ListObjects(testBucket, "doc/a") {
+				if err != nil || obj.Size != 5 || obj.Metadata != nil {
+					t.Errorf("listed object = %+v, %v, want the size and no metadata", obj, err)
+				}
+			}
+			if keys, err := ListKeys(store, "empty", ""); err != nil || len(keys) != 0 {
+				t.Errorf("ListKeys() of an empty bucket = %v, %v", keys, err)
+			}
+		}},
+		{"delete", func(t *testing.T, store ObjectStore) {
+			putString(t, store, "key", "content", PutOptions{})
+			if err := store.DeleteObject(testBucket, "key"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.HeadObject(testBucket, "key"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("HeadObject() after delete error = %v, want %v", err, ErrNotFound)
+			}
+		}},
+		{"copy with the attributes of the options", func(t *testing.T, store ObjectStore) {
+			putString(t, store, "src", "content", PutOptions{ContentType: "audio/mpeg", Metadata: map[string]string{"owner": "a"}})
+
+			other := sha256.Sum256([]byte("other"))
+			if err := store.CopyObject(testBucket, "src", "dst", PutOptions{ChecksumSHA256: other[:]}); !errors.Is(err, ErrChecksumMismatch) {
+				t.Errorf("CopyObject() with a wrong checksum error = %v, want %v", err, ErrChecksumMismatch)
+			}
+
+			opts := PutOptions{ContentType: "audio/mp4", ChecksumSHA256: sha[:], Metadata: map[string]string{"Owner": "b"}}
+			if err := store.CopyObject(testBucket, "src", "dst", opts); err != nil {
+				t.Fatal(err)
+			}
+			info, err := store.HeadObject(testBucket, "dst")
+			if err != nil || info.ContentType != "audio/mp4" || info.Metadata["owner"] != "b" || getString(t, store, "dst") != "content" {
+				t.Errorf("HeadObject() of the copy = %+v, %v", info, err)
+			}
+		}},
+		{"objects can't be changed through the returned values", func(t *testing.T, store ObjectStore) {
+			putString(t, store, "key", "content", PutOptions{Metadata: map[string]string{"owner": "a"}})
+
+			body, err := store.GetObject(testBucket, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(body)
+			body.Close()
+			data[0] = 'X'
+
+			info, _ := store.HeadObject(testBucket, "key")
+			info.Metadata["owner"] = "b"
+
+			if got := getString(t, store, "key"); got != "content" {
+				t.Errorf("content = %q, want %q", got, "content")
+			}
+			if info, _ := store.HeadObject(testBucket, "key"); info.Metadata["owner"] != "a" {
+				t.Errorf("metadata = %v, want the stored one", info.Metadata)
+			}
+		}},
+	}
+	for storeName, newStore := range testStores() {
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				tt.run(t, newStore(t))
+			})
+		}
+	}
+}
+
+// dirNames returns the names of the files in the directory.
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestFileSystemStore(t *testing.T) {
+	sha := sha256.Sum256([]byte("content"))
+
+	t.Run("temporary files and sidecars", func(t *testing.T) {
+		store := NewFileSystemStore(t.TempDir())
+		dir := filepath.Join(store.Root, testBucket, "doc")
+
+		putString(t, store, "doc/key", "content", PutOptions{ChecksumSHA256: sha[:]})
+		other := sha256.Sum256([]byte("other"))
+		store.PutObject(testBucket, "doc/key", strings.NewReader("content"), PutOptions{ChecksumSHA256: other[:]})
+
+		// The rejected put left no temporary file, the object has its sidecar.
+		want := []string{sidecarFilePrefix + "key.json", "key"}
+		if names := dirNames(t, dir); !slices.Equal(names, want) {
+			t.Errorf("files = %v, want %v", names, want)
+		}
+
+		// The files of an interrupted put and the sidecars are not objects.
+		if err := os.WriteFile(filepath.Join(dir, tempFilePrefix+"123"), []byte("partial"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if keys, err := ListKeys(store, testBucket, ""); err != nil || !slices.Equal(keys, []string{"doc/key"}) {
+			t.Errorf("ListKeys() = %v, %v, want [doc/key]", keys, err)
+		}
+
+		if err := store.DeleteObject(testBucket, "doc/key"); err != nil {
+			t.Fatal(err)
+		}
+		if names := dirNames(t, dir); !slices.Equal(names, []string{tempFilePrefix + "123"}) {
+			t.Errorf("files after delete = %v, want the sidecar removed", names)
+		}
+	})
+
+	t.Run("file changed after the sidecar", func(t *testing.T) {
+		store := NewFileSystemStore(t.TempDir())
+		putString(t, store, "key.mp3", "content", PutOptions{ContentType: "audio/custom", Metadata: map[string]string{"owner": "a"}})
+
+		// Written by another process, the attributes of the sidecar don't describe it anymore.
+		if err := os.WriteFile(filepath.Join(store.Root, testBucket, "key.mp3"), []byte("changed"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		changed := sha256.Sum256([]byte("changed"))
+
+		info, err := store.HeadObject(testBucket, "key.mp3")
+		if err != nil || info.ChecksumSHA256 != base64.StdEncoding.EncodeToString(changed[:]) ||
+			info.ContentType != "audio/mpeg" || info.Metadata != nil {
+			t.Errorf("HeadObject() = %+v, %v, want the checksum of the new content and no metadata", info, err)
+		}
+	})
+
+	t.Run("keys outside the bucket", func(t *testing.T) {
+		store := NewFileSystemStore(t.TempDir())
+		for _, key := range []string{"", "../key", "/key", "doc/../../key"} {
+			if err := store.PutObject(testBucket, key, strings.NewReader("content"), PutOptions{}); err == nil {
+				t.Errorf("PutObject(%q) succeeded, want an error", key)
+			}
+		}
+		for _, bucket := range []string{"", "..", "a/b"} {
+			if _, err := store.HeadObject(bucket, "key"); err == nil {
+				t.Errorf("HeadObject() on bucket %q succeeded, want an error", bucket)
+			}
+		}
+	})
+}
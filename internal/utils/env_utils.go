@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// GetEnvInt returns the integer value of the environment variable, or the default value if it is unset or invalid.
+func GetEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s: %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
@@ -68,6 +68,24 @@ func WriteToFileFromReader(dir, fileName string, reader io.Reader) (string, erro
 	return filePath, file.Sync()
 }
 
+// CreateFile creates (or truncates) a file in the specified directory and returns it, the caller must close it.
+func CreateFile(dir, fileName string) (*os.File, error) {
+	if fileName == "" {
+		return nil, fmt.Errorf("file name cannot be empty")
+	}
+
+	if err := CreateDir(dir); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	filePath := filepath.Join(dir, fileName)
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file %s: %w", filePath, err)
+	}
+	return file, nil
+}
+
 // DeleteFiles removes all files in the specified directory.
 func DeleteFiles(dir string) error {
 	files, err := os.ReadDir(dir)
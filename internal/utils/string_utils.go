@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Slugify converts a string to a lowercase slug of its letters and digits, e.g. "Canção Nº 1" to "cancao-no-1"
+// and "東京 Tokyo" to "東京-tokyo". The string is decomposed (NFKD) to remove the accents of the latin letters, the
+// marks of the other scripts are kept and the slug is composed again (NFC). Other characters become dashes.
+// INFO: The slug is empty if the string has no letters or digits, e.g. only symbols or emojis.
+func Slugify(s string) string {
+	var b strings.Builder
+	dash, latin := false, false
+
+	for _, r := range norm.NFKD.String(s) {
+		switch {
+		case unicode.IsMark(r) && (latin || dash || b.Len() == 0): // Accents of latin letters or marks without a letter
+			continue
+		case unicode.IsMark(r):
+			b.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+			dash, latin = false, r < utf8.RuneSelf || unicode.Is(unicode.Latin, r)
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	return norm.NFC.String(strings.TrimSuffix(b.String(), "-"))
+}
+
+// StripControlChars removes the control characters (e.g. newlines, tabs, NUL) from a string.
+func StripControlChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// TruncateBytes truncates a string to at most maxBytes bytes, without splitting a UTF-8 character.
+func TruncateBytes(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}
@@ -0,0 +1,59 @@
+package utils
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"accents of latin letters", "Canção Nº 1", "cancao-no-1"},
+		{"decomposed accents", "Cafe\u0301 Noir", "cafe-noir"},
+		{"compatibility characters", "ﬁnal ①", "final-1"},
+		{"other scripts", "東京 Tokyo", "東京-tokyo"},
+		{"cyrillic", "Привет, мир!", "привет-мир"},
+		{"marks of other scripts are kept", "हिन्दी गाना", "हिन्दी-गाना"},
+		{"greek accents are kept and composed", "Ελληνικά", "ελληνικά"},
+		{"sharp s", "Straße", "straße"},
+		{"separators collapsed and trimmed", "  --Hello__World--  ", "hello-world"},
+		{"mark without a letter", "\u0301abc", "abc"},
+		{"symbols only", "!!! ???", ""},
+		{"emojis only", "🎵🎶", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Slugify(tt.in); got != tt.want {
+				t.Errorf("Slugify(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateBytes(t *testing.T) {
+	tests := []struct {
+		in       string
+		maxBytes int
+		want     string
+	}{
+		{"short", 10, "short"},
+		{"exact", 5, "exact"},
+		{"truncated", 5, "trunc"},
+		{"aé", 2, "a"}, // é is 2 bytes, it's not split
+		{"aé", 3, "aé"},
+		{"東京", 4, "東"},
+		{"東京", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := TruncateBytes(tt.in, tt.maxBytes); got != tt.want {
+			t.Errorf("TruncateBytes(%q, %d) = %q, want %q", tt.in, tt.maxBytes, got, tt.want)
+		}
+	}
+}
+
+func TestStripControlChars(t *testing.T) {
+	if got := StripControlChars("a\tb\nc\x00d\u0085é"); got != "abcdé" {
+		t.Errorf("StripControlChars() = %q, want %q", got, "abcdé")
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"os"
+
 	"github.com/aws/aws-lambda-go/lambda"
 	"pitanguinha.com/audio-converter/handler"
 )
 
 func main() {
+	// INFO: The same binary is deployed as the upload URLs API, selected by the LAMBDA_HANDLER environment variable.
+	if os.Getenv("LAMBDA_HANDLER") == "upload_urls" {
+		lambda.Start(handler.UploadURLsHandler)
+		return
+	}
 	lambda.Start(handler.Handler)
 }